@@ -1,19 +1,32 @@
-// Package keybd implements functions that allow keyboard synthesization on both
-// MacOS and Windows desktops.
+// Package keybd implements functions that allow keyboard synthesization on
+// MacOS, Windows, and Linux desktops.
 package keybd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 )
 
-// Constants for common cross-platform errors.
-const (
-	ErrAborted      = "operation aborted"
-	ErrMaxCharacter = "character limit exceeded"
-	ErrTimeout      = "timeout exceeded"
-	ErrUnknown      = "error unknown"
-	ErrUncaught     = "uncaught error"
+// Errors for common cross-platform failures.
+var (
+	ErrAborted        = errors.New("operation aborted")
+	ErrMaxCharacter   = errors.New("character limit exceeded")
+	ErrTimeout        = errors.New("timeout exceeded")
+	ErrUnknown        = errors.New("error unknown")
+	ErrUncaught       = errors.New("uncaught error")
+	ErrNoBackend      = errors.New("backend not registered")
+	ErrNoKeystroke    = errors.New("no keystroke for rune")
+	ErrUnsupportedKey = errors.New("key code not supported")
+	ErrInvalidCombo   = errors.New("invalid key combination")
+	ErrInvalidScript  = errors.New("invalid script")
+	ErrInvalidCompose = errors.New("invalid compose file")
+	ErrNoLayout       = errors.New("layout not found")
+	ErrInvalidKeymap  = errors.New("invalid keymap")
+	ErrNoLockState    = errors.New("lock state not supported")
+	ErrModsHeld       = errors.New("modifier keys held")
 )
 
 // KeyPressDuration is how long to wait after pressing a key before releasing
@@ -22,7 +35,9 @@ const (
 // Default: 2 ms
 var KeyPressDuration time.Duration
 
-// TypeString is a struct that contains specific settings for [TypeStr].
+// TypeString is a struct that contains specific settings for [TypeStr]. Since
+// these settings are shared by every caller, use a [Typer] to type with
+// different settings concurrently.
 var TypeString struct {
 	// KeyDelay is how long to wait after releasing a key and before proceeding
 	// with pressing the next key.
@@ -37,7 +52,7 @@ var TypeString struct {
 	ModPressDuration time.Duration
 
 	// MaxCharacters is the maximum amount of characters in a string that can be
-	// processed.
+	// processed, counted as grapheme clusters with [GraphemeCount].
 	//
 	// Default: 5000
 	MaxCharacters int
@@ -54,18 +69,87 @@ var TypeString struct {
 	// Default: 4
 	TabSize int
 
-	// Timeout is how long [TypeStr] can run before aborting.
+	// Timeout is how long [TypeStr] can run before aborting. A call whose
+	// backend hangs returns at most a second after it.
 	//
 	// Default: 30 s
 	Timeout time.Duration
 
+	// Layout is the layout that runes are translated with instead of the
+	// translation of the backend, see [WithLayout].
+	//
+	// Default: nil
+	Layout *Layout
+
+	// Rhythm is the rhythm that times the keys instead of KeyDelay and
+	// [KeyPressDuration], see [WithRhythm].
+	//
+	// Default: nil
+	Rhythm Rhythm
+
+	// Typos is the planner of the typos to make and correct while typing,
+	// see [WithTypos].
+	//
+	// Default: nil
+	Typos *TypoPlanner
+
+	// Observer is a function that is called with the progress of typing, see
+	// [WithObserver].
+	//
+	// Default: nil
+	Observer func(e TypeEvent)
+
+	// CapsLock is how typing deals with Caps Lock, see [WithCapsLock].
+	//
+	// Default: CapsLockAuto
+	CapsLock CapsLockMode
+
+	// HeldMods is how typing deals with modifier keys that are held when it
+	// starts, see [WithHeldMods].
+	//
+	// Default: HeldModsIgnore
+	HeldMods HeldModsMode
+
+	// HeldModsTimeout is how long HeldModsWait waits for the modifier keys to
+	// be released.
+	//
+	// Default: 5 s
+	HeldModsTimeout time.Duration
+
 	// abort is a channel used in [AbortTypeStr] and [TypeStr].
 	abort chan struct{}
 
+	// pause pauses the calls that use these options, see [PauseTypeStr].
+	pause pauser
+
 	// mu is a Mutex used for syncing the memory before/after creating [abort].
 	mu sync.Mutex
 }
 
+// A TypeError is a struct that describes a rune that could not be typed. Typing
+// functions return one for every failed rune, combined with [errors.Join].
+type TypeError struct {
+	Index   int    // index of the rune in the string, counted in runes, or -1 for a typo
+	Rune    rune   // rune that could not be typed
+	Backend string // name of the backend the rune was typed on
+	Err     error  // underlying cause
+}
+
+// A StopError is a struct that describes a call to [Typer.Type] that stopped
+// before typing the whole string because it was aborted or timed out. Typing
+// resumes where it stopped with [Typer.TypeFrom] and Offset.
+type StopError struct {
+	Offset int   // number of runes of the string typed before stopping
+	Err    error // underlying cause, matching ErrAborted or ErrTimeout
+}
+
+// A preparer is a [Backend] that needs to prepare the target of the key events
+// before typing, such as focusing a window. The returned function undoes the
+// preparation.
+type preparer interface {
+	prepare() (cleanup func(), err error)
+}
+
 // AbortTypeStr safely aborts any previous calls to [TypeStr].
 func AbortTypeStr() {
 	TypeString.mu.Lock()
@@ -83,12 +167,130 @@ func AbortTypeStr() {
 	}
 }
 
+// PauseTypeStr pauses every call that types with [TypeString] options, such as
+// [TypeStr] and [TypeStrOnContext], until [ResumeTypeStr] is called, see
+// [Typer.Pause].
+func PauseTypeStr() { TypeString.pause.pause() }
+
+// ResumeTypeStr resumes the calls paused by [PauseTypeStr].
+func ResumeTypeStr() { TypeString.pause.resume() }
+
+// TypeStrOn types str on b using [TypeString] options. A timeout prevents the
+// function call from hanging indefinitely while an abort channel allows
+// aborting the operation.
+// It returns an error if the call fails.
+func TypeStrOn(b Backend, str string) (err error) {
+	ctx, cancel := abortContext()
+	defer cancel()
+
+	return TypeStrOnContext(ctx, b, str)
+}
+
+// TypeStrOnContext types str on b using [TypeString] options until it is done
+// or ctx is done. Unlike [TypeStrOn], it is not aborted by [AbortTypeStr]. It
+// is a thin wrapper over a [Typer] built from a snapshot of the current
+// options.
+// It returns an error if the call fails.
+func TypeStrOnContext(ctx context.Context, b Backend, str string) (err error) {
+	return typeStringTyper(b).Type(ctx, str)
+}
+
+// TypeStrOnFrom is like [TypeStrOn] but skips the first offset runes of str,
+// such as the Offset of a [StopError] to resume typing where it stopped.
+// It returns an error if the call fails.
+func TypeStrOnFrom(b Backend, str string, offset int) (err error) {
+	ctx, cancel := abortContext()
+	defer cancel()
+
+	return typeStringTyper(b).TypeFrom(ctx, str, offset)
+}
+
+// abortContext returns a context that is canceled by [AbortTypeStr].
+func abortContext() (context.Context, context.CancelFunc) {
+	TypeString.mu.Lock()
+	TypeString.abort = make(chan struct{})
+	abort := TypeString.abort
+	TypeString.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// typeStringTyper returns a [Typer] for b built from a snapshot of the
+// [TypeString] options.
+func typeStringTyper(b Backend) *Typer {
+	t := NewTyper(
+		WithBackend(b),
+		WithKeyDelay(TypeString.KeyDelay),
+		WithKeyPressDuration(KeyPressDuration),
+		WithModPressDuration(TypeString.ModPressDuration),
+		WithMaxCharacters(TypeString.MaxCharacters),
+		WithTabsToSpaces(TypeString.TabsToSpaces),
+		WithTabSize(TypeString.TabSize),
+		WithTimeout(TypeString.Timeout),
+		WithLayout(TypeString.Layout),
+		WithRhythm(TypeString.Rhythm),
+		WithTypos(TypeString.Typos),
+		WithObserver(TypeString.Observer),
+		WithCapsLock(TypeString.CapsLock),
+		WithHeldMods(TypeString.HeldMods),
+		WithHeldModsTimeout(TypeString.HeldModsTimeout),
+	)
+	t.pause = &TypeString.pause
+
+	return t
+}
+
+func (e *TypeError) Error() string {
+	if e.Index < 0 {
+		return fmt.Sprintf("%s: typo (%q): %v", e.Backend, e.Rune, e.Err)
+	}
+
+	return fmt.Sprintf("%s: rune %d (%q): %v", e.Backend, e.Index, e.Rune, e.Err)
+}
+
+func (e *TypeError) Unwrap() error { return e.Err }
+
+func (e *StopError) Error() string {
+	return fmt.Sprintf("stopped at rune %d: %v", e.Offset, e.Err)
+}
+
+func (e *StopError) Unwrap() error { return e.Err }
+
+// sleepContext pauses for d or until ctx is done, whichever happens first.
+// It returns the error of ctx if it is done before d elapses.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func init() {
-	KeyPressDuration = 2 * time.Millisecond
-	TypeString.KeyDelay = 2 * time.Millisecond
-	TypeString.ModPressDuration = 2 * time.Millisecond
-	TypeString.MaxCharacters = 5000
+	KeyPressDuration = defaultKeyPressDuration
+	TypeString.KeyDelay = defaultKeyDelay
+	TypeString.ModPressDuration = defaultModPressDuration
+	TypeString.MaxCharacters = defaultMaxCharacters
 	TypeString.TabsToSpaces = false
-	TypeString.TabSize = 4
-	TypeString.Timeout = 30 * time.Second
+	TypeString.TabSize = defaultTabSize
+	TypeString.Timeout = defaultTimeout
+	TypeString.HeldModsTimeout = defaultHeldModsTimeout
 }
@@ -0,0 +1,237 @@
+package keybd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Constants for modifier flags. The generic flags hold the left key of a
+// modifier, while ModAltGr holds the right Alt key, which is AltGr on layouts
+// that have it and the right Option key on macOS. Meta is the Command key on
+// macOS and the Windows or Super key elsewhere.
+const (
+	ModShift Mods = 1 << iota
+	ModCtrl
+	ModAlt
+	ModMeta
+	ModAltGr
+	ModRightShift
+	ModRightCtrl
+	ModRightMeta
+)
+
+// Constants for backend capabilities.
+const (
+	// CapKeyState is set when KeyIsDown reports the state of the whole system
+	// rather than only the keys pressed through the backend.
+	CapKeyState Capabilities = 1 << iota
+
+	// CapAnyRune is set when RuneToKeystroke can translate any rune, even ones
+	// that are missing from the keyboard layout.
+	CapAnyRune
+
+	// CapCapsLockUpper is set when Caps Lock types capital letters even while
+	// Shift is held, as on macOS, so that small letters can only be typed by
+	// turning it off.
+	CapCapsLockUpper
+)
+
+// A KeyCode identifies a physical key by its Linux input event code (see the
+// KEY_ constants). Every [Backend] maps key codes onto its native key codes.
+type KeyCode uint16
+
+// Mods is a set of modifier flags.
+type Mods uint16
+
+// Capabilities is a set of capability flags that describe a [Backend].
+type Capabilities uint32
+
+// A Keystroke is a struct that contains a key code and the modifiers that must
+// be held while it is pressed.
+type Keystroke struct {
+	Code KeyCode // key code of the key
+	Mods Mods    // modifiers to hold while pressing the key
+}
+
+// A Backend synthesizes key events for a platform or device. Applications can
+// pick one at runtime with [OpenBackend] and drive it with [TypeStrOn].
+type Backend interface {
+	// Name returns the name the backend is registered under.
+	Name() string
+
+	// Capabilities returns the capability flags of the backend.
+	Capabilities() Capabilities
+
+	// KeyPress sends a key-down event for code.
+	KeyPress(code KeyCode) error
+
+	// KeyRelease sends a key-up event for code.
+	KeyRelease(code KeyCode) error
+
+	// KeyIsDown detects the down state of code.
+	KeyIsDown(code KeyCode) bool
+
+	// RuneToKeystroke translates r to a keystroke. A keystroke with a zero key
+	// code means r produces no key event, which is the case for '\r'.
+	RuneToKeystroke(r rune) (Keystroke, error)
+
+	// Close releases the resources held by the backend.
+	Close() error
+}
+
+// modKeys maps each modifier flag to the key code that is pressed to hold it.
+var modKeys = []struct {
+	mod  Mods
+	code KeyCode
+}{
+	{ModShift, KEY_LEFTSHIFT},
+	{ModCtrl, KEY_LEFTCTRL},
+	{ModAlt, KEY_LEFTALT},
+	{ModMeta, KEY_LEFTMETA},
+	{ModAltGr, KEY_RIGHTALT},
+	{ModRightShift, KEY_RIGHTSHIFT},
+	{ModRightCtrl, KEY_RIGHTCTRL},
+	{ModRightMeta, KEY_RIGHTMETA},
+}
+
+// rightMods maps the flags of right-side modifier keys onto their generic
+// flags.
+var rightMods = map[Mods]Mods{
+	ModRightShift: ModShift,
+	ModRightCtrl:  ModCtrl,
+	ModRightMeta:  ModMeta,
+}
+
+// registry contains the backend factories in the order they were registered.
+var registry struct {
+	names []string
+	open  map[string]func() (Backend, error)
+	mu    sync.Mutex
+}
+
+// Generic returns m with the flags of right-side modifier keys replaced by
+// their generic flags, such as ModRightShift by ModShift, which is how layouts
+// see them. ModAltGr is kept, since it selects a level of its own.
+func (m Mods) Generic() Mods {
+	for right, generic := range rightMods {
+		if m&right != 0 {
+			m = m&^right | generic
+		}
+	}
+
+	return m
+}
+
+// Has reports whether every flag in c is set.
+func (caps Capabilities) Has(c Capabilities) bool { return caps&c == c }
+
+// RegisterBackend makes a backend available under name. Registering a name
+// twice replaces the previous factory.
+func RegisterBackend(name string, open func() (Backend, error)) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	if registry.open == nil {
+		registry.open = make(map[string]func() (Backend, error))
+	}
+
+	if _, ok := registry.open[name]; !ok {
+		registry.names = append(registry.names, name)
+	}
+
+	registry.open[name] = open
+}
+
+// Backends returns the names of the registered backends in the order they were
+// registered, with the [Recorder] last since it sends no key events anywhere.
+func Backends() []string {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	names := slices.Clone(registry.names)
+	if i := slices.Index(names, "recorder"); i >= 0 {
+		names = append(slices.Delete(names, i, i+1), "recorder")
+	}
+
+	return names
+}
+
+// OpenBackend opens the backend registered under name. An empty name opens the
+// first registered backend that opens without an error, skipping the
+// [Recorder] since it sends no key events anywhere.
+// It returns nil with an error if the call fails.
+func OpenBackend(name string) (Backend, error) {
+	registry.mu.Lock()
+	names := slices.Clone(registry.names)
+	open := registry.open[name]
+	registry.mu.Unlock()
+
+	if name != "" {
+		if open == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNoBackend, name)
+		}
+		return open()
+	}
+
+	var errs []error
+	for _, n := range names {
+		if n == "recorder" {
+			continue
+		}
+
+		b, err := OpenBackend(n)
+		if err == nil {
+			return b, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", n, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrNoBackend
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// KeyTapOn sends a key-down event and a key-up event to b with a brief pause in
+// between to help simulate an actual keystroke. The duration of the pause is
+// defined by [KeyPressDuration].
+// It returns an error if the call fails.
+func KeyTapOn(b Backend, code KeyCode) error {
+	return keyTap(context.Background(), b, code, KeyPressDuration)
+}
+
+// KeyTapOnContext is like [KeyTapOn] but sends nothing if ctx is already done
+// and cuts the pause short when ctx is done, still releasing the key.
+// It returns an error if the call fails or ctx is done.
+func KeyTapOnContext(ctx context.Context, b Backend, code KeyCode) error {
+	return keyTap(ctx, b, code, KeyPressDuration)
+}
+
+// keyTap is the base function for KeyTapOn that pauses for d between the
+// key-down event and the key-up event.
+func keyTap(ctx context.Context, b Backend, code KeyCode, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var errs []error
+
+	if err := pressKey(b, code); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := sleepContext(ctx, d); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := releaseKey(b, code); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
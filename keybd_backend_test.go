@@ -0,0 +1,206 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestOpenBackend(t *testing.T) {
+	tName := "Backend"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	stub := keybd.NewRecorder()
+	keybd.RegisterBackend("stub", func() (keybd.Backend, error) { return stub, nil })
+
+	if !slices.Contains(keybd.Backends(), "stub") {
+		t.Fatalf(test.ErrWantFGotF, "stub", keybd.Backends())
+	}
+	if names := keybd.Backends(); names[len(names)-1] != "recorder" {
+		t.Errorf(test.ErrWantFGotF, "recorder", names[len(names)-1])
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:   "stub",
+			Output:  stub,
+			Passing: true,
+		},
+		{
+			Input:   "missing",
+			Output:  keybd.ErrNoBackend,
+			Passing: false,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			b, err := keybd.OpenBackend(s.Input.(string))
+
+			if s.Passing {
+				if err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+				if b != s.Output {
+					t.Errorf(test.ErrWantFGotF, s.Output, b)
+				}
+			} else {
+				if !errors.Is(err, s.Output.(error)) {
+					t.Errorf(test.ErrWantFGotF, s.Output, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTypeStrOn(t *testing.T) {
+	tName := "Backend"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:   testStrings["shortWord"],
+			Output:  testStrings["shortWord"],
+			Passing: true,
+		},
+		{
+			Input:   testStrings["shortSentence"],
+			Output:  testStrings["shortSentence"],
+			Passing: true,
+		},
+		{
+			Input:   "Good morning!!! " + string(testRunes["emoji"]),
+			Output:  "Good morning!!! ",
+			Passing: false,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			b := keybd.NewRecorder()
+			err := keybd.TypeStrOn(b, s.Input.(string))
+
+			if s.Passing {
+				if err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+			} else {
+				if err == nil {
+					t.Errorf(test.ErrWantFGotF, "error", "none")
+				}
+			}
+
+			if err := b.EqualText(s.Output.(string)); err != nil {
+				t.Error(err)
+			}
+			if b.KeyIsDown(keybd.KEY_LEFTSHIFT) {
+				t.Errorf(test.ErrWantFGotF, false, true)
+			}
+		})
+	}
+}
+
+func TestTypeStrOnContext(t *testing.T) {
+	tName := "Backend"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	keyDelay := keybd.TypeString.KeyDelay
+	t.Cleanup(func() { keybd.TypeString.KeyDelay = keyDelay })
+	keybd.TypeString.KeyDelay = time.Millisecond
+
+	canceled, kept := keybd.NewRecorder(), keybd.NewRecorder()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer time.AfterFunc(10*time.Millisecond, cancel).Stop()
+
+	errs := make(chan error, 1)
+	go func() { errs <- keybd.TypeStrOnContext(ctx, canceled, testStrings["multiLineStringWithTabs"]) }()
+
+	// Neither cancelling ctx nor AbortTypeStr stops a call with its own context.
+	time.AfterFunc(20*time.Millisecond, keybd.AbortTypeStr)
+	if err := keybd.TypeStrOnContext(context.Background(), kept, testStrings["multiLineStringWithTabs"]); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := kept.EqualText(testStrings["multiLineStringWithTabs"]); err != nil {
+		t.Error(err)
+	}
+
+	if err := <-errs; !errors.Is(err, keybd.ErrAborted) || !errors.Is(err, context.Canceled) {
+		t.Errorf(test.ErrWantFGotF, context.Canceled, err)
+	}
+	if canceled.Text() == testStrings["multiLineStringWithTabs"] {
+		t.Errorf(test.ErrWantFGotF, "partial text", canceled.Text())
+	}
+}
+
+func TestKeyTapOnContext(t *testing.T) {
+	tName := "Backend"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rec := keybd.NewRecorder()
+	if err := keybd.KeyTapOnContext(ctx, rec, keybd.KEY_K); !errors.Is(err, context.Canceled) {
+		t.Errorf(test.ErrWantFGotF, context.Canceled, err)
+	}
+	if err := rec.EqualEvents(nil); err != nil {
+		t.Error(err)
+	}
+
+	if err := keybd.KeyTapOnContext(context.Background(), rec, keybd.KEY_K); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := rec.EqualText("k"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTypeError(t *testing.T) {
+	tName := "Backend"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	emoji := testRunes["emoji"]
+	str := string(emoji) + "Good morning" + string(emoji) + "!"
+
+	rec := keybd.NewRecorder()
+	err := keybd.TypeStrOn(rec, str)
+	if !errors.Is(err, keybd.ErrNoKeystroke) {
+		t.Fatalf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
+	}
+
+	var got []keybd.TypeError
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var typeErr *keybd.TypeError
+		if errors.As(e, &typeErr) {
+			got = append(got, keybd.TypeError{Index: typeErr.Index, Rune: typeErr.Rune, Backend: typeErr.Backend})
+		}
+	}
+
+	want := []keybd.TypeError{
+		{Index: 0, Rune: emoji, Backend: "recorder"},
+		{Index: 13, Rune: emoji, Backend: "recorder"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if err := rec.EqualText("Good morning!"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,307 @@
+package keybd
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// A Combo is a struct that contains a key and the modifiers that are held
+// while it is tapped, such as the ones parsed from "ctrl+shift+t".
+type Combo struct {
+	Mods Mods    // modifiers to hold while tapping the key
+	Code KeyCode // key code of the key
+}
+
+// A KeyEvent is a struct that contains a planned key-down or key-up event.
+type KeyEvent struct {
+	Code KeyCode // key code of the key
+	Down bool    // true for a key-down event, false for a key-up event
+}
+
+// keyNames lists the human key names. The first name of every key code is its
+// canonical name.
+var keyNames = []struct {
+	name string
+	code KeyCode
+}{
+	{"a", KEY_A}, {"b", KEY_B}, {"c", KEY_C}, {"d", KEY_D}, {"e", KEY_E},
+	{"f", KEY_F}, {"g", KEY_G}, {"h", KEY_H}, {"i", KEY_I}, {"j", KEY_J},
+	{"k", KEY_K}, {"l", KEY_L}, {"m", KEY_M}, {"n", KEY_N}, {"o", KEY_O},
+	{"p", KEY_P}, {"q", KEY_Q}, {"r", KEY_R}, {"s", KEY_S}, {"t", KEY_T},
+	{"u", KEY_U}, {"v", KEY_V}, {"w", KEY_W}, {"x", KEY_X}, {"y", KEY_Y},
+	{"z", KEY_Z},
+	{"0", KEY_0}, {"1", KEY_1}, {"2", KEY_2}, {"3", KEY_3}, {"4", KEY_4},
+	{"5", KEY_5}, {"6", KEY_6}, {"7", KEY_7}, {"8", KEY_8}, {"9", KEY_9},
+	{"f1", KEY_F1}, {"f2", KEY_F2}, {"f3", KEY_F3}, {"f4", KEY_F4},
+	{"f5", KEY_F5}, {"f6", KEY_F6}, {"f7", KEY_F7}, {"f8", KEY_F8},
+	{"f9", KEY_F9}, {"f10", KEY_F10}, {"f11", KEY_F11}, {"f12", KEY_F12},
+	{"enter", KEY_ENTER}, {"return", KEY_ENTER},
+	{"esc", KEY_ESC}, {"escape", KEY_ESC},
+	{"tab", KEY_TAB},
+	{"space", KEY_SPACE},
+	{"backspace", KEY_BACKSPACE},
+	{"delete", KEY_DELETE}, {"del", KEY_DELETE},
+	{"insert", KEY_INSERT}, {"ins", KEY_INSERT},
+	{"home", KEY_HOME},
+	{"end", KEY_END},
+	{"pageup", KEY_PAGEUP}, {"pgup", KEY_PAGEUP},
+	{"pagedown", KEY_PAGEDOWN}, {"pgdn", KEY_PAGEDOWN},
+	{"up", KEY_UP},
+	{"down", KEY_DOWN},
+	{"left", KEY_LEFT},
+	{"right", KEY_RIGHT},
+	{"capslock", KEY_CAPSLOCK},
+	{"numlock", KEY_NUMLOCK},
+	{"scrolllock", KEY_SCROLLLOCK},
+	{"printscreen", KEY_SYSRQ}, {"prtsc", KEY_SYSRQ}, {"sysrq", KEY_SYSRQ},
+	{"pause", KEY_PAUSE},
+	{"menu", KEY_COMPOSE}, {"compose", KEY_COMPOSE},
+	{"minus", KEY_MINUS}, {"-", KEY_MINUS},
+	{"equal", KEY_EQUAL}, {"=", KEY_EQUAL}, {"plus", KEY_EQUAL},
+	{"leftbracket", KEY_LEFTBRACE}, {"[", KEY_LEFTBRACE},
+	{"rightbracket", KEY_RIGHTBRACE}, {"]", KEY_RIGHTBRACE},
+	{"backslash", KEY_BACKSLASH}, {"\\", KEY_BACKSLASH},
+	{"semicolon", KEY_SEMICOLON}, {";", KEY_SEMICOLON},
+	{"apostrophe", KEY_APOSTROPHE}, {"quote", KEY_APOSTROPHE}, {"'", KEY_APOSTROPHE},
+	{"grave", KEY_GRAVE}, {"backtick", KEY_GRAVE}, {"`", KEY_GRAVE},
+	{"comma", KEY_COMMA}, {",", KEY_COMMA},
+	{"period", KEY_DOT}, {"dot", KEY_DOT}, {".", KEY_DOT},
+	{"slash", KEY_SLASH}, {"/", KEY_SLASH},
+	{"shift", KEY_LEFTSHIFT},
+	{"ctrl", KEY_LEFTCTRL},
+	{"alt", KEY_LEFTALT},
+	{"meta", KEY_LEFTMETA},
+	{"altgr", KEY_RIGHTALT},
+	{"rightshift", KEY_RIGHTSHIFT},
+	{"rightctrl", KEY_RIGHTCTRL},
+	{"rightmeta", KEY_RIGHTMETA},
+}
+
+// modNames maps the modifier names and their aliases to modifier flags.
+var modNames = map[string]Mods{
+	"shift":   ModShift,
+	"ctrl":    ModCtrl,
+	"control": ModCtrl,
+	"alt":     ModAlt,
+	"opt":     ModAlt,
+	"option":  ModAlt,
+	"meta":    ModMeta,
+	"cmd":     ModMeta,
+	"command": ModMeta,
+	"super":   ModMeta,
+	"win":     ModMeta,
+	"windows": ModMeta,
+	"lshift":  ModShift,
+	"lctrl":   ModCtrl,
+	"lalt":    ModAlt,
+	"lmeta":   ModMeta,
+	"lcmd":    ModMeta,
+	"lwin":    ModMeta,
+
+	"altgr":    ModAltGr,
+	"ralt":     ModAltGr,
+	"rightalt": ModAltGr,
+	"ropt":     ModAltGr,
+	"roption":  ModAltGr,
+
+	"rightshift": ModRightShift,
+	"rshift":     ModRightShift,
+
+	"rightctrl": ModRightCtrl,
+	"rctrl":     ModRightCtrl,
+	"rcontrol":  ModRightCtrl,
+
+	"rightmeta": ModRightMeta,
+	"rmeta":     ModRightMeta,
+	"rcmd":      ModRightMeta,
+	"rsuper":    ModRightMeta,
+	"rwin":      ModRightMeta,
+}
+
+// comboMods lists the modifier flags in the order they are named and pressed.
+var comboMods = []Mods{
+	ModCtrl, ModRightCtrl,
+	ModAlt, ModAltGr,
+	ModShift, ModRightShift,
+	ModMeta, ModRightMeta,
+}
+
+// keyCodesByName maps the key names to key codes, and keyNamesByCode maps the
+// key codes back to their canonical names.
+var (
+	keyCodesByName = map[string]KeyCode{}
+	keyNamesByCode = map[KeyCode]string{}
+)
+
+// ParseCombo parses a key combination made of modifier names and a key name
+// joined with "+", such as "ctrl+shift+t" or "cmd+space". Names are not case
+// sensitive. The modifier aliases "cmd", "super", and "win" all name the Meta
+// key, "opt" and "option" name the Alt key, and "primary" names the Command key
+// on macOS and the Control key elsewhere. The plain names hold the left keys,
+// while "rightshift", "rightctrl", "rightmeta", and "altgr" hold the right
+// ones, with the aliases "rshift", "rctrl", "rcmd", "rwin", "ralt", and
+// "ropt". Since "+" joins the names, the key that types it with Shift on US
+// layouts is named "plus" as well as "equal", such as in "ctrl+plus". A
+// combination of modifiers alone taps the last one, such as "ctrl+shift"
+// tapping Shift while holding Control.
+// It returns a zero Combo with an error wrapping [ErrInvalidCombo] if the
+// parsing fails.
+func ParseCombo(s string) (Combo, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "+")
+
+	var c Combo
+	for i, part := range parts {
+		name := strings.TrimSpace(part)
+		if name == "" {
+			return Combo{}, fmt.Errorf("%w %q: empty key name", ErrInvalidCombo, s)
+		}
+
+		if i < len(parts)-1 {
+			mod, ok := modName(name)
+			if !ok {
+				return Combo{}, fmt.Errorf("%w %q: unknown modifier %q", ErrInvalidCombo, s, name)
+			}
+			c.Mods |= mod
+			continue
+		}
+
+		if mod, ok := modName(name); ok {
+			c.Code = modKey(mod)
+			continue
+		}
+
+		code, ok := keyCodesByName[name]
+		if !ok {
+			return Combo{}, fmt.Errorf("%w %q: unknown key %q", ErrInvalidCombo, s, name)
+		}
+		c.Code = code
+	}
+
+	return c, nil
+}
+
+// KeyName returns the canonical name of code, or an empty string if code has
+// no name.
+func KeyName(code KeyCode) string { return keyNamesByCode[code] }
+
+// String formats c as modifier names and a key name joined with "+".
+func (c Combo) String() string {
+	if c.Mods == 0 {
+		return keyNamesByCode[c.Code]
+	}
+
+	return c.Mods.String() + "+" + keyNamesByCode[c.Code]
+}
+
+// String formats m as the canonical names of its modifiers joined with "+",
+// such as "ctrl+shift", in the order they are pressed.
+func (m Mods) String() string {
+	var names []string
+	for _, mod := range comboMods {
+		if m&mod != 0 {
+			names = append(names, keyNamesByCode[modKey(mod)])
+		}
+	}
+
+	return strings.Join(names, "+")
+}
+
+// Plan returns the key events that send c: the modifiers are pressed in the
+// order Ctrl, Alt, AltGr, Shift, Meta, each left key before the right one, the
+// key is tapped, and the modifiers are released in reverse order.
+func (c Combo) Plan() []KeyEvent {
+	var mods []KeyCode
+	for _, mod := range comboMods {
+		if code := modKey(mod); c.Mods&mod != 0 && code != c.Code {
+			mods = append(mods, code)
+		}
+	}
+
+	plan := make([]KeyEvent, 0, 2*len(mods)+2)
+	for _, code := range mods {
+		plan = append(plan, KeyEvent{Code: code, Down: true})
+	}
+
+	plan = append(plan, KeyEvent{Code: c.Code, Down: true}, KeyEvent{Code: c.Code, Down: false})
+
+	for i := len(mods) - 1; i >= 0; i-- {
+		plan = append(plan, KeyEvent{Code: mods[i], Down: false})
+	}
+
+	return plan
+}
+
+// SendComboOn parses combo with [ParseCombo] and sends it to b. The pause after
+// pressing the modifiers is defined by [TypeString].ModPressDuration and the
+// pause while the key is held by [KeyPressDuration]. Every pressed key is
+// released even if sending an event fails.
+// It returns an error if the call fails.
+func SendComboOn(b Backend, combo string) error {
+	c, err := ParseCombo(combo)
+	if err != nil {
+		return err
+	}
+
+	return sendPlan(b, c.Plan(), TypeString.ModPressDuration, KeyPressDuration)
+}
+
+// sendPlan sends the key events of plan to b, pausing for modPress after the
+// modifiers are pressed and for keyPress while the key is held.
+func sendPlan(b Backend, plan []KeyEvent, modPress, keyPress time.Duration) error {
+	var errs []error
+	for i, e := range plan {
+		if e.Down {
+			if err := pressKey(b, e.Code); err != nil {
+				errs = append(errs, err)
+			}
+		} else if err := releaseKey(b, e.Code); err != nil {
+			errs = append(errs, err)
+		}
+
+		if i+1 < len(plan) && e.Down {
+			if next := plan[i+1]; next.Down {
+				time.Sleep(modPress)
+			} else {
+				time.Sleep(keyPress)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// modKey returns the key code that is pressed to hold mod.
+func modKey(mod Mods) KeyCode {
+	for _, m := range modKeys {
+		if m.mod == mod {
+			return m.code
+		}
+	}
+
+	return KEY_RESERVED
+}
+
+// modName translates a modifier name or alias to a modifier flag.
+func modName(name string) (Mods, bool) {
+	if name == "primary" {
+		if runtime.GOOS == "darwin" {
+			return ModMeta, true
+		}
+		return ModCtrl, true
+	}
+
+	mod, ok := modNames[name]
+	return mod, ok
+}
+
+func init() {
+	for _, k := range keyNames {
+		keyCodesByName[k.name] = k.code
+		if _, ok := keyNamesByCode[k.code]; !ok {
+			keyNamesByCode[k.code] = k.name
+		}
+	}
+}
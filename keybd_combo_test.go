@@ -0,0 +1,194 @@
+package keybd_test
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestParseCombo(t *testing.T) {
+	tName := "Combo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	primary := keybd.ModCtrl
+	if runtime.GOOS == "darwin" {
+		primary = keybd.ModMeta
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:   "ctrl+shift+t",
+			Output:  keybd.Combo{Mods: keybd.ModCtrl | keybd.ModShift, Code: keybd.KEY_T},
+			Passing: true,
+		},
+		{
+			Input:   " Cmd + Space ",
+			Output:  keybd.Combo{Mods: keybd.ModMeta, Code: keybd.KEY_SPACE},
+			Passing: true,
+		},
+		{
+			Input:   "super+win+opt+f4",
+			Output:  keybd.Combo{Mods: keybd.ModMeta | keybd.ModAlt, Code: keybd.KEY_F4},
+			Passing: true,
+		},
+		{
+			Input:   "primary+/",
+			Output:  keybd.Combo{Mods: primary, Code: keybd.KEY_SLASH},
+			Passing: true,
+		},
+		{
+			Input:   "ctrl+plus",
+			Output:  keybd.Combo{Mods: keybd.ModCtrl, Code: keybd.KEY_EQUAL},
+			Passing: true,
+		},
+		{
+			Input:   "ctrl+shift",
+			Output:  keybd.Combo{Mods: keybd.ModCtrl, Code: keybd.KEY_LEFTSHIFT},
+			Passing: true,
+		},
+		{
+			Input:   "rctrl+RShift+rwin+k",
+			Output:  keybd.Combo{Mods: keybd.ModRightCtrl | keybd.ModRightShift | keybd.ModRightMeta, Code: keybd.KEY_K},
+			Passing: true,
+		},
+		{
+			Input:   "lctrl+ralt+e",
+			Output:  keybd.Combo{Mods: keybd.ModCtrl | keybd.ModAltGr, Code: keybd.KEY_E},
+			Passing: true,
+		},
+		{
+			Input:   "ctrl+rightshift",
+			Output:  keybd.Combo{Mods: keybd.ModCtrl, Code: keybd.KEY_RIGHTSHIFT},
+			Passing: true,
+		},
+		{
+			Input:   "ctrl+",
+			Passing: false,
+		},
+		{
+			Input:   "t+ctrl",
+			Passing: false,
+		},
+		{
+			Input:   "ctrl+hyper",
+			Passing: false,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			got, err := keybd.ParseCombo(s.Input.(string))
+
+			if s.Passing {
+				if err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+				if want := s.Output.(keybd.Combo); got != want {
+					t.Errorf(test.ErrWantFGotF, want, got)
+				}
+			} else {
+				if !errors.Is(err, keybd.ErrInvalidCombo) {
+					t.Errorf(test.ErrWantFGotF, keybd.ErrInvalidCombo, err)
+				}
+			}
+		})
+	}
+}
+
+func TestComboString(t *testing.T) {
+	tName := "Combo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	for i, s := range []string{"ctrl+shift+t", "meta+space", "alt+f4", "ctrl+alt+delete", "rightctrl+altgr+rightshift+rightmeta+a", "ctrl+rightctrl+shift"} {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			c, err := keybd.ParseCombo(s)
+			if err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+			if got := c.String(); got != s {
+				t.Errorf(test.ErrWantFGotF, s, got)
+			}
+		})
+	}
+}
+
+func TestSendComboOn(t *testing.T) {
+	tName := "Combo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	c, err := keybd.ParseCombo("shift+ctrl+t")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	want := []keybd.KeyEvent{
+		{Code: keybd.KEY_LEFTCTRL, Down: true},
+		{Code: keybd.KEY_LEFTSHIFT, Down: true},
+		{Code: keybd.KEY_T, Down: true},
+		{Code: keybd.KEY_T, Down: false},
+		{Code: keybd.KEY_LEFTSHIFT, Down: false},
+		{Code: keybd.KEY_LEFTCTRL, Down: false},
+	}
+	if got := c.Plan(); !slices.Equal(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	rec := keybd.NewRecorder()
+	if err := keybd.SendComboOn(rec, "shift+ctrl+t"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	err = rec.EqualEvents([]keybd.RecordedEvent{
+		{Code: keybd.KEY_LEFTCTRL, Down: true},
+		{Code: keybd.KEY_LEFTSHIFT, Down: true, Mods: keybd.ModCtrl},
+		{Code: keybd.KEY_T, Down: true, Mods: keybd.ModShift | keybd.ModCtrl},
+		{Code: keybd.KEY_T, Down: false, Mods: keybd.ModShift | keybd.ModCtrl},
+		{Code: keybd.KEY_LEFTSHIFT, Down: false, Mods: keybd.ModCtrl},
+		{Code: keybd.KEY_LEFTCTRL, Down: false},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := keybd.SendComboOn(rec, "ctrl+nope"); !errors.Is(err, keybd.ErrInvalidCombo) {
+		t.Errorf(test.ErrWantFGotF, keybd.ErrInvalidCombo, err)
+	}
+}
+
+func TestSendComboOnRightMods(t *testing.T) {
+	tName := "Combo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	if err := keybd.SendComboOn(rec, "rshift+rctrl+lctrl+t"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	mods := keybd.ModCtrl | keybd.ModRightCtrl | keybd.ModRightShift
+	err := rec.EqualEvents([]keybd.RecordedEvent{
+		{Code: keybd.KEY_LEFTCTRL, Down: true},
+		{Code: keybd.KEY_RIGHTCTRL, Down: true, Mods: keybd.ModCtrl},
+		{Code: keybd.KEY_RIGHTSHIFT, Down: true, Mods: keybd.ModCtrl | keybd.ModRightCtrl},
+		{Code: keybd.KEY_T, Down: true, Mods: mods},
+		{Code: keybd.KEY_T, Down: false, Mods: mods},
+		{Code: keybd.KEY_RIGHTSHIFT, Down: false, Mods: keybd.ModCtrl | keybd.ModRightCtrl},
+		{Code: keybd.KEY_RIGHTCTRL, Down: false, Mods: keybd.ModCtrl},
+		{Code: keybd.KEY_LEFTCTRL, Down: false},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
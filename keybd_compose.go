@@ -0,0 +1,333 @@
+package keybd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// keysymNames maps the X11 keysym names used in Compose files and XKB keymaps
+// to the runes they type, apart from letters and digits, which are named after
+// themselves.
+var keysymNames = map[string]rune{
+	"space":                ' ',
+	"exclam":               '!',
+	"quotedbl":             '"',
+	"numbersign":           '#',
+	"dollar":               '$',
+	"percent":              '%',
+	"ampersand":            '&',
+	"apostrophe":           '\'',
+	"parenleft":            '(',
+	"parenright":           ')',
+	"asterisk":             '*',
+	"plus":                 '+',
+	"comma":                ',',
+	"minus":                '-',
+	"period":               '.',
+	"slash":                '/',
+	"colon":                ':',
+	"semicolon":            ';',
+	"less":                 '<',
+	"equal":                '=',
+	"greater":              '>',
+	"question":             '?',
+	"at":                   '@',
+	"bracketleft":          '[',
+	"backslash":            '\\',
+	"bracketright":         ']',
+	"asciicircum":          '^',
+	"underscore":           '_',
+	"grave":                '`',
+	"braceleft":            '{',
+	"bar":                  '|',
+	"braceright":           '}',
+	"asciitilde":           '~',
+	"nobreakspace":         ' ',
+	"exclamdown":           '¡',
+	"cent":                 '¢',
+	"sterling":             '£',
+	"currency":             '¤',
+	"yen":                  '¥',
+	"brokenbar":            '¦',
+	"section":              '§',
+	"diaeresis":            '¨',
+	"copyright":            '©',
+	"ordfeminine":          'ª',
+	"guillemotleft":        '«',
+	"notsign":              '¬',
+	"registered":           '®',
+	"macron":               '¯',
+	"degree":               '°',
+	"plusminus":            '±',
+	"acute":                '´',
+	"mu":                   'µ',
+	"paragraph":            '¶',
+	"periodcentered":       '·',
+	"cedilla":              '¸',
+	"masculine":            'º',
+	"guillemotright":       '»',
+	"questiondown":         '¿',
+	"multiply":             '×',
+	"division":             '÷',
+	"EuroSign":             '€',
+	"onesuperior":          '¹',
+	"twosuperior":          '²',
+	"threesuperior":        '³',
+	"onequarter":           '¼',
+	"onehalf":              '½',
+	"threequarters":        '¾',
+	"Agrave":               'À',
+	"Aacute":               'Á',
+	"Acircumflex":          'Â',
+	"Atilde":               'Ã',
+	"Adiaeresis":           'Ä',
+	"Aring":                'Å',
+	"AE":                   'Æ',
+	"Ccedilla":             'Ç',
+	"Egrave":               'È',
+	"Eacute":               'É',
+	"Ecircumflex":          'Ê',
+	"Ediaeresis":           'Ë',
+	"Igrave":               'Ì',
+	"Iacute":               'Í',
+	"Icircumflex":          'Î',
+	"Idiaeresis":           'Ï',
+	"ETH":                  'Ð',
+	"Ntilde":               'Ñ',
+	"Ograve":               'Ò',
+	"Oacute":               'Ó',
+	"Ocircumflex":          'Ô',
+	"Otilde":               'Õ',
+	"Odiaeresis":           'Ö',
+	"Ooblique":             'Ø',
+	"Oslash":               'Ø',
+	"Ugrave":               'Ù',
+	"Uacute":               'Ú',
+	"Ucircumflex":          'Û',
+	"Udiaeresis":           'Ü',
+	"Yacute":               'Ý',
+	"THORN":                'Þ',
+	"ssharp":               'ß',
+	"agrave":               'à',
+	"aacute":               'á',
+	"acircumflex":          'â',
+	"atilde":               'ã',
+	"adiaeresis":           'ä',
+	"aring":                'å',
+	"ae":                   'æ',
+	"ccedilla":             'ç',
+	"egrave":               'è',
+	"eacute":               'é',
+	"ecircumflex":          'ê',
+	"ediaeresis":           'ë',
+	"igrave":               'ì',
+	"iacute":               'í',
+	"icircumflex":          'î',
+	"idiaeresis":           'ï',
+	"eth":                  'ð',
+	"ntilde":               'ñ',
+	"ograve":               'ò',
+	"oacute":               'ó',
+	"ocircumflex":          'ô',
+	"otilde":               'õ',
+	"odiaeresis":           'ö',
+	"oslash":               'ø',
+	"ugrave":               'ù',
+	"uacute":               'ú',
+	"ucircumflex":          'û',
+	"udiaeresis":           'ü',
+	"yacute":               'ý',
+	"thorn":                'þ',
+	"ydiaeresis":           'ÿ',
+	"lstroke":              'ł',
+	"Lstroke":              'Ł',
+	"oe":                   'œ',
+	"OE":                   'Œ',
+	"idotless":             'ı',
+	"ellipsis":             '…',
+	"endash":               '–',
+	"emdash":               '—',
+	"leftsinglequotemark":  '‘',
+	"rightsinglequotemark": '’',
+	"singlelowquotemark":   '‚',
+	"leftdoublequotemark":  '“',
+	"rightdoublequotemark": '”',
+	"doublelowquotemark":   '„',
+	"dagger":               '†',
+	"trademark":            '™',
+	"notequal":             '≠',
+	"infinity":             '∞',
+}
+
+// A ComposeTable is a table of Compose sequences, the keys typed after the
+// Compose key to type a rune, as read from an X11 Compose file.
+type ComposeTable struct {
+	sequences map[rune][][]rune
+}
+
+// ParseCompose reads a Compose file in the format of libX11, such as
+//
+//	<Multi_key> <apostrophe> <e> : "é" eacute
+//
+// Only the sequences that start with <Multi_key>, type a single rune, and name
+// keysyms that type runes are kept. Include statements are ignored.
+// It returns nil with an error wrapping [ErrInvalidCompose] if a line is
+// malformed.
+func ParseCompose(r io.Reader) (*ComposeTable, error) {
+	c := &ComposeTable{}
+	if err := c.parse(r, nil); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Sequences returns the Compose sequences that type r, shortest first, without
+// the leading Compose key.
+func (c *ComposeTable) Sequences(r rune) [][]rune { return c.sequences[r] }
+
+// Len returns the number of runes that c has Compose sequences for.
+func (c *ComposeTable) Len() int { return len(c.sequences) }
+
+// parse adds the sequences read from r to c, calling include with the quoted
+// argument of every include statement if include is not nil.
+func (c *ComposeTable) parse(r io.Reader, include func(path string) error) error {
+	if c.sequences == nil {
+		c.sequences = make(map[rune][][]rune)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "include"); ok {
+			path, _, err := cutQuoted(strings.TrimSpace(rest))
+			if err != nil {
+				return fmt.Errorf("%w: line %d: %w", ErrInvalidCompose, n, err)
+			}
+			if include != nil {
+				if err := include(path); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		lhs, rhs, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("%w: line %d: missing ':'", ErrInvalidCompose, n)
+		}
+
+		names := strings.Fields(lhs)
+		for _, name := range names {
+			if len(name) < 3 || name[0] != '<' || name[len(name)-1] != '>' {
+				return fmt.Errorf("%w: line %d: invalid event %q", ErrInvalidCompose, n, name)
+			}
+		}
+
+		result, err := composeResult(strings.TrimSpace(rhs))
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %w", ErrInvalidCompose, n, err)
+		}
+
+		if len(names) < 2 || names[0] != "<Multi_key>" || utf8.RuneCountInString(result) != 1 {
+			continue
+		}
+
+		seq := make([]rune, 0, len(names)-1)
+		for _, name := range names[1:] {
+			r, ok := keysymRune(name[1 : len(name)-1])
+			if !ok {
+				break
+			}
+			seq = append(seq, r)
+		}
+		if len(seq) != len(names)-1 {
+			continue
+		}
+
+		r, _ := utf8.DecodeRuneInString(result)
+		c.sequences[r] = append(c.sequences[r], seq)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, seqs := range c.sequences {
+		slices.SortStableFunc(seqs, func(a, b []rune) int { return len(a) - len(b) })
+	}
+
+	return nil
+}
+
+// composeResult parses the result of a Compose sequence, a quoted string
+// optionally followed by a keysym name, or a keysym name alone.
+func composeResult(rhs string) (string, error) {
+	if strings.HasPrefix(rhs, `"`) {
+		s, _, err := cutQuoted(rhs)
+		return s, err
+	}
+
+	name, _, _ := strings.Cut(rhs, " ")
+	if name == "" {
+		return "", fmt.Errorf("missing result")
+	}
+
+	r, ok := keysymRune(name)
+	if !ok {
+		return "", nil
+	}
+
+	return string(r), nil
+}
+
+// cutQuoted unquotes the quoted string that s starts with and returns the text
+// after it.
+func cutQuoted(s string) (quoted, rest string, err error) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", "", fmt.Errorf("missing quoted string")
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted, err = strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return quoted, s[i+1:], nil
+		}
+	}
+
+	return "", "", fmt.Errorf("unterminated string")
+}
+
+// keysymRune translates an X11 keysym name to the rune it types: letters and
+// digits are named after themselves, Unicode keysyms are named U followed by
+// the hexadecimal code point, and the rest are looked up in keysymNames.
+func keysymRune(name string) (rune, bool) {
+	if len(name) == 1 && (name[0] >= '0' && name[0] <= '9' || name[0]|0x20 >= 'a' && name[0]|0x20 <= 'z') {
+		return rune(name[0]), true
+	}
+
+	if hex, ok := strings.CutPrefix(name, "U"); ok && len(hex) >= 4 {
+		if cp, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(cp)) {
+			return rune(cp), true
+		}
+	}
+
+	r, ok := keysymNames[name]
+
+	return r, ok
+}
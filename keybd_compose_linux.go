@@ -0,0 +1,178 @@
+//go:build linux
+
+package keybd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultXLocaleDir is the directory of the libX11 locale files when
+// XLOCALEDIR is not set.
+const defaultXLocaleDir = "/usr/share/X11/locale"
+
+// LoadCompose reads the Compose file that libX11 uses for locale: the file
+// named by XCOMPOSEFILE, ~/.XCompose, or the Compose file of locale listed in
+// the compose.dir of the X11 locale directory. An empty locale uses LC_ALL,
+// LC_CTYPE, or LANG. Include statements are followed, with %L, %H, and %S
+// expanding to the Compose file of the locale, the home directory, and the
+// X11 locale directory.
+// It returns nil with an error if the call fails.
+func LoadCompose(locale string) (*ComposeTable, error) {
+	if locale == "" {
+		locale = envLocale()
+	}
+
+	path := os.Getenv("XCOMPOSEFILE")
+	if path == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if _, err := os.Stat(filepath.Join(home, ".XCompose")); err == nil {
+				path = filepath.Join(home, ".XCompose")
+			}
+		}
+	}
+	if path == "" {
+		var err error
+		if path, err = localeComposeFile(locale); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &ComposeTable{}
+	if err := c.load(path, locale, 0); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load adds the sequences of the Compose file at path to c, following include
+// statements up to a fixed depth.
+func (c *ComposeTable) load(path, locale string, depth int) error {
+	if depth > 8 {
+		return fmt.Errorf("%w: %s: includes nested too deeply", ErrInvalidCompose, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return c.parse(f, func(include string) error {
+		path, err := expandInclude(include, locale)
+		if err != nil {
+			return err
+		}
+
+		return c.load(path, locale, depth+1)
+	})
+}
+
+// expandInclude expands the %H, %S, %L, and %% sequences of an include path.
+func expandInclude(path, locale string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '%' || i+1 == len(path) {
+			b.WriteByte(path[i])
+			continue
+		}
+
+		i++
+		switch path[i] {
+		case 'H':
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(home)
+		case 'S':
+			b.WriteString(xLocaleDir())
+		case 'L':
+			file, err := localeComposeFile(locale)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(file)
+		default:
+			b.WriteByte(path[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// localeComposeFile looks up the Compose file of locale in compose.dir.
+func localeComposeFile(locale string) (string, error) {
+	dir := xLocaleDir()
+
+	f, err := os.Open(filepath.Join(dir, "compose.dir"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	locale = normalizeLocale(locale)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		file, name, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(name) == locale {
+			return filepath.Join(dir, file), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", errors.New("no Compose file for locale " + locale)
+}
+
+// xLocaleDir returns the directory of the libX11 locale files.
+func xLocaleDir() string {
+	if dir := os.Getenv("XLOCALEDIR"); dir != "" {
+		return dir
+	}
+
+	return defaultXLocaleDir
+}
+
+// envLocale returns the locale of the character classification set in the
+// environment.
+func envLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			return locale
+		}
+	}
+
+	return ""
+}
+
+// normalizeLocale spells locale the way compose.dir does, falling back to
+// en_US.UTF-8 for the C and POSIX locales.
+func normalizeLocale(locale string) string {
+	locale, _, _ = strings.Cut(locale, "@")
+
+	switch locale {
+	case "", "C", "POSIX", "C.UTF-8", "C.utf8":
+		return "en_US.UTF-8"
+	}
+
+	if lang, codeset, ok := strings.Cut(locale, "."); ok {
+		if c := strings.ToLower(strings.ReplaceAll(codeset, "-", "")); c == "utf8" {
+			return lang + ".UTF-8"
+		}
+	}
+
+	return locale
+}
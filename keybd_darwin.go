@@ -2,21 +2,30 @@
 
 package keybd
 
-// #cgo LDFLAGS: -framework Carbon -framework Foundation
+// #cgo LDFLAGS: -framework Carbon -framework Foundation -framework IOKit
 // #import "keybd_darwin.h"
 import "C"
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"time"
+	"sync"
+	"unicode/utf16"
 	"unsafe"
 )
 
-// Constants for virtual key codes of whitespace characters.
+// Constants for virtual key codes of modifier keys and whitespace characters.
 const (
-	VK_Shift  = 0x38
-	VK_Option = 0x3A
+	VK_Shift        = 0x38
+	VK_Control      = 0x3B
+	VK_Option       = 0x3A
+	VK_Command      = 0x37
+	VK_RightShift   = 0x3C
+	VK_RightControl = 0x3E
+	VK_RightOption  = 0x3D
+	VK_RightCommand = 0x36
+
 	VK_Return = 0x24
 	VK_Tab    = 0x30
 	VK_Space  = 0x31
@@ -25,22 +34,98 @@ const (
 
 // Constants for modifier key masks.
 const (
-	Mod_Shift  = 0x2
-	Mod_Option = 0x8
+	Mod_Command      = 0x1
+	Mod_Shift        = 0x2
+	Mod_Option       = 0x8
+	Mod_Control      = 0x10
+	Mod_RightShift   = 0x20
+	Mod_RightOption  = 0x40
+	Mod_RightControl = 0x80
 )
 
 // Constants for modifier key flags.
 const (
-	Flag_Shift  = 0x20000
-	Flag_Option = 0x80000
+	Flag_Shift   = 0x20000
+	Flag_Control = 0x40000
+	Flag_Option  = 0x80000
+	Flag_Command = 0x100000
+)
+
+// Constants for the device flags that tell the left and right modifier keys
+// apart.
+const (
+	Flag_LeftControl  = 0x1
+	Flag_LeftShift    = 0x2
+	Flag_RightShift   = 0x4
+	Flag_LeftCommand  = 0x8
+	Flag_RightCommand = 0x10
+	Flag_LeftOption   = 0x20
+	Flag_RightOption  = 0x40
+	Flag_RightControl = 0x2000
 )
 
-// StandardMods is a [Modifier] slice of the standard modifier keys.
+// StandardMods is a [Modifier] slice of the standard modifier keys, the left
+// keys before the right ones. UCKeyTranslate has no mask for the right Command
+// key, whose mask is 0.
 var StandardMods = []Modifier{
-	{Mask: Mod_Shift, VK: VK_Shift, Flag: Flag_Shift},
-	{Mask: Mod_Option, VK: VK_Option, Flag: Flag_Option},
+	{Mask: Mod_Shift, VK: VK_Shift, Flag: Flag_Shift | Flag_LeftShift, Mods: ModShift},
+	{Mask: Mod_Control, VK: VK_Control, Flag: Flag_Control | Flag_LeftControl, Mods: ModCtrl},
+	{Mask: Mod_Option, VK: VK_Option, Flag: Flag_Option | Flag_LeftOption, Mods: ModAlt},
+	{Mask: Mod_Command, VK: VK_Command, Flag: Flag_Command | Flag_LeftCommand, Mods: ModMeta},
+	{Mask: Mod_RightOption, VK: VK_RightOption, Flag: Flag_Option | Flag_RightOption, Mods: ModAltGr},
+	{Mask: Mod_RightShift, VK: VK_RightShift, Flag: Flag_Shift | Flag_RightShift, Mods: ModRightShift},
+	{Mask: Mod_RightControl, VK: VK_RightControl, Flag: Flag_Control | Flag_RightControl, Mods: ModRightCtrl},
+	{VK: VK_RightCommand, Flag: Flag_Command | Flag_RightCommand, Mods: ModRightMeta},
+}
+
+// virtualKeys maps key codes onto virtual key codes.
+//
+// See: https://github.com/phracker/MacOSX-SDKs/blob/master/MacOSX10.13.sdk/System/Library/Frameworks/Carbon.framework/Versions/A/Frameworks/HIToolbox.framework/Versions/A/Headers/Events.h
+var virtualKeys = map[KeyCode]uint16{
+	KEY_A: 0x00, KEY_S: 0x01, KEY_D: 0x02, KEY_F: 0x03, KEY_H: 0x04, KEY_G: 0x05,
+	KEY_Z: 0x06, KEY_X: 0x07, KEY_C: 0x08, KEY_V: 0x09, KEY_102ND: 0x0A, KEY_B: 0x0B,
+	KEY_Q: 0x0C, KEY_W: 0x0D, KEY_E: 0x0E, KEY_R: 0x0F, KEY_Y: 0x10, KEY_T: 0x11,
+	KEY_1: 0x12, KEY_2: 0x13, KEY_3: 0x14, KEY_4: 0x15, KEY_6: 0x16, KEY_5: 0x17,
+	KEY_EQUAL: 0x18, KEY_9: 0x19, KEY_7: 0x1A, KEY_MINUS: 0x1B, KEY_8: 0x1C, KEY_0: 0x1D,
+	KEY_RIGHTBRACE: 0x1E, KEY_O: 0x1F, KEY_U: 0x20, KEY_LEFTBRACE: 0x21, KEY_I: 0x22,
+	KEY_P: 0x23, KEY_ENTER: 0x24, KEY_L: 0x25, KEY_J: 0x26, KEY_APOSTROPHE: 0x27,
+	KEY_K: 0x28, KEY_SEMICOLON: 0x29, KEY_BACKSLASH: 0x2A, KEY_COMMA: 0x2B,
+	KEY_SLASH: 0x2C, KEY_N: 0x2D, KEY_M: 0x2E, KEY_DOT: 0x2F, KEY_TAB: 0x30,
+	KEY_SPACE: 0x31, KEY_GRAVE: 0x32, KEY_BACKSPACE: 0x33, KEY_ESC: 0x35,
+	KEY_RIGHTMETA: 0x36, KEY_LEFTMETA: 0x37, KEY_LEFTSHIFT: 0x38, KEY_CAPSLOCK: 0x39,
+	KEY_LEFTALT: 0x3A, KEY_LEFTCTRL: 0x3B, KEY_RIGHTSHIFT: 0x3C, KEY_RIGHTALT: 0x3D,
+	KEY_RIGHTCTRL: 0x3E, KEY_KPENTER: 0x4C, KEY_YEN: 0x5D, KEY_RO: 0x5E,
+	KEY_F5: 0x60, KEY_F6: 0x61, KEY_F7: 0x62, KEY_F3: 0x63, KEY_F8: 0x64, KEY_F9: 0x65,
+	KEY_F11: 0x67, KEY_F10: 0x6D, KEY_F12: 0x6F, KEY_INSERT: 0x72, KEY_HOME: 0x73,
+	KEY_PAGEUP: 0x74, KEY_DELETE: 0x75, KEY_F4: 0x76, KEY_END: 0x77, KEY_F2: 0x78,
+	KEY_PAGEDOWN: 0x79, KEY_F1: 0x7A, KEY_LEFT: 0x7B, KEY_RIGHT: 0x7C, KEY_DOWN: 0x7D,
+	KEY_UP: 0x7E,
+}
+
+// keyCodes maps virtual key codes back onto key codes.
+var keyCodes = map[uint16]KeyCode{}
+
+// modMasks maps the modifier key masks of UCKeyTranslate onto modifiers.
+var modMasks = map[uint16]Mods{
+	Mod_Command: ModMeta,
+	Mod_Shift:   ModShift,
+	Mod_Option:  ModAlt,
+}
+
+// keymaps caches the reverse keymap of the current keyboard layout.
+var keymaps = keymapCache[KeyboardLayoutInfo]{build: describeKeymap}
+
+// modFlags maps modifier keys onto the event flags they set while held, built
+// from [StandardMods].
+var modFlags = map[KeyCode]uint64{}
+
+// A DarwinError is an error reported by the native functions of keybd_darwin.h.
+type DarwinError struct {
+	Message string // message written to LastErrorMessage
 }
 
+func (e *DarwinError) Error() string { return e.Message }
+
 // A KeyboardLayoutInfo is a struct that contains the keyboard layout and
 // keyboard type of the current machine.
 type KeyboardLayoutInfo = struct {
@@ -48,12 +133,13 @@ type KeyboardLayoutInfo = struct {
 	Type   C.int
 }
 
-// A Modifier is a struct that contains the mask, the virtual key code, and the
-// event flag for a modifier key.
+// A Modifier is a struct that contains the mask, the virtual key code, the
+// event flags, and the modifier flag for a modifier key.
 type Modifier = struct {
 	Mask uint16
 	VK   uint16
 	Flag uint64
+	Mods Mods
 }
 
 // GetKeyboardLayoutInfo retrieves the layout and type for the local machine.
@@ -66,32 +152,39 @@ func GetKeyboardLayoutInfo() KeyboardLayoutInfo {
 	}
 }
 
-// RuneToVK translates r to a virtual key code and its shift state.
+// RuneToVK translates r to a virtual key code and its shift state with the
+// reverse keymap of [Keymap].
 // It returns a pair of 0's with an error if the translation fails, otherwise it
 // returns the key code, shift state, and a nil error.
 func RuneToVK(r rune, kli KeyboardLayoutInfo) (code, shift uint16, err error) {
-	switch r {
-	case '\r':
+	if r == '\r' {
 		return VK_None, 0, nil
-	case '\n':
-		return VK_Return, 0, nil
-	case '\t':
-		return VK_Tab, 0, nil
-	case ' ':
-		return VK_Space, 0, nil
 	}
 
-	var info C.KeyboardLayoutInfo
-	info.kbLayout = kli.Layout
-	info.kbType = kli.Type
-
-	kt := C.TranslateChar(C.UniChar(r), info)
+	ks, err := Keymap(kli).RuneToKeystroke(r)
+	if err != nil {
+		return 0, 0, err
+	}
 
-	if kt.vk == C.kVK_None {
-		return 0, 0, fmt.Errorf("%s", C.GoString(&C.LastErrorMessage[0]))
+	for _, m := range StandardMods {
+		if ks.Mods&m.Mods != 0 {
+			shift |= m.Mask
+		}
 	}
 
-	return uint16(kt.vk), uint16(kt.mods), nil
+	return virtualKeys[ks.Code], shift, nil
+}
+
+// Keymap returns the [Layout] of the keyboard layout of kli, whose
+// [Layout.ReverseKeymap] is the table that runes are translated with. It is
+// built once with UCKeyTranslate and reused until a different keyboard layout
+// is asked for, such as after the user switches input sources.
+func Keymap(kli KeyboardLayoutInfo) *Layout { return keymaps.get(kli) }
+
+// SystemLayoutSource returns the [LayoutSource] of the input source selected
+// on the machine, which reports the [Keymap] of [GetKeyboardLayoutInfo].
+func SystemLayoutSource() LayoutSource {
+	return LayoutSourceFunc(func() (*Layout, error) { return Keymap(GetKeyboardLayoutInfo()), nil })
 }
 
 // KeyIsDown detects the down state of virtKey.
@@ -103,7 +196,7 @@ func KeyIsDown(virtKey uint16) bool { return C.KeyIsDown(C.CGKeyCode(virtKey)) !
 // It returns an error if the call fails.
 func KeyPress(key uint16, flags uint64) error {
 	if r1 := C.KeyPress(C.CGKeyCode(key), C.CGEventFlags(flags)); r1 == 0 {
-		return fmt.Errorf("%s", C.GoString(&C.LastErrorMessage[0]))
+		return lastError()
 	}
 
 	return nil
@@ -114,7 +207,7 @@ func KeyPress(key uint16, flags uint64) error {
 // It returns an error if the call fails.
 func KeyRelease(key uint16, flags uint64) error {
 	if r1 := C.KeyRelease(C.CGKeyCode(key), C.CGEventFlags(flags)); r1 == 0 {
-		return fmt.Errorf("%s", C.GoString(&C.LastErrorMessage[0]))
+		return lastError()
 	}
 
 	return nil
@@ -126,71 +219,276 @@ func KeyRelease(key uint16, flags uint64) error {
 // It returns an error if the call fails.
 func KeyTap(key uint16, flags uint64) error {
 	if r1 := C.KeyTap(C.CGKeyCode(key), C.CGEventFlags(flags), C.int(KeyPressDuration)); r1 == 0 {
-		return fmt.Errorf("%s", C.GoString(&C.LastErrorMessage[0]))
+		return lastError()
 	}
 
 	return nil
 }
 
+// KeyTapContext is like [KeyTap] but sends nothing if ctx is already done and
+// cuts the pause short when ctx is done, still releasing the key.
+// It returns an error if the call fails or ctx is done.
+func KeyTapContext(ctx context.Context, key uint16, flags uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var errs []error
+
+	if err := KeyPress(key, flags); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := sleepContext(ctx, KeyPressDuration); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := KeyRelease(key, flags); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// SendCombo parses combo with [ParseCombo] and sends it, setting the flags of
+// the held modifier keys on every event.
+// It returns an error if the call fails.
+func SendCombo(combo string) error {
+	return SendComboOn(&darwinBackend{kli: GetKeyboardLayoutInfo()}, combo)
+}
+
+// RunScript runs s using the options defined at the top level.
+// It returns an error if the call fails.
+func RunScript(s *Script) error {
+	return RunScriptOn(&darwinBackend{kli: GetKeyboardLayoutInfo()}, s)
+}
+
 // TypeStr types str using the options defined at the top level. A timeout
 // prevents the function call from hanging indefinitely while an abort channel
 // allows aborting the operation.
 // It returns an error if the call fails.
 func TypeStr(str string) (err error) {
-	if len(str) == 0 {
-		return nil
-	} else if len(str) > TypeString.MaxCharacters {
-		return fmt.Errorf("%s", ErrMaxCharacter)
+	return TypeStrOn(&darwinBackend{kli: GetKeyboardLayoutInfo()}, str)
+}
+
+// TypeStrContext is like [TypeStr] but types until it is done or ctx is done.
+// Unlike [TypeStr], it is not aborted by [AbortTypeStr].
+// It returns an error if the call fails.
+func TypeStrContext(ctx context.Context, str string) (err error) {
+	return TypeStrOnContext(ctx, &darwinBackend{kli: GetKeyboardLayoutInfo()}, str)
+}
+
+// TypeStrFrom is like [TypeStr] but skips the first offset runes of str, such
+// as the Offset of a [StopError] to resume typing where it stopped.
+// It returns an error if the call fails.
+func TypeStrFrom(str string, offset int) (err error) {
+	return TypeStrOnFrom(&darwinBackend{kli: GetKeyboardLayoutInfo()}, str, offset)
+}
+
+// LockState detects whether Caps Lock is on.
+// It always returns a nil error.
+func LockState() (Locks, error) { return (&darwinBackend{}).LockState() }
+
+// SetLockState turns Caps Lock on or off, see [SetLockStateOn].
+// It returns an error wrapping [ErrNoLockState] if locks has other lock keys,
+// or if the call fails.
+func SetLockState(locks Locks, on bool) error {
+	return SetLockStateOn(&darwinBackend{}, locks, on)
+}
+
+// lastError returns the last error reported by the native functions.
+func lastError() error {
+	return &DarwinError{Message: C.GoString(&C.LastErrorMessage[0])}
+}
+
+// darwinBackend is the [Backend] that posts Quartz events. It tracks the held
+// modifier keys so that every event carries their flags.
+type darwinBackend struct {
+	kli  KeyboardLayoutInfo
+	held map[KeyCode]bool
+	mu   sync.Mutex
+}
+
+var (
+	_ Backend             = (*darwinBackend)(nil)
+	_ Composer            = (*darwinBackend)(nil)
+	_ UnicodeTyper        = (*darwinBackend)(nil)
+	_ LockReporter        = (*darwinBackend)(nil)
+	_ PhysicalKeyReporter = (*darwinBackend)(nil)
+)
+
+func (*darwinBackend) Name() string               { return "darwin" }
+func (*darwinBackend) Capabilities() Capabilities { return CapKeyState | CapCapsLockUpper }
+func (*darwinBackend) Close() error               { return nil }
+
+func (b *darwinBackend) KeyPress(code KeyCode) error {
+	vk, ok := virtualKeys[code]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnsupportedKey, code)
+	}
+
+	return KeyPress(vk, b.setHeld(code, true))
+}
+
+func (b *darwinBackend) KeyRelease(code KeyCode) error {
+	vk, ok := virtualKeys[code]
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnsupportedKey, code)
 	}
 
-	TypeString.mu.Lock()
-	TypeString.abort = make(chan struct{})
-	abort := TypeString.abort
-	TypeString.mu.Unlock()
+	return KeyRelease(vk, b.setHeld(code, false))
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), TypeString.Timeout)
-	defer cancel()
+// LockState reports Caps Lock, the only lock key of a Mac keyboard.
+func (*darwinBackend) LockState() (Locks, error) {
+	if C.CapsLockState() != 0 {
+		return LockCaps, nil
+	}
 
-	done := make(chan error, 1)
-	go func() { done <- typeStr(str) }()
+	return 0, nil
+}
 
-	select {
-	case err := <-done:
-		return err
-	case <-ctx.Done():
-		C.AbortOperation()
-		return fmt.Errorf("%s", ErrTimeout)
-	case <-abort:
-		C.AbortOperation()
-		return fmt.Errorf("%s", ErrAborted)
+// setLockState sets Caps Lock through the HID system, since posting Caps Lock
+// key events does not toggle it.
+func (*darwinBackend) setLockState(locks Locks, on bool) error {
+	if other := locks &^ LockCaps; other != 0 {
+		return fmt.Errorf("%w: %s", ErrNoLockState, other)
+	}
+
+	var state C.int
+	if on {
+		state = 1
+	}
+
+	if locks != 0 && C.SetCapsLockState(state) == 0 {
+		return lastError()
 	}
+
+	return nil
+}
+
+func (b *darwinBackend) KeyIsDown(code KeyCode) bool {
+	vk, ok := virtualKeys[code]
+	return ok && KeyIsDown(vk)
+}
+
+// PhysicalKeyIsDown reports whether code is down in the state of the HID
+// system, which [KeyIsDown] reads with CGEventSourceKeyState.
+func (b *darwinBackend) PhysicalKeyIsDown(code KeyCode) bool { return b.KeyIsDown(code) }
+
+func (b *darwinBackend) RuneToKeystroke(r rune) (Keystroke, error) {
+	return Keymap(b.kli).RuneToKeystroke(r)
+}
+
+// ComposeKeystrokes plans the dead key sequence that types r, see
+// [Layout.ComposeKeystrokes].
+func (b *darwinBackend) ComposeKeystrokes(r rune) ([]Keystroke, error) {
+	return Keymap(b.kli).ComposeKeystrokes(r)
 }
 
-// typeStr is the base function for TypeStr that makes the underlying call to
-// the C.TypeStr function.
-func typeStr(str string) (err error) {
-	cStr := C.CString(str)
-	defer C.free(unsafe.Pointer(cStr))
+// describeKeymap describes the keyboard layout of kli by translating every key
+// with every combination of the Shift, Option, and Command masks, along with
+// the dead keys of its four levels.
+func describeKeymap(kli KeyboardLayoutInfo) *Layout {
+	l := &Layout{
+		Name: "darwin",
+		Keys: map[Keystroke]rune{
+			{Code: KEY_ENTER}: '\n',
+			{Code: KEY_TAB}:   '\t',
+			{Code: KEY_SPACE}: ' ',
+		},
+		DeadKeys: make(map[Keystroke]rune),
+	}
+
+	if kli.Layout == nil {
+		return l
+	}
+
+	var info C.KeyboardLayoutInfo
+	info.kbLayout = kli.Layout
+	info.kbType = kli.Type
+
+	for vk := range uint16(128) {
+		code, ok := keyCodes[vk]
+		if !ok {
+			continue
+		}
+
+		for mask := range uint16(16) {
+			// The remaining mask is Caps Lock, which keystrokes do not
+			// express.
+			if mask&^(Mod_Command|Mod_Shift|Mod_Option) != 0 {
+				continue
+			}
+
+			var mods Mods
+			for m, mod := range modMasks {
+				if mask&m != 0 {
+					mods |= mod
+				}
+			}
+			ks := Keystroke{Code: code, Mods: mods}
+
+			if mask&Mod_Command == 0 {
+				if c := C.TranslateDeadKey(C.CGKeyCode(vk), C.UInt32(mask), info); c != 0 {
+					l.DeadKeys[ks] = rune(c)
+					continue
+				}
+			}
+
+			if c := rune(C.TranslateKey(C.CGKeyCode(vk), C.UInt32(mask), info)); c >= ' ' && c != 0x7F && !utf16.IsSurrogate(c) {
+				l.Keys[ks] = c
+			}
+		}
+	}
+
+	return l
+}
 
-	if r1 := C.TypeStr(
-		cStr,
-		C.int(TypeString.ModPressDuration/time.Microsecond),
-		C.int(KeyPressDuration/time.Microsecond),
-		C.int(TypeString.KeyDelay/time.Microsecond),
-		C.int(boolToInt(TypeString.TabsToSpaces)),
-		C.int(TypeString.TabSize),
-	); r1 == 0 {
-		return fmt.Errorf("%s", C.GoString(&C.LastErrorMessage[0]))
+// TypeRune types r by attaching it to a key event as a Unicode string.
+func (*darwinBackend) TypeRune(r rune) error {
+	units := utf16.Encode([]rune{r})
+	if r1 := C.TypeUnicode((*C.UniChar)(unsafe.Pointer(&units[0])), C.int(len(units))); r1 == 0 {
+		return lastError()
 	}
 
 	return nil
 }
 
-// boolToInt converts a bool to an int.
-func boolToInt(b bool) int {
-	if b {
-		return 1
+// setHeld records the state of code if it is a modifier key and returns the
+// event flags of the modifier keys that are held afterwards.
+func (b *darwinBackend) setHeld(code KeyCode, down bool) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := modFlags[code]; ok {
+		if b.held == nil {
+			b.held = make(map[KeyCode]bool)
+		}
+		if down {
+			b.held[code] = true
+		} else {
+			delete(b.held, code)
+		}
+	}
+
+	var flags uint64
+	for c := range b.held {
+		flags |= modFlags[c]
+	}
+
+	return flags
+}
+
+func init() {
+	for code, vk := range virtualKeys {
+		keyCodes[vk] = code
+	}
+	for _, m := range StandardMods {
+		modFlags[keyCodes[m.VK]] = m.Flag
 	}
 
-	return 0
+	RegisterBackend("darwin", func() (Backend, error) {
+		return &darwinBackend{kli: GetKeyboardLayoutInfo()}, nil
+	})
 }
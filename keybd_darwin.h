@@ -9,6 +9,7 @@
 #define KEYBD_H
 
 #include <Carbon/Carbon.h>
+#include <IOKit/hidsystem/IOHIDLib.h>
 #include <dispatch/dispatch.h>
 #include <stdarg.h>
 #include <string.h>
@@ -40,10 +41,6 @@ void set_LastErrorMessage(const char *__format, ...) {
            message);
 }
 
-volatile int AbortFlag = 0;
-
-void AbortOperation() { AbortFlag = 1; }
-
 /*!
     @const kVK_None
     @abstract An unassigned virtual key.
@@ -73,39 +70,6 @@ typedef struct {
   int kbType;
 } KeyboardLayoutInfo;
 
-/*!
-    @typedef KeyTranslation
-    @abstract Contains a virtual key code and its modifier mask.
-    @field vk Specifies the virtual key code.
-    @field mods Specifies the modifier mask.
-*/
-typedef struct {
-  CGKeyCode vk;
-  UInt32 mods;
-} KeyTranslation;
-
-/*!
-    @typedef Modifier
-    @abstract Contains a modifier's mask, virtual key code, and event flag.
-    @field mask Specifies the modifier's mask.
-    @field vk Specifies the modifier's virtual key code.
-    @field flag Specifies the modifier's event flag.
-*/
-typedef struct {
-  UInt32 mask;
-  CGKeyCode vk;
-  CGEventFlags flag;
-} Modifier;
-
-/*!
-    @var StandardMods
-    @abstract Modifier array of the two most common modifier keys on MacOS.
-*/
-Modifier StandardMods[2] = {
-    {.mask = kMod_Shift, .vk = kVK_Shift, .flag = kCGEventFlagMaskShift},
-    {.mask = kMod_Option, .vk = kVK_Option, .flag = kCGEventFlagMaskAlternate},
-};
-
 /*!
     @function CalledOnMainThread
     @abstract Specifies if a function is called on the main thread.
@@ -122,66 +86,79 @@ int CalledOnMainThread() {
 }
 
 /*!
-    @function TranslateChar
-    @abstract Translates a char into a virtual key code and modifier mask.
-    @param c
-        Character to translate.
+    @function TranslateKey
+    @abstract Translates a virtual key code into the character it types without
+        processing dead keys.
+    @param vk
+        Virtual key code to translate.
+    @param mods
+        Modifier mask to translate vk with.
     @param kli
         Keyboard layout information.
     @returns
-        KeyTranslation
+        The character typed by vk with mods, or 0 if it types none or more than
+        one.
 */
-KeyTranslation TranslateChar(UniChar c, KeyboardLayoutInfo kli) {
-  switch (c) {
-  case '\r':
-    return (KeyTranslation){.vk = kVK_None, .mods = 0};
-  case '\n':
-    return (KeyTranslation){.vk = kVK_Return, .mods = 0};
-  case '\t':
-    return (KeyTranslation){.vk = kVK_Tab, .mods = 0};
-  case ' ':
-    return (KeyTranslation){.vk = kVK_Space, .mods = 0};
-  }
+UniChar TranslateKey(CGKeyCode vk, UInt32 mods, KeyboardLayoutInfo kli) {
+  UniChar chars[4];
+  UniCharCount len = 0;
+  UInt32 deadKeyState = 0;
+  OSStatus status =
+      UCKeyTranslate(kli.kbLayout, vk, kUCKeyActionDown, mods, kli.kbType,
+                     kUCKeyTranslateNoDeadKeysBit, &deadKeyState,
+                     sizeof(chars) / sizeof(chars[0]), &len, chars);
+
+  if (status != noErr || len != 1)
+    return 0;
 
-  KeyTranslation keymap = {.vk = kVK_None, .mods = 0};
-
-  for (UInt32 mods = 0; mods < (1 << 4); mods++) {
-    for (int key = 0; key < 128; key++) {
-      UniChar chars[4];
-      UniCharCount len = 0;
-      UInt32 deadKeyState = 0;
-      OSStatus status =
-          UCKeyTranslate(kli.kbLayout, key, kUCKeyActionDown, mods, kli.kbType,
-                         kUCKeyTranslateNoDeadKeysBit, &deadKeyState,
-                         sizeof(chars) / sizeof(chars[0]), &len, chars);
-
-      if (status == noErr && len > 0 && chars[0] == c) {
-        keymap.vk = key;
-        keymap.mods = mods;
-        return keymap;
-      }
-    }
-  }
+  return chars[0];
+}
 
-  set_LastErrorMessage("TranslateChar(c=%c, kli={.kbLayout=%d, .kbType=%d})", c,
-                       kli.kbLayout, kli.kbType);
+/*!
+    @function TranslateDeadKey
+    @abstract Translates a dead key into the character it types when followed
+        by a space.
+    @param vk
+        Virtual key code to translate.
+    @param mods
+        Modifier mask to translate vk with.
+    @param kli
+        Keyboard layout information.
+    @returns
+        The spacing character of the dead key, or 0 if vk is not a dead key with
+        mods.
+*/
+UniChar TranslateDeadKey(CGKeyCode vk, UInt32 mods, KeyboardLayoutInfo kli) {
+  UniChar chars[4];
+  UniCharCount len = 0;
+  UInt32 deadKeyState = 0;
+  OSStatus status =
+      UCKeyTranslate(kli.kbLayout, vk, kUCKeyActionDown, mods, kli.kbType, 0,
+                     &deadKeyState, sizeof(chars) / sizeof(chars[0]), &len,
+                     chars);
+
+  if (status != noErr || deadKeyState == 0)
+    return 0;
+
+  status = UCKeyTranslate(kli.kbLayout, kVK_Space, kUCKeyActionDown, 0,
+                          kli.kbType, 0, &deadKeyState,
+                          sizeof(chars) / sizeof(chars[0]), &len, chars);
+
+  if (status != noErr || len != 1)
+    return 0;
 
-  return keymap;
+  return chars[0];
 }
 
 /*!
     @function GetKeyboardLayoutInfo
-    @abstract Identifies the local keyboard layout and type.
+    @abstract Identifies the current keyboard layout and type, keeping the
+        last ones found while the input source has no layout data.
     @result
         KeyboardLayoutInfo
 */
 KeyboardLayoutInfo GetKeyboardLayoutInfo() {
   static KeyboardLayoutInfo info = {0};
-  static bool isCached = false;
-
-  if (isCached) {
-    return info;
-  }
 
   static void (^fn)(void) = ^{
     TISInputSourceRef layoutRef = TISCopyCurrentKeyboardLayoutInputSource();
@@ -191,7 +168,6 @@ KeyboardLayoutInfo GetKeyboardLayoutInfo() {
     if (layoutData) {
       info.kbLayout = (UCKeyboardLayout *)CFDataGetBytePtr(layoutData);
       info.kbType = LMGetKbdType();
-      isCached = true;
     }
 
     CFRelease(layoutRef);
@@ -247,6 +223,56 @@ int KeyIsDown(CGKeyCode vk) {
   return CGEventSourceKeyState(kCGEventSourceStateHIDSystemState, vk) ? 1 : 0;
 }
 
+/*!
+    @function CapsLockState
+    @abstract Retrieves the current state of Caps Lock.
+    @return
+        1: On | 0: Off
+*/
+int CapsLockState(void) {
+  CGEventFlags flags =
+      CGEventSourceFlagsState(kCGEventSourceStateHIDSystemState);
+  return (flags & kCGEventFlagMaskAlphaShift) ? 1 : 0;
+}
+
+/*!
+    @function SetCapsLockState
+    @abstract Turns Caps Lock on or off through the HID system, since posting
+        Caps Lock key events does not toggle it.
+    @param on
+        1: Turn Caps Lock on | 0: Turn Caps Lock off
+    @return
+        1: Success | 0: Failure
+    @var LastErrorMessage
+        The last error message is populated if the call fails.
+*/
+int SetCapsLockState(int on) {
+  io_service_t service = IOServiceGetMatchingService(
+      MACH_PORT_NULL, IOServiceMatching(kIOHIDSystemClass));
+  if (!service) {
+    set_LastErrorMessage("SetCapsLockState(on=%s)", on ? "true" : "false");
+    return 0;
+  }
+
+  io_connect_t connect;
+  kern_return_t kr =
+      IOServiceOpen(service, mach_task_self(), kIOHIDParamConnectType, &connect);
+  IOObjectRelease(service);
+  if (kr != KERN_SUCCESS) {
+    set_LastErrorMessage("SetCapsLockState(on=%s)", on ? "true" : "false");
+    return 0;
+  }
+
+  kr = IOHIDSetModifierLockState(connect, kIOHIDCapsLockState, on != 0);
+  IOServiceClose(connect);
+  if (kr != KERN_SUCCESS) {
+    set_LastErrorMessage("SetCapsLockState(on=%s)", on ? "true" : "false");
+    return 0;
+  }
+
+  return 1;
+}
+
 /*!
     @function KeyPress
     @abstract Posts a key press event to the system.
@@ -323,114 +349,34 @@ int KeyTap(CGKeyCode vk, CGEventFlags flags, int keyPressDur) {
 }
 
 /*!
-    @function SetMods
-    @abstract Sets a modifier's physical state and event flags.
-    @param flags
-        The modifier event flags to post with the virtual key.
-    @param mods
-        The modifier mask to set state and flags for.
-    @param modsNext
-        The next modifier key to set state and flags for.
-    @param keyDown
-        Specifies a key-down event.
-    @return
-        1: True | 0: False
-*/
-int SetMods(CGEventFlags *flags, UInt32 mods, UInt32 modsNext, bool keyDown) {
-  int counter = 0;
-
-  for (int i = 0; i < 2; i++) {
-    Modifier m = StandardMods[i];
-
-    if ((mods & m.mask) != 0) {
-      *flags |= m.flag;
-
-      if (!keyDown) {
-        if ((modsNext & m.mask) == 0) {
-          KeyRelease(m.vk, 0);
-          counter++;
-        }
-      } else {
-        if (!KeyIsDown(m.vk)) {
-          KeyPress(m.vk, *flags);
-          counter++;
-        }
-      }
-    }
-  }
-
-  return counter;
-}
-
-/*!
-    @function TypeStr
-    @abstract Types the provided string.
-    @param str
-        The string to type.
-    @param modPressDur
-        How long to keep a modifier key pressed before releasing.
-    @param keyPressDur
-        How long to keep a key pressed before releasing.
-    @param keyDelay
-        How long to wait after releasing a key before pressing the next key.
+    @function TypeUnicode
+    @abstract Types UTF-16 characters without a matching virtual key.
+    @param chars
+        The UTF-16 code units to attach to the key events.
+    @param length
+        The number of code units in chars.
     @return
         1: Success | 0: Failure
+    @var LastErrorMessage
+        The last error message is populated if the call fails.
 */
-int TypeStr(const char *str, int modPressDur, int keyPressDur, int keyDelay,
-            int tabsToSpaces, int tabSize) {
-  int len = strlen(str);
-  int last = len - 1;
-  int errCount = 0;
-  KeyboardLayoutInfo kli = GetKeyboardLayoutInfo();
-  KeyTranslation current, next;
-  usleep(keyDelay);
-
-  current = TranslateChar(str[0], kli);
-
-  for (size_t i = 0; i < len; i++) {
-    if (AbortFlag) {
-      AbortFlag = 0;
-      set_LastErrorMessage("Operation aborted");
+int TypeUnicode(const UniChar *chars, int length) {
+  for (int i = 0; i < 2; i++) {
+    bool keyDown = i == 0;
+    CGEventRef event = CGEventCreateKeyboardEvent(NULL, 0, keyDown);
+    if (!event) {
+      set_LastErrorMessage("TypeUnicode(length=%d, keyDown=%s)", length,
+                           keyDown ? "true" : "false");
       return 0;
     }
 
-    UniChar c = str[i];
-    CGEventFlags flags = 0;
-
-    if (SetMods(&flags, current.mods, 0, true))
-      usleep(modPressDur);
-
-    int numTaps = 1;
-
-    if (c == '\t' && tabsToSpaces) {
-      current.vk = kVK_Space;
-      numTaps = tabSize;
-    }
-
-    for (int j = 0; j < numTaps; j++)
-      if (!KeyTap(current.vk, flags, keyPressDur))
-        errCount++;
-
-    if (i < last)
-      next = TranslateChar(str[i + 1], kli);
-
-    SetMods(&flags, current.mods, next.mods, false);
-
-    if (i < last) {
-      current = next;
-      usleep(keyDelay);
-    }
+    CGEventKeyboardSetUnicodeString(event, length, chars);
+    CGEventSetFlags(event, 0);
+    CGEventPost(kCGHIDEventTap, event);
+    CFRelease(event);
   }
 
-  if (!errCount)
-    return 1;
-
-  set_LastErrorMessage("TypeStr(*str=%.100s, modPressDur=%d, keyPressDur=%d,"
-                       "keyDelay=%d, tabsToSpaces=%d, tabSize=%d)",
-                       str, modPressDur, keyPressDur, keyDelay, tabsToSpaces,
-                       tabSize);
-
-  return 0;
+  return 1;
 }
 
 #endif
@@ -13,6 +13,24 @@ import (
 )
 
 var enabled = map[string]bool{
+	"Backend":               true,
+	"Recorder":              true,
+	"Typer":                 true,
+	"Combo":                 true,
+	"Script":                true,
+	"Strategy":              true,
+	"Grapheme":              true,
+	"Layout":                true,
+	"XKB":                   true,
+	"Watcher":               true,
+	"Rhythm":                true,
+	"Typo":                  true,
+	"Pause":                 true,
+	"Observer":              true,
+	"Release":               true,
+	"Mods":                  true,
+	"Lock":                  true,
+	"Preflight":             true,
 	"GetKeyboardLayoutInfo": true,
 	"RuneToVK":              true,
 	"KeyIsDown":             true,
@@ -78,6 +96,25 @@ func TestRuneToVK(t *testing.T) {
 	}
 }
 
+func TestKeymap(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	l := keybd.Keymap(kli)
+	if got := keybd.Keymap(kli); got != l {
+		t.Errorf(test.ErrWantFGotF, "cached keymap", "rebuilt keymap")
+	}
+
+	keymap := l.ReverseKeymap()
+	for _, r := range []rune{testRunes["lower"], testRunes["upper"], ' ', '\n', '\t'} {
+		if _, ok := keymap[r]; !ok {
+			t.Errorf(test.ErrWantFGotF, r, "no keystroke")
+		}
+	}
+}
+
 func TestRealKeyPress_KeyRelease(t *testing.T) {
 	tName := "KeyPress|KeyRelease"
 	if !enabled[tName] {
@@ -0,0 +1,238 @@
+package keybd
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Constants for the Grapheme_Cluster_Break property values that segmentation
+// tells apart.
+//
+// See: https://www.unicode.org/reports/tr29/#Grapheme_Cluster_Break_Property_Values
+const (
+	gcbOther = iota
+	gcbCR
+	gcbLF
+	gcbControl
+	gcbExtend
+	gcbZWJ
+	gcbRegionalIndicator
+	gcbPrepend
+	gcbSpacingMark
+	gcbL
+	gcbV
+	gcbT
+	gcbLV
+	gcbLVT
+)
+
+// prependRunes is the Prepend class, which joins the rune that follows it.
+var prependRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x0600, Hi: 0x0605, Stride: 1},
+		{Lo: 0x06DD, Hi: 0x06DD, Stride: 1},
+		{Lo: 0x070F, Hi: 0x070F, Stride: 1},
+		{Lo: 0x0890, Hi: 0x0891, Stride: 1},
+		{Lo: 0x08E2, Hi: 0x08E2, Stride: 1},
+		{Lo: 0x0D4E, Hi: 0x0D4E, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x110BD, Hi: 0x110BD, Stride: 1},
+		{Lo: 0x110CD, Hi: 0x110CD, Stride: 1},
+		{Lo: 0x111C2, Hi: 0x111C3, Stride: 1},
+	},
+}
+
+// pictographicRunes approximates the Extended_Pictographic property, which
+// starts emoji ZWJ sequences.
+var pictographicRunes = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x00A9, Hi: 0x00A9, Stride: 1},
+		{Lo: 0x00AE, Hi: 0x00AE, Stride: 1},
+		{Lo: 0x203C, Hi: 0x203C, Stride: 1},
+		{Lo: 0x2049, Hi: 0x2049, Stride: 1},
+		{Lo: 0x2122, Hi: 0x2122, Stride: 1},
+		{Lo: 0x2139, Hi: 0x2139, Stride: 1},
+		{Lo: 0x2194, Hi: 0x21AA, Stride: 1},
+		{Lo: 0x231A, Hi: 0x23FF, Stride: 1},
+		{Lo: 0x24C2, Hi: 0x24C2, Stride: 1},
+		{Lo: 0x25AA, Hi: 0x25FE, Stride: 1},
+		{Lo: 0x2600, Hi: 0x27BF, Stride: 1},
+		{Lo: 0x2934, Hi: 0x2935, Stride: 1},
+		{Lo: 0x2B05, Hi: 0x2B55, Stride: 1},
+		{Lo: 0x3030, Hi: 0x3030, Stride: 1},
+		{Lo: 0x303D, Hi: 0x303D, Stride: 1},
+		{Lo: 0x3297, Hi: 0x3297, Stride: 1},
+		{Lo: 0x3299, Hi: 0x3299, Stride: 1},
+	},
+	R32: []unicode.Range32{
+		{Lo: 0x1F000, Hi: 0x1F0FF, Stride: 1},
+		{Lo: 0x1F10D, Hi: 0x1F10F, Stride: 1},
+		{Lo: 0x1F12F, Hi: 0x1F12F, Stride: 1},
+		{Lo: 0x1F16C, Hi: 0x1F171, Stride: 1},
+		{Lo: 0x1F17E, Hi: 0x1F17F, Stride: 1},
+		{Lo: 0x1F18E, Hi: 0x1F18E, Stride: 1},
+		{Lo: 0x1F191, Hi: 0x1F19A, Stride: 1},
+		{Lo: 0x1F1AD, Hi: 0x1F1E5, Stride: 1},
+		{Lo: 0x1F201, Hi: 0x1F3FA, Stride: 1},
+		{Lo: 0x1F400, Hi: 0x1F64F, Stride: 1},
+		{Lo: 0x1F680, Hi: 0x1F6FF, Stride: 1},
+		{Lo: 0x1F774, Hi: 0x1F77F, Stride: 1},
+		{Lo: 0x1F7D5, Hi: 0x1F7FF, Stride: 1},
+		{Lo: 0x1F80C, Hi: 0x1F80F, Stride: 1},
+		{Lo: 0x1F848, Hi: 0x1F84F, Stride: 1},
+		{Lo: 0x1F85A, Hi: 0x1F85F, Stride: 1},
+		{Lo: 0x1F888, Hi: 0x1F88F, Stride: 1},
+		{Lo: 0x1F8AE, Hi: 0x1F8FF, Stride: 1},
+		{Lo: 0x1F90C, Hi: 0x1F93A, Stride: 1},
+		{Lo: 0x1F93C, Hi: 0x1F945, Stride: 1},
+		{Lo: 0x1F947, Hi: 0x1FAFF, Stride: 1},
+		{Lo: 0x1FC00, Hi: 0x1FFFD, Stride: 1},
+	},
+}
+
+// Graphemes splits str into its grapheme clusters, the user-perceived
+// characters such as "é" written as 'e' and a combining acute accent, a flag
+// made of two regional indicators, or an emoji ZWJ sequence. The clusters
+// follow the extended grapheme cluster rules of Unicode Standard Annex #29.
+func Graphemes(str string) []string {
+	var clusters []string
+	for len(str) > 0 {
+		n := graphemeLen(str)
+		clusters = append(clusters, str[:n])
+		str = str[n:]
+	}
+
+	return clusters
+}
+
+// GraphemeCount returns the number of grapheme clusters in str, which is the
+// number of characters that the limits of [Typer] and [TypeString] count.
+func GraphemeCount(str string) int {
+	var count int
+	for len(str) > 0 {
+		str = str[graphemeLen(str):]
+		count++
+	}
+
+	return count
+}
+
+// graphemeLen returns the length in bytes of the first grapheme cluster of
+// str.
+func graphemeLen(str string) int {
+	r, n := utf8.DecodeRuneInString(str)
+	prev := graphemeBreak(r)
+
+	// emoji is true while the cluster ends with Extended_Pictographic Extend*,
+	// and emojiZWJ is true right after such a sequence is followed by a ZWJ.
+	emoji := unicode.Is(pictographicRunes, r)
+	emojiZWJ := false
+
+	// regional counts the regional indicators that the cluster ends with.
+	var regional int
+	if prev == gcbRegionalIndicator {
+		regional = 1
+	}
+
+	for n < len(str) {
+		r, size := utf8.DecodeRuneInString(str[n:])
+		cur := graphemeBreak(r)
+		pict := unicode.Is(pictographicRunes, r)
+
+		if !graphemeJoins(prev, cur, pict, emojiZWJ, regional) {
+			break
+		}
+
+		switch {
+		case pict:
+			emoji, emojiZWJ = true, false
+		case cur == gcbExtend:
+			emojiZWJ = false
+		case cur == gcbZWJ:
+			emoji, emojiZWJ = false, emoji
+		default:
+			emoji, emojiZWJ = false, false
+		}
+
+		if cur == gcbRegionalIndicator {
+			regional++
+		} else {
+			regional = 0
+		}
+
+		prev = cur
+		n += size
+	}
+
+	return n
+}
+
+// graphemeJoins reports whether there is no grapheme cluster boundary between
+// a rune of class prev and a rune of class cur. pict reports whether the rune
+// of class cur is pictographic, emojiZWJ whether the cluster ends with an
+// emoji and a ZWJ, and regional how many regional indicators the cluster ends
+// with.
+func graphemeJoins(prev, cur int, pict, emojiZWJ bool, regional int) bool {
+	switch {
+	case prev == gcbCR && cur == gcbLF: // GB3
+		return true
+	case prev == gcbCR || prev == gcbLF || prev == gcbControl: // GB4
+		return false
+	case cur == gcbCR || cur == gcbLF || cur == gcbControl: // GB5
+		return false
+	case prev == gcbL: // GB6
+		return cur == gcbL || cur == gcbV || cur == gcbLV || cur == gcbLVT
+	case (prev == gcbLV || prev == gcbV) && (cur == gcbV || cur == gcbT): // GB7
+		return true
+	case (prev == gcbLVT || prev == gcbT) && cur == gcbT: // GB8
+		return true
+	case cur == gcbExtend || cur == gcbZWJ || cur == gcbSpacingMark: // GB9, GB9a
+		return true
+	case prev == gcbPrepend: // GB9b
+		return true
+	case prev == gcbZWJ && pict && emojiZWJ: // GB11
+		return true
+	case prev == gcbRegionalIndicator && cur == gcbRegionalIndicator: // GB12, GB13
+		return regional%2 == 1
+	}
+
+	return false // GB999
+}
+
+// graphemeBreak returns the Grapheme_Cluster_Break class of r.
+func graphemeBreak(r rune) int {
+	switch {
+	case r == '\r':
+		return gcbCR
+	case r == '\n':
+		return gcbLF
+	case r == 0x200D:
+		return gcbZWJ
+	case r == 0x200C, r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F:
+		return gcbExtend
+	case r >= 0x1F1E6 && r <= 0x1F1FF:
+		return gcbRegionalIndicator
+	case r >= 0x1100 && r <= 0x115F, r >= 0xA960 && r <= 0xA97C:
+		return gcbL
+	case r >= 0x1160 && r <= 0x11A7, r >= 0xD7B0 && r <= 0xD7C6:
+		return gcbV
+	case r >= 0x11A8 && r <= 0x11FF, r >= 0xD7CB && r <= 0xD7FB:
+		return gcbT
+	case r >= 0xAC00 && r <= 0xD7A3:
+		if (r-0xAC00)%28 == 0 {
+			return gcbLV
+		}
+		return gcbLVT
+	case unicode.Is(prependRunes, r):
+		return gcbPrepend
+	case unicode.In(r, unicode.Mn, unicode.Me):
+		return gcbExtend
+	case unicode.Is(unicode.Mc, r):
+		return gcbSpacingMark
+	case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Zl, unicode.Zp):
+		return gcbControl
+	}
+
+	return gcbOther
+}
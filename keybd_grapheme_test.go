@@ -0,0 +1,116 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestGraphemes(t *testing.T) {
+	tName := "Grapheme"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	var scenes []test.Scene
+	for _, name := range []string{"shortWord", "complexWord", "shortSentence", "multiLineStringWithTabs"} {
+		str := testStrings[name]
+		scenes = append(scenes, test.Scene{Input: str, Output: strings.Split(str, "")})
+	}
+	for _, name := range []string{
+		"combiningAccents", "greek", "japanese", "hangulSyllables", "hangulJamo", "arabicPrepend",
+		"crlf", "flags", "skinTone", "keycap", "zwjSequence", "tagSequence", "brokenZWJ",
+	} {
+		clusters := testGraphemes[name]
+		scenes = append(scenes, test.Scene{Input: strings.Join(clusters, ""), Output: clusters})
+	}
+	scenes = append(scenes, test.Scene{Input: "", Output: []string(nil)})
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			str, want := s.Input.(string), s.Output.([]string)
+			if got := keybd.Graphemes(str); !reflect.DeepEqual(got, want) {
+				t.Errorf(test.ErrWantFGotF, fmt.Sprintf("%q", want), fmt.Sprintf("%q", got))
+			}
+			if got := keybd.GraphemeCount(str); got != len(want) {
+				t.Errorf(test.ErrWantFGotF, len(want), got)
+			}
+		})
+	}
+}
+
+func TestTyperMaxCharacters(t *testing.T) {
+	tName := "Grapheme"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	str := strings.Join(testGraphemes["zwjSequence"], "") + strings.Join(testGraphemes["combiningAccents"], "")
+	n := keybd.GraphemeCount(str)
+
+	scenes := []test.Scene{
+		{Input: n, Passing: true},
+		{Input: n - 1, Passing: false},
+		{Input: utf8.RuneCountInString(str) - 1, Passing: true},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			u := &unicodeTyper{Recorder: keybd.NewRecorder()}
+			typer := keybd.NewTyper(keybd.WithBackend(u), keybd.WithKeyDelay(0), keybd.WithMaxCharacters(s.Input.(int)))
+
+			err := typer.Type(context.Background(), str)
+			if s.Passing && err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			} else if !s.Passing && !errors.Is(err, keybd.ErrMaxCharacter) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrMaxCharacter, err)
+			}
+		})
+	}
+}
+
+func TestTyperGraphemeAbort(t *testing.T) {
+	tName := "Grapheme"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	u := &unicodeTyper{Recorder: keybd.NewRecorder()}
+	typer := keybd.NewTyper(
+		keybd.WithBackend(u),
+		keybd.WithKeyDelay(0),
+		keybd.WithStrategyReport(func(i int, p keybd.RunePlan) {
+			if i == 1 {
+				cancel()
+			}
+		}),
+	)
+
+	// The accent is planned right after 'e' is typed, which cancels ctx, yet it
+	// is still typed because it belongs to the same grapheme cluster.
+	if err := typer.Type(ctx, "éx"); !errors.Is(err, keybd.ErrAborted) {
+		t.Fatalf(test.ErrWantFGotF, keybd.ErrAborted, err)
+	}
+
+	// Typing again waits for the aborted call to stop.
+	if err := typer.Type(context.Background(), "!"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if err := u.EqualText("e!"); err != nil {
+		t.Error(err)
+	}
+	if want := []rune{'\u0301'}; !reflect.DeepEqual(u.typed, want) {
+		t.Errorf(test.ErrWantFGotF, want, u.typed)
+	}
+}
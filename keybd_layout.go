@@ -0,0 +1,272 @@
+package keybd
+
+import (
+	"fmt"
+	"maps"
+	"math/bits"
+	"sync"
+)
+
+// deadMarks maps the spacing accents that dead keys type when followed by a
+// space to the combining marks they apply to the next letter. The ASCII quotes
+// are the dead acute and diaeresis keys of US-International layouts.
+var deadMarks = map[rune]rune{
+	'`':  0x0300,
+	'´':  0x0301,
+	'\'': 0x0301,
+	'^':  0x0302,
+	'~':  0x0303,
+	'¯':  0x0304,
+	'˘':  0x0306,
+	'˙':  0x0307,
+	'¨':  0x0308,
+	'"':  0x0308,
+	'˚':  0x030A,
+	'°':  0x030A,
+	'˝':  0x030B,
+	'ˇ':  0x030C,
+	'¸':  0x0327,
+	'˛':  0x0328,
+}
+
+// accented lists the precomposed letters per combining mark as pairs of a
+// base letter followed by the letter with the mark applied.
+var accented = map[rune]string{
+	0x0300: "AÀEÈIÌNǸOÒUÙWẀYỲaàeèiìnǹoòuùwẁyỳ",
+	0x0301: "AÁCĆEÉGǴIÍKḰLĹMḾNŃOÓPṔRŔSŚUÚWẂYÝZŹaácćeégǵiíkḱlĺmḿnńoópṕrŕsśuúwẃyýzź",
+	0x0302: "AÂCĈEÊGĜHĤIÎJĴOÔSŜUÛWŴYŶZẐaâcĉeêgĝhĥiîjĵoôsŝuûwŵyŷzẑ",
+	0x0303: "AÃEẼIĨNÑOÕUŨVṼYỸaãeẽiĩnñoõuũvṽyỹ",
+	0x0304: "AĀEĒGḠIĪOŌUŪYȲaāeēgḡiīoōuūyȳ",
+	0x0306: "AĂEĔGĞIĬOŎUŬaăeĕgğiĭoŏuŭ",
+	0x0307: "AȦBḂCĊDḊEĖFḞGĠHḢIİMṀNṄOȮPṖRṘSṠTṪWẆXẊYẎZŻaȧbḃcċdḋeėfḟgġhḣmṁnṅoȯpṗrṙsṡtṫwẇxẋyẏzż",
+	0x0308: "AÄEËHḦIÏOÖUÜWẄXẌYŸaäeëhḧiïoötẗuüwẅxẍyÿ",
+	0x030A: "AÅUŮaåuůwẘyẙ",
+	0x030B: "OŐUŰoőuű",
+	0x030C: "AǍCČDĎEĚGǦHȞIǏKǨLĽNŇOǑRŘSŠTŤUǓZŽaǎcčdďeěgǧhȟiǐjǰkǩlľnňoǒrřsštťuǔzž",
+	0x0327: "CÇDḐEȨGĢHḨKĶLĻNŅRŖSŞTŢcçdḑeȩgģhḩkķlļnņrŗsştţ",
+	0x0328: "AĄEĘIĮOǪUŲaąeęiįoǫuų",
+}
+
+// decomposed maps the precomposed letters of accented to their base letter
+// and combining mark.
+var decomposed = map[rune][2]rune{}
+
+// A Layout is a struct that describes a keyboard layout: the runes its keys
+// type, its dead keys, and its Compose key. It plans the keystrokes of runes
+// that no key types directly, such as 'é' typed as a dead acute followed by
+// 'e'. A Layout must not be modified once it is used.
+type Layout struct {
+	Name string // name of the layout, such as "us" or "de"
+
+	// Keys maps keystrokes to the runes they type.
+	Keys map[Keystroke]rune
+
+	// DeadKeys maps the keystrokes of dead keys to the spacing accents they
+	// type when followed by a space, such as '^' or '¨'.
+	DeadKeys map[Keystroke]rune
+
+	// ComposeKey is the keystroke of the Compose key, which starts the
+	// sequences of Compose. A zero ComposeKey disables Compose sequences.
+	ComposeKey Keystroke
+
+	// Compose is the table of Compose sequences, or nil.
+	Compose *ComposeTable
+
+	once  sync.Once
+	runes map[rune]Keystroke // best keystroke per rune
+	marks map[rune]Keystroke // best dead key per combining mark
+}
+
+// RuneToKeystroke translates r to the keystroke of l that types it directly.
+// It returns a zero [Keystroke] with an error wrapping [ErrNoKeystroke] if no
+// key types r.
+func (l *Layout) RuneToKeystroke(r rune) (Keystroke, error) {
+	if r == '\r' {
+		return Keystroke{}, nil
+	}
+
+	l.once.Do(l.build)
+
+	ks, ok := l.runes[r]
+	if !ok {
+		return Keystroke{}, fmt.Errorf("%w: %q", ErrNoKeystroke, r)
+	}
+
+	return ks, nil
+}
+
+// ReverseKeymap returns a copy of the reverse keymap of l, the keystroke that
+// [Layout.RuneToKeystroke] translates each rune to.
+func (l *Layout) ReverseKeymap() map[rune]Keystroke {
+	l.once.Do(l.build)
+
+	return maps.Clone(l.runes)
+}
+
+// A LayoutKey is a struct that describes how a [Layout] types a rune: the
+// keystroke of a key, pressed after a dead key unless Dead is zero.
+type LayoutKey struct {
+	Keystroke
+	Dead Keystroke // keystroke of the dead key pressed first, or zero
+}
+
+// Lookup translates r to the key of l that types it, directly or after a dead
+// key, such as 'é' typed as a dead acute followed by 'e', or '^' typed as a
+// dead circumflex followed by a space. Unlike the translation of a backend, it
+// does not depend on the layout of the host.
+// It returns a zero [LayoutKey] with an error wrapping [ErrNoKeystroke] if no
+// key types r.
+func (l *Layout) Lookup(r rune) (LayoutKey, error) {
+	if ks, err := l.RuneToKeystroke(r); err == nil {
+		return LayoutKey{Keystroke: ks}, nil
+	}
+
+	dead, ks, ok := l.deadKeystrokes(r)
+	if !ok {
+		return LayoutKey{}, fmt.Errorf("%w: %q", ErrNoKeystroke, r)
+	}
+
+	return LayoutKey{Keystroke: ks, Dead: dead}, nil
+}
+
+// ComposeKeystrokes plans the keystrokes that type r on l without a key of
+// its own: a dead key followed by a base letter, a dead key followed by a
+// space for a spacing accent such as '^', or a Compose sequence made of keys
+// that l types directly. It implements [Composer] for backends that describe
+// their layout with a Layout.
+// It returns nil with an error wrapping [ErrNoKeystroke] if r cannot be
+// planned.
+func (l *Layout) ComposeKeystrokes(r rune) ([]Keystroke, error) {
+	if dead, ks, ok := l.deadKeystrokes(r); ok {
+		return []Keystroke{dead, ks}, nil
+	}
+
+	if l.Compose != nil && l.ComposeKey != (Keystroke{}) {
+	sequences:
+		for _, seq := range l.Compose.Sequences(r) {
+			keystrokes := []Keystroke{l.ComposeKey}
+			for _, c := range seq {
+				ks, ok := l.runes[c]
+				if !ok {
+					continue sequences
+				}
+				keystrokes = append(keystrokes, ks)
+			}
+			return keystrokes, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q: no dead key or compose sequence", ErrNoKeystroke, r)
+}
+
+// deadKeystrokes returns the dead key of l and the keystroke after it that
+// type r, a space for a spacing accent or a base letter for a decomposed rune.
+func (l *Layout) deadKeystrokes(r rune) (dead, ks Keystroke, ok bool) {
+	l.once.Do(l.build)
+
+	// A dead key followed by a space types its spacing accent.
+	if space, hasSpace := l.runes[' ']; hasSpace {
+		for k, accent := range l.DeadKeys {
+			if accent == r && (!ok || betterKeystroke(k, dead)) {
+				dead, ok = k, true
+			}
+		}
+		if ok {
+			return dead, space, true
+		}
+	}
+
+	if d, isDecomposed := decomposed[r]; isDecomposed {
+		base, hasBase := l.runes[d[0]]
+		dead, hasDead := l.marks[d[1]]
+		if hasBase && hasDead {
+			return dead, base, true
+		}
+	}
+
+	return Keystroke{}, Keystroke{}, false
+}
+
+// build fills in the reverse tables of l, preferring the keystrokes that need
+// the fewest modifiers.
+func (l *Layout) build() {
+	l.runes = make(map[rune]Keystroke, len(l.Keys))
+	for ks, r := range l.Keys {
+		if best, ok := l.runes[r]; !ok || betterKeystroke(ks, best) {
+			l.runes[r] = ks
+		}
+	}
+
+	l.marks = make(map[rune]Keystroke, len(l.DeadKeys))
+	for ks, accent := range l.DeadKeys {
+		mark, ok := deadMarks[accent]
+		if !ok {
+			continue
+		}
+		if best, ok := l.marks[mark]; !ok || betterKeystroke(ks, best) {
+			l.marks[mark] = ks
+		}
+	}
+}
+
+// A keymapCache is a struct that holds the [Layout] that build describes for
+// the keyboard layout last asked for, so that backends whose native API maps
+// keys to runes build their reverse keymap once per layout instead of
+// searching it for every rune. Asking for another layout replaces it.
+type keymapCache[K comparable] struct {
+	build func(K) *Layout
+
+	mu     sync.Mutex
+	key    K
+	layout *Layout
+}
+
+// get returns the layout described for key, building it unless it is cached.
+func (c *keymapCache[K]) get(key K) *Layout {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.layout == nil || c.key != key {
+		c.key, c.layout = key, c.build(key)
+	}
+
+	return c.layout
+}
+
+// current returns the layout built last, building it for the key returned by
+// key if there is none.
+func (c *keymapCache[K]) current(key func() K) *Layout {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.layout == nil {
+		c.key = key()
+		c.layout = c.build(c.key)
+	}
+
+	return c.layout
+}
+
+// betterKeystroke reports whether a needs fewer modifiers than b, breaking
+// ties by the modifier flags and then the key code so that the choice does not
+// depend on map order.
+func betterKeystroke(a, b Keystroke) bool {
+	na, nb := bits.OnesCount(uint(a.Mods)), bits.OnesCount(uint(b.Mods))
+	switch {
+	case na != nb:
+		return na < nb
+	case a.Mods != b.Mods:
+		return a.Mods < b.Mods
+	}
+
+	return a.Code < b.Code
+}
+
+func init() {
+	for mark, pairs := range accented {
+		letters := []rune(pairs)
+		for i := 0; i+1 < len(letters); i += 2 {
+			decomposed[letters[i+1]] = [2]rune{letters[i], mark}
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+const testCompose = `# Compose sequences
+include "%L"
+
+<Multi_key> <o> <c>		: "©"	copyright # COPYRIGHT SIGN
+<Multi_key> <exclam> <exclam>	: "¡"	exclamdown
+<Multi_key> <a> <e>		: "æ"	ae
+<Multi_key> <o> <o> <a> <e>	: "æ"
+<Multi_key> <U2665> <a>		: "♥"
+<Multi_key> <c> <comma>		: "ç"	ccedilla
+<dead_acute> <e>		: "é"	eacute
+<Multi_key> <minus> <minus> <minus>	: "\342\200\224"	emdash
+<Multi_key> <l> <v>		: "|\x7C"
+`
+
+// newTestLayout returns a layout resembling US-International, whose quote,
+// grave, and caret keys are dead keys.
+func newTestLayout(t *testing.T) *keybd.Layout {
+	t.Helper()
+
+	compose, err := keybd.ParseCompose(strings.NewReader(testCompose))
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	return &keybd.Layout{
+		Name: "us-intl",
+		Keys: map[keybd.Keystroke]rune{
+			{Code: keybd.KEY_A}:                         'a',
+			{Code: keybd.KEY_A, Mods: keybd.ModShift}:   'A',
+			{Code: keybd.KEY_C}:                         'c',
+			{Code: keybd.KEY_E}:                         'e',
+			{Code: keybd.KEY_N}:                         'n',
+			{Code: keybd.KEY_O}:                         'o',
+			{Code: keybd.KEY_U}:                         'u',
+			{Code: keybd.KEY_SPACE}:                     ' ',
+			{Code: keybd.KEY_1, Mods: keybd.ModShift}:   '!',
+			{Code: keybd.KEY_1, Mods: keybd.ModAltGr}:   '¡',
+			{Code: keybd.KEY_MINUS}:                     '-',
+			{Code: keybd.KEY_N, Mods: keybd.ModAltGr}:   'ñ',
+			{Code: keybd.KEY_N, Mods: keybd.ModCtrl}:    'ñ',
+			{Code: keybd.KEY_E, Mods: keybd.ModAltGr}:   'é',
+			{Code: keybd.KEY_Z, Mods: keybd.ModAltGr}:   'æ',
+			{Code: keybd.KEY_Z, Mods: keybd.ModMeta}:    'æ',
+			{Code: keybd.KEY_DOT, Mods: keybd.ModAltGr}: '.',
+		},
+		DeadKeys: map[keybd.Keystroke]rune{
+			{Code: keybd.KEY_APOSTROPHE}:                       '\'',
+			{Code: keybd.KEY_APOSTROPHE, Mods: keybd.ModShift}: '"',
+			{Code: keybd.KEY_GRAVE}:                            '`',
+			{Code: keybd.KEY_GRAVE, Mods: keybd.ModShift}:      '~',
+			{Code: keybd.KEY_6, Mods: keybd.ModShift}:          '^',
+		},
+		ComposeKey: keybd.Keystroke{Code: keybd.KEY_COMPOSE},
+		Compose:    compose,
+	}
+}
+
+func TestLayoutRuneToKeystroke(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	l := newTestLayout(t)
+
+	scenes := []test.Scene{
+		{Input: 'a', Output: keybd.Keystroke{Code: keybd.KEY_A}, Passing: true},
+		{Input: 'A', Output: keybd.Keystroke{Code: keybd.KEY_A, Mods: keybd.ModShift}, Passing: true},
+		{Input: 'ñ', Output: keybd.Keystroke{Code: keybd.KEY_N, Mods: keybd.ModCtrl}, Passing: true},
+		{Input: 'æ', Output: keybd.Keystroke{Code: keybd.KEY_Z, Mods: keybd.ModMeta}, Passing: true},
+		{Input: '\r', Output: keybd.Keystroke{}, Passing: true},
+		{Input: 'ô', Output: keybd.Keystroke{}, Passing: false},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			got, err := l.RuneToKeystroke(s.Input.(rune))
+			if s.Passing && err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			} else if !s.Passing && !errors.Is(err, keybd.ErrNoKeystroke) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
+			}
+			if want := s.Output.(keybd.Keystroke); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestLayoutComposeKeystrokes(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	l := newTestLayout(t)
+
+	var (
+		acute     = keybd.Keystroke{Code: keybd.KEY_APOSTROPHE}
+		grave     = keybd.Keystroke{Code: keybd.KEY_GRAVE}
+		tilde     = keybd.Keystroke{Code: keybd.KEY_GRAVE, Mods: keybd.ModShift}
+		caret     = keybd.Keystroke{Code: keybd.KEY_6, Mods: keybd.ModShift}
+		diaeresis = keybd.Keystroke{Code: keybd.KEY_APOSTROPHE, Mods: keybd.ModShift}
+		compose   = keybd.Keystroke{Code: keybd.KEY_COMPOSE}
+		space     = keybd.Keystroke{Code: keybd.KEY_SPACE}
+	)
+
+	scenes := []test.Scene{
+		{Input: 'é', Output: []keybd.Keystroke{acute, {Code: keybd.KEY_E}}, Passing: true},
+		{Input: 'Á', Output: []keybd.Keystroke{acute, {Code: keybd.KEY_A, Mods: keybd.ModShift}}, Passing: true},
+		{Input: 'ù', Output: []keybd.Keystroke{grave, {Code: keybd.KEY_U}}, Passing: true},
+		{Input: 'Ã', Output: []keybd.Keystroke{tilde, {Code: keybd.KEY_A, Mods: keybd.ModShift}}, Passing: true},
+		{Input: 'ô', Output: []keybd.Keystroke{caret, {Code: keybd.KEY_O}}, Passing: true},
+		{Input: 'ü', Output: []keybd.Keystroke{diaeresis, {Code: keybd.KEY_U}}, Passing: true},
+		{Input: 'ñ', Output: []keybd.Keystroke{tilde, {Code: keybd.KEY_N}}, Passing: true},
+		{Input: '\'', Output: []keybd.Keystroke{acute, space}, Passing: true},
+		{Input: '~', Output: []keybd.Keystroke{tilde, space}, Passing: true},
+		{Input: '^', Output: []keybd.Keystroke{caret, space}, Passing: true},
+		{Input: '©', Output: []keybd.Keystroke{compose, {Code: keybd.KEY_O}, {Code: keybd.KEY_C}}, Passing: true},
+		{Input: '¡', Output: []keybd.Keystroke{compose, {Code: keybd.KEY_1, Mods: keybd.ModShift}, {Code: keybd.KEY_1, Mods: keybd.ModShift}}, Passing: true},
+		{Input: 'æ', Output: []keybd.Keystroke{compose, {Code: keybd.KEY_A}, {Code: keybd.KEY_E}}, Passing: true},
+		{Input: '—', Output: []keybd.Keystroke{compose, {Code: keybd.KEY_MINUS}, {Code: keybd.KEY_MINUS}, {Code: keybd.KEY_MINUS}}, Passing: true},
+		{Input: 'ç', Output: []keybd.Keystroke(nil), Passing: false},
+		{Input: 'ő', Output: []keybd.Keystroke(nil), Passing: false},
+		{Input: '♥', Output: []keybd.Keystroke(nil), Passing: false},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			got, err := l.ComposeKeystrokes(s.Input.(rune))
+			if s.Passing && err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			} else if !s.Passing && !errors.Is(err, keybd.ErrNoKeystroke) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
+			}
+			if want := s.Output.([]keybd.Keystroke); !reflect.DeepEqual(got, want) {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestParseCompose(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	c, err := keybd.ParseCompose(strings.NewReader(testCompose))
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if got, want := c.Len(), 6; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := c.Sequences('æ'), [][]rune{{'a', 'e'}, {'o', 'o', 'a', 'e'}}; !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := c.Sequences('♥'), [][]rune{{'♥', 'a'}}; !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got := c.Sequences('é'); got != nil {
+		t.Errorf(test.ErrWantFGotF, nil, got)
+	}
+
+	scenes := []test.Scene{
+		{Input: `<Multi_key> <a> "x"`, Output: 1},
+		{Input: "\n<Multi_key> a : \"x\"", Output: 2},
+		{Input: `<Multi_key> <a> : "x`, Output: 1},
+		{Input: `<Multi_key> <a> :`, Output: 1},
+		{Input: "# ok\n\ninclude %L", Output: 3},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			_, err := keybd.ParseCompose(strings.NewReader(s.Input.(string)))
+			if !errors.Is(err, keybd.ErrInvalidCompose) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrInvalidCompose, err)
+			}
+			if want := fmt.Sprintf("line %d:", s.Output.(int)); !strings.Contains(err.Error(), want) {
+				t.Errorf(test.ErrWantFGotF, want, err)
+			}
+		})
+	}
+}
+
+// layoutRecorder is a recorder that composes runes with a layout.
+type layoutRecorder struct {
+	*keybd.Recorder
+	layout *keybd.Layout
+}
+
+func (b layoutRecorder) ComposeKeystrokes(r rune) ([]keybd.Keystroke, error) {
+	return b.layout.ComposeKeystrokes(r)
+}
+
+func TestTyperLayout(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	typer := keybd.NewTyper(keybd.WithBackend(layoutRecorder{rec, newTestLayout(t)}), keybd.WithKeyDelay(0))
+
+	if err := typer.Type(context.Background(), "José Núñez"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	// The recorder decodes the keys with a US layout, which shows the dead keys
+	// as the characters printed on them.
+	if err := rec.EqualText("Jos'e N'u~nez"); err != nil {
+		t.Error(err)
+	}
+}
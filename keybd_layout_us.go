@@ -0,0 +1,40 @@
+package keybd
+
+import "fmt"
+
+// keymapUS maps the printable runes of a US QWERTY layout to a keystroke.
+var keymapUS = map[rune]Keystroke{}
+
+// textUS maps the keystrokes of a US QWERTY layout back to the runes they type.
+var textUS = map[Keystroke]rune{}
+
+// runeToKeystrokeUS translates r to a keystroke using a US QWERTY layout.
+// It returns a zero keystroke with an error if the translation fails.
+func runeToKeystrokeUS(r rune) (Keystroke, error) {
+	switch r {
+	case '\r':
+		return Keystroke{}, nil
+	case '\n':
+		return Keystroke{Code: KEY_ENTER}, nil
+	case '\t':
+		return Keystroke{Code: KEY_TAB}, nil
+	case ' ':
+		return Keystroke{Code: KEY_SPACE}, nil
+	}
+
+	ks, ok := keymapUS[r]
+	if !ok {
+		return Keystroke{}, fmt.Errorf("%w: %q", ErrNoKeystroke, r)
+	}
+
+	return ks, nil
+}
+
+func init() {
+	for ks, r := range layoutDB["us"].Keys {
+		textUS[ks] = r
+		if r > ' ' {
+			keymapUS[r] = ks
+		}
+	}
+}
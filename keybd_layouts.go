@@ -0,0 +1,208 @@
+package keybd
+
+import (
+	"fmt"
+	"slices"
+)
+
+// layoutRows are the key codes of the rows of the main block of a keyboard,
+// from the number row down. The rows include the keys of ISO and JIS
+// keyboards, KEY_102ND, KEY_YEN, and KEY_RO, which ANSI keyboards lack.
+var layoutRows = [4][]KeyCode{
+	{KEY_GRAVE, KEY_1, KEY_2, KEY_3, KEY_4, KEY_5, KEY_6, KEY_7, KEY_8, KEY_9, KEY_0, KEY_MINUS, KEY_EQUAL, KEY_YEN},
+	{KEY_Q, KEY_W, KEY_E, KEY_R, KEY_T, KEY_Y, KEY_U, KEY_I, KEY_O, KEY_P, KEY_LEFTBRACE, KEY_RIGHTBRACE},
+	{KEY_A, KEY_S, KEY_D, KEY_F, KEY_G, KEY_H, KEY_J, KEY_K, KEY_L, KEY_SEMICOLON, KEY_APOSTROPHE, KEY_BACKSLASH},
+	{KEY_102ND, KEY_Z, KEY_X, KEY_C, KEY_V, KEY_B, KEY_N, KEY_M, KEY_COMMA, KEY_DOT, KEY_SLASH, KEY_RO},
+}
+
+// layoutLevels are the modifiers of the levels of a layoutSpec.
+var layoutLevels = [4]Mods{0, ModShift, ModAltGr, ModAltGr | ModShift}
+
+// A layoutSpec describes a layout of the database by the runes that the keys
+// of layoutRows type at every level, a space standing for a key that types
+// nothing. The strings of a level may be shorter than their row.
+type layoutSpec struct {
+	name   string
+	levels [4][4]string
+	dead   []Keystroke // keystrokes whose runes are dead keys
+}
+
+// layoutSpecs are the layouts of the database, named after their usual XKB
+// or Windows names.
+var layoutSpecs = []layoutSpec{
+	{
+		name: "us",
+		levels: [4][4]string{
+			{"`1234567890-=", "qwertyuiop[]", "asdfghjkl;'\\", " zxcvbnm,./"},
+			{"~!@#$%^&*()_+", "QWERTYUIOP{}", "ASDFGHJKL:\"|", " ZXCVBNM<>?"},
+		},
+	},
+	{
+		name: "uk",
+		levels: [4][4]string{
+			{"`1234567890-=", "qwertyuiop[]", "asdfghjkl;'#", "\\zxcvbnm,./"},
+			{"¬!\"£$%^&*()_+", "QWERTYUIOP{}", "ASDFGHJKL:@~", "|ZXCVBNM<>?"},
+			{"¦   €", "  é   úíó", "á"},
+			{"", "  É   ÚÍÓ", "Á"},
+		},
+	},
+	{
+		name: "us-intl",
+		levels: [4][4]string{
+			{"`1234567890-=", "qwertyuiop[]", "asdfghjkl;'\\", "\\zxcvbnm,./"},
+			{"~!@#$%^&*()_+", "QWERTYUIOP{}", "ASDFGHJKL:\"|", "|ZXCVBNM<>?"},
+			{" ¡²³¤€¼½¾‘’¥×", "äåé®þüúíóö«»", "áßð     ø¶´¬", "\\æ ©  ñµç ¿"},
+			{" ¹  £       ÷", "ÄÅÉ ÞÜÚÍÓÖ“”", "Á§Ð     Ø°¨¦", "|Æ ¢  Ñ Ç"},
+		},
+		dead: []Keystroke{
+			{Code: KEY_GRAVE},
+			{Code: KEY_GRAVE, Mods: ModShift},
+			{Code: KEY_6, Mods: ModShift},
+			{Code: KEY_APOSTROPHE},
+			{Code: KEY_APOSTROPHE, Mods: ModShift},
+		},
+	},
+	{
+		name: "de",
+		levels: [4][4]string{
+			{"^1234567890ß´", "qwertzuiopü+", "asdfghjklöä#", "<yxcvbnm,.-"},
+			{"°!\"§$%&/()=?`", "QWERTZUIOPÜ*", "ASDFGHJKLÖÄ'", ">YXCVBNM;:_"},
+			{" ¹²³¼½¬{[]}\\", "@ €        ~", "", "|      µ"},
+		},
+		dead: []Keystroke{
+			{Code: KEY_GRAVE},
+			{Code: KEY_EQUAL},
+			{Code: KEY_EQUAL, Mods: ModShift},
+		},
+	},
+	{
+		name: "fr",
+		levels: [4][4]string{
+			{"²&é\"'(-è_çà)=", "azertyuiop^$", "qsdfghjklmù*", "<wxcvbn,;:!"},
+			{" 1234567890°+", "AZERTYUIOP¨£", "QSDFGHJKLM%µ", ">WXCVBN?./§"},
+			{"  ~#{[|`\\^@]}", "  €        ¤"},
+		},
+		dead: []Keystroke{
+			{Code: KEY_LEFTBRACE},
+			{Code: KEY_LEFTBRACE, Mods: ModShift},
+		},
+	},
+	{
+		name: "es",
+		levels: [4][4]string{
+			{"º1234567890'¡", "qwertyuiop`+", "asdfghjklñ´ç", "<zxcvbnm,.-"},
+			{"ª!\"·$%&/()=?¿", "QWERTYUIOP^*", "ASDFGHJKLÑ¨Ç", ">ZXCVBNM;:_"},
+			{"\\|@#~€¬", "  €       []", "          {}"},
+		},
+		dead: []Keystroke{
+			{Code: KEY_LEFTBRACE},
+			{Code: KEY_LEFTBRACE, Mods: ModShift},
+			{Code: KEY_APOSTROPHE},
+			{Code: KEY_APOSTROPHE, Mods: ModShift},
+		},
+	},
+	{
+		// Swedish and Finnish, which share their keys.
+		name: "nordic",
+		levels: [4][4]string{
+			{"§1234567890+´", "qwertyuiopå¨", "asdfghjklöä'", "<zxcvbnm,.-"},
+			{"½!\"#¤%&/()=?`", "QWERTYUIOPÅ^", "ASDFGHJKLÖÄ*", ">ZXCVBNM;:_"},
+			{"  @£$€ {[]}\\", "  €        ~", "", "|      µ"},
+		},
+		dead: []Keystroke{
+			{Code: KEY_EQUAL},
+			{Code: KEY_EQUAL, Mods: ModShift},
+			{Code: KEY_RIGHTBRACE},
+			{Code: KEY_RIGHTBRACE, Mods: ModShift},
+			{Code: KEY_RIGHTBRACE, Mods: ModAltGr},
+		},
+	},
+	{
+		name: "dvorak",
+		levels: [4][4]string{
+			{"`1234567890[]", "',.pyfgcrl/=", "aoeuidhtns-\\", " ;qjkxbmwvz"},
+			{"~!@#$%^&*(){}", "\"<>PYFGCRL?+", "AOEUIDHTNS_|", " :QJKXBMWVZ"},
+		},
+	},
+	{
+		name: "colemak",
+		levels: [4][4]string{
+			{"`1234567890-=", "qwfpgjluy;[]", "arstdhneio'\\", " zxcvbkm,./"},
+			{"~!@#$%^&*()_+", "QWFPGJLUY:{}", "ARSTDHNEIO\"|", " ZXCVBKM<>?"},
+		},
+	},
+	{
+		name: "jis",
+		levels: [4][4]string{
+			{" 1234567890-^\\", "qwertyuiop@[", "asdfghjkl;:]", " zxcvbnm,./\\"},
+			{" !\"#$%&'() =~|", "QWERTYUIOP`{", "ASDFGHJKL+*}", " ZXCVBNM<>?_"},
+		},
+	},
+}
+
+// layoutDB maps the names of layoutSpecs to their layouts.
+var layoutDB = buildLayouts(layoutSpecs)
+
+// Layouts returns the names of the layouts of the embedded database, sorted.
+func Layouts() []string {
+	names := make([]string, 0, len(layoutDB))
+	for name := range layoutDB {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// LayoutByName returns the layout of the embedded database named name, such
+// as "us", "de", or "fr". The layouts describe the keys of the main block, and
+// their keystrokes can be sent on any backend, so that text can be typed for a
+// layout other than the one of the host. The layout is shared and must not be
+// modified.
+// It returns nil with an error wrapping [ErrNoLayout] if no layout is named
+// name.
+func LayoutByName(name string) (*Layout, error) {
+	l, ok := layoutDB[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNoLayout, name)
+	}
+
+	return l, nil
+}
+
+// buildLayouts builds the layouts of specs.
+func buildLayouts(specs []layoutSpec) map[string]*Layout {
+	layouts := make(map[string]*Layout, len(specs))
+	for _, spec := range specs {
+		l := &Layout{
+			Name: spec.name,
+			Keys: map[Keystroke]rune{
+				{Code: KEY_ENTER}: '\n',
+				{Code: KEY_TAB}:   '\t',
+				{Code: KEY_SPACE}: ' ',
+			},
+			DeadKeys: make(map[Keystroke]rune, len(spec.dead)),
+		}
+
+		for level, rows := range spec.levels {
+			for row, text := range rows {
+				for i, r := range []rune(text) {
+					if r == ' ' {
+						continue
+					}
+
+					ks := Keystroke{Code: layoutRows[row][i], Mods: layoutLevels[level]}
+					if slices.Contains(spec.dead, ks) {
+						l.DeadKeys[ks] = r
+					} else {
+						l.Keys[ks] = r
+					}
+				}
+			}
+		}
+
+		layouts[spec.name] = l
+	}
+
+	return layouts
+}
@@ -0,0 +1,149 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestLayoutByName(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	names := keybd.Layouts()
+	for _, want := range []string{"us", "uk", "us-intl", "de", "fr", "es", "nordic", "dvorak", "colemak", "jis"} {
+		if !slices.Contains(names, want) {
+			t.Errorf(test.ErrWantFGotF, want, names)
+		}
+	}
+
+	// Every layout types the printable ASCII runes, directly or with a dead
+	// key followed by a space.
+	for _, name := range names {
+		l, err := keybd.LayoutByName(name)
+		if err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+		if l.Name != name {
+			t.Errorf(test.ErrWantFGotF, name, l.Name)
+		}
+		for r := rune(' '); r <= '~'; r++ {
+			if _, err := l.Lookup(r); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+
+	if _, err := keybd.LayoutByName("klingon"); !errors.Is(err, keybd.ErrNoLayout) {
+		t.Errorf(test.ErrWantFGotF, keybd.ErrNoLayout, err)
+	}
+}
+
+func TestLayoutLookup(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	space := keybd.Keystroke{Code: keybd.KEY_SPACE}
+
+	scenes := []test.Scene{
+		{Input: []any{"us", 'A'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_A, Mods: keybd.ModShift}}, Passing: true},
+		{Input: []any{"us", 'é'}, Output: keybd.LayoutKey{}, Passing: false},
+		{Input: []any{"de", 'z'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_Y}}, Passing: true},
+		{Input: []any{"de", '@'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_Q, Mods: keybd.ModAltGr}}, Passing: true},
+		{Input: []any{"de", 'é'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_E}, Dead: keybd.Keystroke{Code: keybd.KEY_EQUAL}}, Passing: true},
+		{Input: []any{"fr", 'Ê'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_E, Mods: keybd.ModShift}, Dead: keybd.Keystroke{Code: keybd.KEY_LEFTBRACE}}, Passing: true},
+		{Input: []any{"fr", '^'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_9, Mods: keybd.ModAltGr}}, Passing: true},
+		{Input: []any{"nordic", 'ñ'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_N}, Dead: keybd.Keystroke{Code: keybd.KEY_RIGHTBRACE, Mods: keybd.ModAltGr}}, Passing: true},
+		{Input: []any{"us-intl", '"'}, Output: keybd.LayoutKey{Keystroke: space, Dead: keybd.Keystroke{Code: keybd.KEY_APOSTROPHE, Mods: keybd.ModShift}}, Passing: true},
+		{Input: []any{"jis", '\\'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_RO}}, Passing: true},
+		{Input: []any{"dvorak", 'q'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_X}}, Passing: true},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.([]any)
+
+			l, err := keybd.LayoutByName(in[0].(string))
+			if err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+
+			got, err := l.Lookup(in[1].(rune))
+			if s.Passing && err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			} else if !s.Passing && !errors.Is(err, keybd.ErrNoKeystroke) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
+			}
+			if want := s.Output.(keybd.LayoutKey); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestLayoutReverseKeymap(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	de, err := keybd.LayoutByName("de")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	keymap := de.ReverseKeymap()
+	for r, want := range map[rune]keybd.Keystroke{
+		'z': {Code: keybd.KEY_Y},
+		'Z': {Code: keybd.KEY_Y, Mods: keybd.ModShift},
+		'@': {Code: keybd.KEY_Q, Mods: keybd.ModAltGr},
+		' ': {Code: keybd.KEY_SPACE},
+	} {
+		if got := keymap[r]; got != want {
+			t.Errorf(test.ErrWantFGotF, want, got)
+		}
+	}
+	if ks, ok := keymap['é']; ok {
+		t.Errorf(test.ErrWantFGotF, "no keystroke", ks)
+	}
+
+	// The table is a copy.
+	keymap['z'] = keybd.Keystroke{}
+	if got, _ := de.RuneToKeystroke('z'); got.Code != keybd.KEY_Y {
+		t.Errorf(test.ErrWantFGotF, keybd.KEY_Y, got.Code)
+	}
+}
+
+func TestTyperWithLayout(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	de, err := keybd.LayoutByName("de")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	rec := keybd.NewRecorder()
+	typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithLayout(de), keybd.WithKeyDelay(0))
+
+	if err := typer.Type(context.Background(), "Grüße, Zoé"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	// The recorder decodes the keys with a US layout, which shows the keys of
+	// the German layout as the US characters printed on them.
+	if err := rec.EqualText("Gr[-e, Yo=e"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,485 @@
+//go:build linux
+
+package keybd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants for input event types and codes.
+const (
+	EV_SYN     = 0x00
+	EV_KEY     = 0x01
+	SYN_REPORT = 0x00
+	KEY_MAX    = 0x2FF
+)
+
+// Constants for modifier key masks.
+const (
+	MOD_SHIFT = 1 << iota
+	MOD_CTRL
+	MOD_ALT
+	MOD_META
+	MOD_ALTGR
+	MOD_RIGHTSHIFT
+	MOD_RIGHTCTRL
+	MOD_RIGHTMETA
+)
+
+// Constants for uinput ioctl requests.
+//
+// See: https://github.com/torvalds/linux/blob/master/include/uapi/linux/uinput.h
+const (
+	uiDevCreate  = 0x5501
+	uiDevDestroy = 0x5502
+	uiDevSetup   = 0x405C5503
+	uiSetEvBit   = 0x40045564
+	uiSetKeyBit  = 0x40045565
+)
+
+// Uinput is a struct that contains specific settings for the virtual uinput
+// device used to synthesize key events.
+var Uinput struct {
+	// Path is the path of the uinput device node. Pointing this at anything
+	// other than a character device (such as a regular file or a FIFO) skips
+	// the device setup and simply writes the raw input event stream to it.
+	//
+	// Default: /dev/uinput
+	Path string
+
+	// Name is the name the virtual device registers itself with.
+	//
+	// Default: keybd
+	Name string
+
+	// SettleDuration is how long to wait after creating the virtual device so
+	// that the desktop environment can pick it up before the first key event.
+	//
+	// Default: 200 ms
+	SettleDuration time.Duration
+
+	// Layout is the layout that the desktop translates the key events of the
+	// virtual device with, which runes are translated to key codes with.
+	//
+	// Default: nil, the layout of [GetKeyboardLayoutInfo], detected on first
+	// use and refreshed whenever an [XKBLayoutSource] reports another one
+	Layout *Layout
+
+	// LEDPath is the directory of the LED class devices whose keyboard LEDs
+	// report the state of the lock keys, such as "input3::capslock".
+	//
+	// Default: /sys/class/leds
+	LEDPath string
+}
+
+// ledNames maps the lock flags onto the names of the keyboard LEDs that show
+// them.
+var ledNames = map[Locks]string{
+	LockCaps:   "capslock",
+	LockNum:    "numlock",
+	LockScroll: "scrolllock",
+}
+
+// StandardMods is a [Modifier] slice of the standard modifier keys, the left
+// keys before the right ones.
+var StandardMods = []Modifier{
+	{Mask: MOD_SHIFT, Code: KEY_LEFTSHIFT, Mods: ModShift},
+	{Mask: MOD_CTRL, Code: KEY_LEFTCTRL, Mods: ModCtrl},
+	{Mask: MOD_ALT, Code: KEY_LEFTALT, Mods: ModAlt},
+	{Mask: MOD_META, Code: KEY_LEFTMETA, Mods: ModMeta},
+	{Mask: MOD_ALTGR, Code: KEY_RIGHTALT, Mods: ModAltGr},
+	{Mask: MOD_RIGHTSHIFT, Code: KEY_RIGHTSHIFT, Mods: ModRightShift},
+	{Mask: MOD_RIGHTCTRL, Code: KEY_RIGHTCTRL, Mods: ModRightCtrl},
+	{Mask: MOD_RIGHTMETA, Code: KEY_RIGHTMETA, Mods: ModRightMeta},
+}
+
+// A Modifier is a struct that contains the mask, the key code, and the modifier
+// flag for a modifier key.
+type Modifier struct {
+	Mask byte   // bitmask of the modifier key
+	Code uint16 // key code of the modifier key
+	Mods Mods   // modifier flag of the modifier key
+}
+
+// device is the lazily opened uinput device along with the down state of every
+// key that has been sent through it.
+var device struct {
+	file *os.File
+	down map[uint16]bool
+	mu   sync.Mutex
+}
+
+// uinputBackend is the [Backend] backed by the virtual uinput device.
+type uinputBackend struct{}
+
+var (
+	_ Backend      = uinputBackend{}
+	_ LockReporter = uinputBackend{}
+)
+
+// inputEvent mirrors struct input_event from linux/input.h.
+type inputEvent struct {
+	Time  unix.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// uinputSetup mirrors struct uinput_setup from linux/uinput.h.
+type uinputSetup struct {
+	BusType      uint16
+	Vendor       uint16
+	Product      uint16
+	Version      uint16
+	Name         [80]byte
+	FFEffectsMax uint32
+}
+
+// OpenUinput opens the device at [Uinput].Path and registers a virtual keyboard
+// with the kernel. It is called implicitly by the first key event, so calling
+// it directly is only useful to pay the setup cost up front.
+// It returns an error if the call fails.
+func OpenUinput() error {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	return openUinput()
+}
+
+// CloseUinput destroys the virtual keyboard and closes the device. The next key
+// event opens it again using the current [Uinput] settings.
+// It returns an error if the call fails.
+func CloseUinput() error {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	if device.file == nil {
+		return nil
+	}
+
+	var errs []error
+
+	if isCharDevice(device.file) {
+		if err := unix.IoctlSetInt(int(device.file.Fd()), uiDevDestroy, 0); err != nil {
+			errs = append(errs, fmt.Errorf("UI_DEV_DESTROY: %w", err))
+		}
+	}
+
+	if err := device.file.Close(); err != nil {
+		errs = append(errs, err)
+	}
+
+	device.file = nil
+	device.down = nil
+
+	return errors.Join(errs...)
+}
+
+// RuneToKeyCode translates r to a key code and its shift state using a US
+// QWERTY layout.
+// It returns a pair of 0's with an error if the translation fails, otherwise it
+// returns the key code, shift state, and a nil error.
+func RuneToKeyCode(r rune) (code uint16, shift byte, err error) {
+	ks, err := runeToKeystrokeUS(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, m := range StandardMods {
+		if ks.Mods&m.Mods != 0 {
+			shift |= m.Mask
+		}
+	}
+
+	return uint16(ks.Code), shift, nil
+}
+
+// KeyIsDown detects the down state of key as it was last sent through the
+// virtual device.
+// It returns true if the key is currently depressed and false if it is not.
+func KeyIsDown(key uint16) bool {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	return device.down[key]
+}
+
+// KeyPress sends a key-down event and is intended to be used before a call to
+// [KeyRelease].
+// It returns an error if the call fails.
+func KeyPress(key uint16) error { return sendKey(key, true) }
+
+// KeyRelease sends a key-up event and is intended to be used after a call to
+// [KeyPress].
+// It returns an error if the call fails.
+func KeyRelease(key uint16) error { return sendKey(key, false) }
+
+// KeyTap sends a key-down event and a key-up event with a brief pause in
+// between to help simulate an actual keystroke. The duration of the pause is
+// defined by [KeyPressDuration].
+// It returns an error if the call fails.
+func KeyTap(key uint16) error { return KeyTapOn(uinputBackend{}, KeyCode(key)) }
+
+// KeyTapContext is like [KeyTap] but sends nothing if ctx is already done and
+// cuts the pause short when ctx is done, still releasing the key.
+// It returns an error if the call fails or ctx is done.
+func KeyTapContext(ctx context.Context, key uint16) error {
+	return KeyTapOnContext(ctx, uinputBackend{}, KeyCode(key))
+}
+
+// SendCombo parses combo with [ParseCombo] and sends it through the virtual
+// uinput device.
+// It returns an error if the call fails.
+func SendCombo(combo string) error {
+	if err := OpenUinput(); err != nil {
+		return err
+	}
+
+	return SendComboOn(uinputBackend{}, combo)
+}
+
+// RunScript runs s using [TypeString] options through the virtual uinput
+// device.
+// It returns an error if the call fails.
+func RunScript(s *Script) error {
+	if err := OpenUinput(); err != nil {
+		return err
+	}
+
+	return RunScriptOn(uinputBackend{}, s)
+}
+
+// TypeStr types str using [TypeString] options through the virtual uinput
+// device. A timeout prevents the function call from hanging indefinitely while
+// an abort channel allows aborting the operation.
+// It returns an error if the call fails.
+func TypeStr(str string) (err error) {
+	if err = OpenUinput(); err != nil {
+		return err
+	}
+
+	return TypeStrOn(uinputBackend{}, str)
+}
+
+// TypeStrContext types str using [TypeString] options through the virtual
+// uinput device until it is done or ctx is done. Unlike [TypeStr], it is not
+// aborted by [AbortTypeStr].
+// It returns an error if the call fails.
+func TypeStrContext(ctx context.Context, str string) (err error) {
+	if err = OpenUinput(); err != nil {
+		return err
+	}
+
+	return TypeStrOnContext(ctx, uinputBackend{}, str)
+}
+
+// TypeStrFrom is like [TypeStr] but skips the first offset runes of str, such
+// as the Offset of a [StopError] to resume typing where it stopped.
+// It returns an error if the call fails.
+func TypeStrFrom(str string, offset int) (err error) {
+	if err = OpenUinput(); err != nil {
+		return err
+	}
+
+	return TypeStrOnFrom(uinputBackend{}, str, offset)
+}
+
+// LockState detects the lock keys that are on from the keyboard LEDs of
+// [Uinput].LEDPath, which the desktop keeps in sync on every keyboard. A lock
+// is on when any keyboard lights its LED.
+// It returns an error wrapping [ErrNoLockState] if no keyboard has LEDs.
+func LockState() (Locks, error) { return uinputBackend{}.LockState() }
+
+// SetLockState turns the lock keys of locks on or off by tapping them through
+// the virtual uinput device, see [SetLockStateOn].
+// It returns an error if the call fails.
+func SetLockState(locks Locks, on bool) error {
+	if err := OpenUinput(); err != nil {
+		return err
+	}
+
+	return SetLockStateOn(uinputBackend{}, locks, on)
+}
+
+func (uinputBackend) Name() string                  { return "uinput" }
+func (uinputBackend) Capabilities() Capabilities    { return 0 }
+func (uinputBackend) KeyPress(code KeyCode) error   { return KeyPress(uint16(code)) }
+func (uinputBackend) KeyRelease(code KeyCode) error { return KeyRelease(uint16(code)) }
+func (uinputBackend) KeyIsDown(code KeyCode) bool   { return KeyIsDown(uint16(code)) }
+func (uinputBackend) Close() error                  { return CloseUinput() }
+
+func (uinputBackend) RuneToKeystroke(r rune) (Keystroke, error) {
+	return uinputLayout().RuneToKeystroke(r)
+}
+
+func (uinputBackend) ComposeKeystrokes(r rune) ([]Keystroke, error) {
+	return uinputLayout().ComposeKeystrokes(r)
+}
+
+func (uinputBackend) LockState() (Locks, error) {
+	var (
+		locks Locks
+		found bool
+	)
+	for lock, name := range ledNames {
+		paths, err := filepath.Glob(filepath.Join(Uinput.LEDPath, "*::"+name, "brightness"))
+		if err != nil {
+			return 0, err
+		}
+
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			found = true
+			if s := strings.TrimSpace(string(data)); s != "" && s != "0" {
+				locks |= lock
+			}
+		}
+	}
+
+	if !found {
+		return 0, fmt.Errorf("%w: no keyboard LEDs in %s", ErrNoLockState, Uinput.LEDPath)
+	}
+
+	return locks, nil
+}
+
+// uinputLayout returns [Uinput].Layout, or the XKB layout compiled last if it
+// is nil.
+func uinputLayout() *Layout {
+	if Uinput.Layout != nil {
+		return Uinput.Layout
+	}
+
+	return xkbLayouts.current(func() xkbNames {
+		return xkbNames{root: xkbConfigRoot(), names: systemRMLVO()}
+	})
+}
+
+// isCharDevice reports whether f refers to a character device.
+func isCharDevice(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// openUinput is the base function for OpenUinput and expects the caller to hold
+// the device lock.
+func openUinput() error {
+	if device.file != nil {
+		return nil
+	}
+
+	f, err := os.OpenFile(Uinput.Path, os.O_WRONLY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return err
+	}
+
+	if isCharDevice(f) {
+		if err = setupUinput(f); err != nil {
+			_ = f.Close()
+			return err
+		}
+
+		time.Sleep(Uinput.SettleDuration)
+	}
+
+	device.file = f
+	device.down = make(map[uint16]bool)
+
+	return nil
+}
+
+// setupUinput enables every key code on f and creates the virtual device.
+func setupUinput(f *os.File) error {
+	fd := int(f.Fd())
+
+	if err := unix.IoctlSetInt(fd, uiSetEvBit, EV_KEY); err != nil {
+		return fmt.Errorf("UI_SET_EVBIT: %w", err)
+	}
+
+	for code := KEY_ESC; code <= KEY_MAX; code++ {
+		if err := unix.IoctlSetInt(fd, uiSetKeyBit, code); err != nil {
+			return fmt.Errorf("UI_SET_KEYBIT(%d): %w", code, err)
+		}
+	}
+
+	setup := uinputSetup{BusType: unix.BUS_VIRTUAL, Vendor: 0x1, Product: 0x1}
+	copy(setup.Name[:len(setup.Name)-1], Uinput.Name)
+
+	if _, _, errno := unix.Syscall(
+		unix.SYS_IOCTL,
+		uintptr(fd),
+		uiDevSetup,
+		uintptr(unsafe.Pointer(&setup)),
+	); errno != 0 {
+		return fmt.Errorf("UI_DEV_SETUP: %w", errno)
+	}
+
+	if err := unix.IoctlSetInt(fd, uiDevCreate, 0); err != nil {
+		return fmt.Errorf("UI_DEV_CREATE: %w", err)
+	}
+
+	return nil
+}
+
+// sendKey writes a key event followed by a synchronization event to the
+// virtual device.
+func sendKey(key uint16, down bool) error {
+	device.mu.Lock()
+	defer device.mu.Unlock()
+
+	if err := openUinput(); err != nil {
+		return err
+	}
+
+	var value int32
+	if down {
+		value = 1
+	}
+
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.NativeEndian, []inputEvent{
+		{Type: EV_KEY, Code: key, Value: value},
+		{Type: EV_SYN, Code: SYN_REPORT, Value: 0},
+	})
+
+	if _, err := device.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	device.down[key] = down
+
+	return nil
+}
+
+func init() {
+	RegisterBackend("uinput", func() (Backend, error) {
+		if err := OpenUinput(); err != nil {
+			return nil, err
+		}
+		return uinputBackend{}, nil
+	})
+
+	Uinput.Path = "/dev/uinput"
+	Uinput.Name = "keybd"
+	Uinput.SettleDuration = 200 * time.Millisecond
+	Uinput.LEDPath = "/sys/class/leds"
+}
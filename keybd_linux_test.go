@@ -0,0 +1,415 @@
+//go:build linux
+
+package keybd_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+	"golang.org/x/sys/unix"
+)
+
+var enabled = map[string]bool{
+	"Backend":             true,
+	"Recorder":            true,
+	"Typer":               true,
+	"Combo":               true,
+	"Script":              true,
+	"Strategy":            true,
+	"Grapheme":            true,
+	"Layout":              true,
+	"XKB":                 true,
+	"Watcher":             true,
+	"Rhythm":              true,
+	"Typo":                true,
+	"Pause":               true,
+	"Observer":            true,
+	"Release":             true,
+	"Mods":                true,
+	"Lock":                true,
+	"Preflight":           true,
+	"RuneToKeyCode":       true,
+	"KeyIsDown":           true,
+	"KeyPress|KeyRelease": true,
+	"KeyTap":              true,
+	"TypeStr":             true,
+	"TypeStrWithOpts":     true,
+	"Wayland":             true,
+	"X11":                 true,
+}
+
+// inputEvent mirrors struct input_event from linux/input.h.
+type inputEvent struct {
+	Time  unix.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// keyEvent is the part of an inputEvent that the tests assert on.
+type keyEvent struct {
+	Code uint16
+	Down bool
+}
+
+// useStandIn points the uinput device at a regular file and its LEDs at an
+// empty directory for the duration of the test and returns a function that
+// reads back the key events written to it.
+func useStandIn(t *testing.T) func() []keyEvent {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "uinput")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	us, err := keybd.LayoutByName("us")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	prev, prevLayout, prevLEDs := keybd.Uinput.Path, keybd.Uinput.Layout, keybd.Uinput.LEDPath
+	keybd.Uinput.Path, keybd.Uinput.Layout, keybd.Uinput.LEDPath = path, us, t.TempDir()
+
+	t.Cleanup(func() {
+		_ = keybd.CloseUinput()
+		keybd.Uinput.Path, keybd.Uinput.Layout, keybd.Uinput.LEDPath = prev, prevLayout, prevLEDs
+	})
+
+	return func() []keyEvent {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+		defer f.Close()
+
+		fi, _ := f.Stat()
+		raw := make([]inputEvent, fi.Size()/int64(binary.Size(inputEvent{})))
+		if err := binary.Read(f, binary.NativeEndian, raw); err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+
+		var events []keyEvent
+		for i, ev := range raw {
+			switch ev.Type {
+			case keybd.EV_KEY:
+				events = append(events, keyEvent{Code: ev.Code, Down: ev.Value == 1})
+			case keybd.EV_SYN:
+				if i == 0 || raw[i-1].Type != keybd.EV_KEY {
+					t.Errorf(test.ErrWantFGotF, "EV_KEY before EV_SYN", ev)
+				}
+			}
+		}
+
+		return events
+	}
+}
+
+// decode replays events against a US QWERTY layout and returns the text they
+// produce.
+func decode(events []keyEvent) string {
+	lower := map[uint16]rune{}
+	upper := map[uint16]rune{}
+	for _, r := range "`1234567890-=qwertyuiop[]\\asdfghjkl;'zxcvbnm,./~!@#$%^&*()_+QWERTYUIOP{}|ASDFGHJKL:\"ZXCVBNM<>? \t\n" {
+		code, shift, _ := keybd.RuneToKeyCode(r)
+		if shift&keybd.MOD_SHIFT != 0 {
+			upper[code] = r
+		} else {
+			lower[code] = r
+		}
+	}
+
+	var (
+		shift bool
+		text  []rune
+	)
+
+	for _, ev := range events {
+		if ev.Code == keybd.KEY_LEFTSHIFT {
+			shift = ev.Down
+			continue
+		}
+		if !ev.Down {
+			continue
+		}
+		if r, ok := upper[ev.Code]; shift && ok {
+			text = append(text, r)
+		} else {
+			text = append(text, lower[ev.Code])
+		}
+	}
+
+	return string(text)
+}
+
+func TestRuneToKeyCode(t *testing.T) {
+	tName := "RuneToKeyCode"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:   testRunes["lower"],
+			Output:  []uint16{keybd.KEY_K, 0},
+			Passing: true,
+		},
+		{
+			Input:   testRunes["upper"],
+			Output:  []uint16{keybd.KEY_K, keybd.MOD_SHIFT},
+			Passing: true,
+		},
+		{
+			Input:   testRunes["emoji"],
+			Output:  []uint16{},
+			Passing: false,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			code, shift, err := keybd.RuneToKeyCode(s.Input.(rune))
+
+			got := []uint16{code, uint16(shift)}
+			want := s.Output.([]uint16)
+
+			if s.Passing {
+				if err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf(test.ErrWantFGotF, want, got)
+				}
+			} else {
+				if err == nil {
+					t.Errorf(test.ErrWantFGotF, "error", "none")
+				}
+			}
+		})
+	}
+}
+
+func TestKeyPress_KeyRelease(t *testing.T) {
+	tName := "KeyPress|KeyRelease"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	events := useStandIn(t)
+	code, _, _ := keybd.RuneToKeyCode(testRunes["lower"])
+
+	if err := keybd.KeyPress(code); err != nil {
+		t.Errorf(test.ErrUnexpectedF, err)
+	}
+	if err := keybd.KeyRelease(code); err != nil {
+		t.Errorf(test.ErrUnexpectedF, err)
+	}
+
+	want := []keyEvent{{code, true}, {code, false}}
+	if got := events(); !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestKeyTap(t *testing.T) {
+	tName := "KeyTap"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	events := useStandIn(t)
+	code, _, _ := keybd.RuneToKeyCode(testRunes["lower"])
+
+	if err := keybd.KeyTap(code); err != nil {
+		t.Errorf(test.ErrUnexpectedF, err)
+	}
+
+	want := []keyEvent{{code, true}, {code, false}}
+	if got := events(); !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestKeyIsDown(t *testing.T) {
+	tName := "KeyIsDown"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:  testRunes["lower"],
+			Output: true,
+		},
+		{
+			Input:  testRunes["lower"],
+			Output: false,
+		},
+	}
+
+	_ = useStandIn(t)
+
+	for i, s := range scenes {
+		first := i == 0
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			code, _, _ := keybd.RuneToKeyCode(s.Input.(rune))
+
+			if first {
+				if err := keybd.KeyPress(code); err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+			}
+
+			if got, want := keybd.KeyIsDown(code), s.Output.(bool); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+
+			if first {
+				if err := keybd.KeyRelease(code); err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTypeStr(t *testing.T) {
+	tName := "TypeStr"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:  testStrings["shortWord"] + "\r\n",
+			Output: testStrings["shortWord"] + "\n",
+		},
+		{
+			Input:  testStrings["complexWord"] + "\r\n",
+			Output: testStrings["complexWord"] + "\n",
+		},
+		{
+			Input:  testStrings["shortSentence"] + "\r\n",
+			Output: testStrings["shortSentence"] + "\n",
+		},
+		{
+			Input:  testStrings["multiLineStringWithTabs"] + "\r\n",
+			Output: testStrings["multiLineStringWithTabs"] + "\n",
+		},
+		{
+			Input:  testStrings["multiLineStringWithSpaces"] + "\r\n",
+			Output: testStrings["multiLineStringWithSpaces"] + "\n",
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			events := useStandIn(t)
+
+			if err := keybd.TypeStr(s.Input.(string)); err != nil {
+				t.Fatalf(test.ErrWantFGotF, nil, err)
+			}
+			if got, want := decode(events()), s.Output.(string); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestTypeStrWithOpts(t *testing.T) {
+	tName := "TypeStrWithOpts"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:  testStrings["multiLineStringWithTabs"] + "\r\n",
+			Output: testStrings["multiLineStringWithSpaces"] + "\n",
+		},
+		{
+			Input:  testStrings["multiLineStringWithSpaces"] + "\r\n",
+			Output: testStrings["multiLineStringWithSpaces"] + "\n",
+		},
+	}
+
+	tabsToSpaces, tabSize := keybd.TypeString.TabsToSpaces, keybd.TypeString.TabSize
+	keybd.TypeString.TabsToSpaces = true
+	keybd.TypeString.TabSize = 4
+	t.Cleanup(func() {
+		keybd.TypeString.TabsToSpaces, keybd.TypeString.TabSize = tabsToSpaces, tabSize
+	})
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			events := useStandIn(t)
+
+			if err := keybd.TypeStr(s.Input.(string)); err != nil {
+				t.Fatalf(test.ErrWantFGotF, nil, err)
+			}
+			if got, want := decode(events()), s.Output.(string); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestLockState(t *testing.T) {
+	tName := "Lock"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	events := useStandIn(t)
+
+	if _, err := keybd.LockState(); !errors.Is(err, keybd.ErrNoLockState) {
+		t.Errorf(test.ErrWantFGotF, keybd.ErrNoLockState, err)
+	}
+
+	for led, brightness := range map[string]string{
+		"input3::capslock":   "1\n",
+		"input3::numlock":    "0\n",
+		"input3::scrolllock": "0\n",
+		"input7::numlock":    "1\n",
+		"input3::kana":       "1\n",
+	} {
+		dir := filepath.Join(keybd.Uinput.LEDPath, led)
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "brightness"), []byte(brightness), 0o600); err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+	}
+
+	got, err := keybd.LockState()
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if want := keybd.LockCaps | keybd.LockNum; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	if err := keybd.TypeStr("Hi"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	want := []keyEvent{
+		{Code: keybd.KEY_H, Down: true},
+		{Code: keybd.KEY_H, Down: false},
+		{Code: keybd.KEY_LEFTSHIFT, Down: true},
+		{Code: keybd.KEY_I, Down: true},
+		{Code: keybd.KEY_I, Down: false},
+		{Code: keybd.KEY_LEFTSHIFT, Down: false},
+	}
+	if got := events(); !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
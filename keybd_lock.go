@@ -0,0 +1,173 @@
+package keybd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Constants for lock key flags.
+const (
+	LockCaps Locks = 1 << iota
+	LockNum
+	LockScroll
+)
+
+// Constants for the ways a [Typer] deals with Caps Lock.
+const (
+	// CapsLockAuto is CapsLockToggle on backends with CapCapsLockUpper and
+	// CapsLockShift on the others.
+	CapsLockAuto CapsLockMode = iota
+
+	// CapsLockShift inverts Shift for the letters typed while Caps Lock is on,
+	// such as typing "k" with Shift held.
+	CapsLockShift
+
+	// CapsLockToggle turns Caps Lock off while typing and back on afterwards.
+	CapsLockToggle
+
+	// CapsLockIgnore types as if Caps Lock were off.
+	CapsLockIgnore
+)
+
+// lockKeys maps the lock flags onto the keys that toggle them.
+var lockKeys = []struct {
+	lock Locks
+	code KeyCode
+}{
+	{LockCaps, KEY_CAPSLOCK},
+	{LockNum, KEY_NUMLOCK},
+	{LockScroll, KEY_SCROLLLOCK},
+}
+
+// Locks is a set of lock key flags.
+type Locks uint8
+
+// A CapsLockMode is a way a [Typer] deals with Caps Lock, see [WithCapsLock].
+type CapsLockMode int
+
+// A LockReporter is a [Backend] that can report which lock keys are on.
+type LockReporter interface {
+	// LockState returns the lock keys that are on.
+	LockState() (Locks, error)
+}
+
+// A lockSetter is a [Backend] that sets the lock keys without tapping them,
+// since tapping them does not toggle them.
+type lockSetter interface {
+	setLockState(locks Locks, on bool) error
+}
+
+// LockStateOn returns the lock keys that are on for b.
+// It returns an error wrapping [ErrNoLockState] if b is not a [LockReporter],
+// or if the call fails.
+func LockStateOn(b Backend) (Locks, error) {
+	r, ok := b.(LockReporter)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNoLockState, b.Name())
+	}
+
+	return r.LockState()
+}
+
+// SetLockStateOn turns the lock keys of locks on or off for b, tapping the key
+// of every lock that is not in that state yet, such as SetLockStateOn(b,
+// LockCaps, false) turning Caps Lock off.
+// It returns an error wrapping [ErrNoLockState] if b is not a [LockReporter],
+// or if the call fails.
+func SetLockStateOn(b Backend, locks Locks, on bool) error {
+	if s, ok := b.(lockSetter); ok {
+		return s.setLockState(locks, on)
+	}
+
+	state, err := LockStateOn(b)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, k := range lockKeys {
+		if locks&k.lock != 0 && (state&k.lock != 0) != on {
+			if err := keyTap(context.Background(), b, k.code, KeyPressDuration); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// String formats l as the names of its lock keys joined with "+", such as
+// "capslock+numlock".
+func (l Locks) String() string {
+	var names []string
+	for _, k := range lockKeys {
+		if l&k.lock != 0 {
+			names = append(names, keyNamesByCode[k.code])
+		}
+	}
+
+	return strings.Join(names, "+")
+}
+
+// WithCapsLock sets how the Typer deals with Caps Lock on backends that are a
+// [LockReporter]. The state of Caps Lock is read whenever typing starts.
+//
+// Default: CapsLockAuto
+func WithCapsLock(mode CapsLockMode) TyperOption { return func(t *Typer) { t.capsLock = mode } }
+
+// adjustCapsLock reads the state of Caps Lock on b and deals with it according
+// to the mode of t. It reports whether Caps Lock is left on, so that Shift has
+// to be inverted, and returns the function that restores the state of Caps
+// Lock. A backend whose state cannot be read is typed on as if Caps Lock were
+// off.
+func (t *Typer) adjustCapsLock(b Backend) (bool, func()) {
+	if t.capsLock == CapsLockIgnore {
+		return false, func() {}
+	}
+
+	state, err := LockStateOn(b)
+	if err != nil || state&LockCaps == 0 {
+		return false, func() {}
+	}
+
+	mode := t.capsLock
+	if mode == CapsLockAuto {
+		mode = CapsLockShift
+		if b.Capabilities().Has(CapCapsLockUpper) {
+			mode = CapsLockToggle
+		}
+	}
+
+	if mode != CapsLockToggle {
+		return true, func() {}
+	}
+
+	if err := SetLockStateOn(b, LockCaps, false); err != nil {
+		return true, func() {}
+	}
+
+	return false, func() { _ = SetLockStateOn(b, LockCaps, true) }
+}
+
+// capsLocked returns p with Shift inverted for the key that types its rune
+// while Caps Lock is on, which is the last keystroke of a letter typed with
+// the layout or a dead key.
+func (p RunePlan) capsLocked() RunePlan {
+	if p.Strategy != StrategyLayout && p.Strategy != StrategyDeadKey || len(p.Keystrokes) == 0 || !isCapsLetter(p.Rune) {
+		return p
+	}
+
+	p.Keystrokes = slices.Clone(p.Keystrokes)
+	p.Keystrokes[len(p.Keystrokes)-1].Mods ^= ModShift
+
+	return p
+}
+
+// isCapsLetter reports whether r is a letter whose case Caps Lock inverts.
+func isCapsLetter(r rune) bool {
+	return unicode.IsLetter(r) && unicode.ToUpper(r) != unicode.ToLower(r)
+}
@@ -0,0 +1,180 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+// lockless is a [keybd.Backend] that cannot report its lock keys.
+type lockless struct{ keybd.Backend }
+
+// capsLockScene is the input of a scene of TestTyperCapsLock.
+type capsLockScene struct {
+	mode  keybd.CapsLockMode
+	locks keybd.Locks
+}
+
+func TestTyperCapsLock(t *testing.T) {
+	tName := "Lock"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	const str = "Hi, K2"
+
+	scenes := []test.Scene{
+		{Input: capsLockScene{keybd.CapsLockAuto, 0}, Output: str},
+		{Input: capsLockScene{keybd.CapsLockAuto, keybd.LockCaps}, Output: str},
+		{Input: capsLockScene{keybd.CapsLockShift, keybd.LockCaps | keybd.LockNum}, Output: str},
+		{Input: capsLockScene{keybd.CapsLockToggle, keybd.LockCaps}, Output: str},
+		{Input: capsLockScene{keybd.CapsLockIgnore, keybd.LockCaps}, Output: "hI, k2"},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.(capsLockScene)
+
+			rec := keybd.NewRecorder()
+			rec.SetLocks(in.locks)
+
+			typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithCapsLock(in.mode))
+			if err := typer.Type(context.Background(), str); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+
+			if err := rec.EqualText(s.Output.(string)); err != nil {
+				t.Error(err)
+			}
+			if got, _ := rec.LockState(); got != in.locks {
+				t.Errorf(test.ErrWantFGotF, in.locks, got)
+			}
+
+			var taps int
+			for _, e := range rec.Events() {
+				if e.Code == keybd.KEY_CAPSLOCK && e.Down {
+					taps++
+				}
+			}
+			var want int
+			if in.mode == keybd.CapsLockToggle {
+				want = 2
+			}
+			if taps != want {
+				t.Errorf(test.ErrWantFGotF, want, taps)
+			}
+		})
+	}
+}
+
+func TestTyperCapsLockPlan(t *testing.T) {
+	tName := "Lock"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	rec.SetLocks(keybd.LockCaps)
+
+	var plans []keybd.RunePlan
+	typer := keybd.NewTyper(
+		keybd.WithBackend(rec),
+		keybd.WithStrategyReport(func(_ int, p keybd.RunePlan) { plans = append(plans, p) }),
+	)
+	if err := typer.Type(context.Background(), "aB!"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	want := []keybd.Mods{keybd.ModShift, 0, keybd.ModShift}
+	for i, p := range plans {
+		if got := p.Keystrokes[0].Mods; got != want[i] {
+			t.Errorf(test.ErrWantFGotF, want[i], got)
+		}
+	}
+
+	err := rec.EqualEvents([]keybd.RecordedEvent{
+		{Code: keybd.KEY_LEFTSHIFT, Down: true, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_A, Down: true, Mods: keybd.ModShift, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_A, Down: false, Mods: keybd.ModShift, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_LEFTSHIFT, Down: false, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_B, Down: true, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_B, Down: false, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_LEFTSHIFT, Down: true, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_1, Down: true, Mods: keybd.ModShift, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_1, Down: false, Mods: keybd.ModShift, Locks: keybd.LockCaps},
+		{Code: keybd.KEY_LEFTSHIFT, Down: false, Locks: keybd.LockCaps},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSetLockStateOn(t *testing.T) {
+	tName := "Lock"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	rec.SetLocks(keybd.LockNum)
+
+	if err := keybd.SetLockStateOn(rec, keybd.LockCaps|keybd.LockNum, true); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	err := rec.EqualEvents([]keybd.RecordedEvent{
+		{Code: keybd.KEY_CAPSLOCK, Down: true, Locks: keybd.LockCaps | keybd.LockNum},
+		{Code: keybd.KEY_CAPSLOCK, Down: false, Locks: keybd.LockCaps | keybd.LockNum},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := keybd.SetLockStateOn(rec, keybd.LockNum|keybd.LockScroll, false); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if got, err := keybd.LockStateOn(rec); err != nil {
+		t.Errorf(test.ErrUnexpectedF, err)
+	} else if got != keybd.LockCaps {
+		t.Errorf(test.ErrWantFGotF, keybd.LockCaps, got)
+	}
+
+	b := lockless{keybd.NewRecorder()}
+	if _, err := keybd.LockStateOn(b); !errors.Is(err, keybd.ErrNoLockState) {
+		t.Errorf(test.ErrWantFGotF, keybd.ErrNoLockState, err)
+	}
+	if err := keybd.SetLockStateOn(b, keybd.LockCaps, true); !errors.Is(err, keybd.ErrNoLockState) {
+		t.Errorf(test.ErrWantFGotF, keybd.ErrNoLockState, err)
+	}
+
+	typer := keybd.NewTyper(keybd.WithBackend(b))
+	if err := typer.Type(context.Background(), "Hi"); err != nil {
+		t.Errorf(test.ErrUnexpectedF, err)
+	}
+}
+
+func TestLocksString(t *testing.T) {
+	tName := "Lock"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{Input: keybd.Locks(0), Output: ""},
+		{Input: keybd.LockCaps, Output: "capslock"},
+		{Input: keybd.LockScroll | keybd.LockNum, Output: "numlock+scrolllock"},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			if got, want := s.Input.(keybd.Locks).String(), s.Output.(string); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package keybd_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestModsGeneric(t *testing.T) {
+	tName := "Mods"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{Input: keybd.Mods(0), Output: keybd.Mods(0)},
+		{Input: keybd.ModRightShift, Output: keybd.ModShift},
+		{Input: keybd.ModShift | keybd.ModRightShift, Output: keybd.ModShift},
+		{Input: keybd.ModRightCtrl | keybd.ModRightMeta, Output: keybd.ModCtrl | keybd.ModMeta},
+		{Input: keybd.ModAltGr | keybd.ModRightShift, Output: keybd.ModAltGr | keybd.ModShift},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			if got, want := s.Input.(keybd.Mods).Generic(), s.Output.(keybd.Mods); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestModsString(t *testing.T) {
+	tName := "Mods"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{Input: keybd.Mods(0), Output: ""},
+		{Input: keybd.ModShift | keybd.ModCtrl, Output: "ctrl+shift"},
+		{Input: keybd.ModRightMeta | keybd.ModAltGr | keybd.ModAlt, Output: "alt+altgr+rightmeta"},
+		{Input: keybd.ModRightShift | keybd.ModRightCtrl, Output: "rightctrl+rightshift"},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			if got, want := s.Input.(keybd.Mods).String(), s.Output.(string); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestRecorderRightShift(t *testing.T) {
+	tName := "Mods"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	for _, c := range []string{"rshift+h", "i", "rightshift+1"} {
+		if err := keybd.SendComboOn(rec, c); err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+	}
+
+	if err := rec.EqualText("Hi!"); err != nil {
+		t.Error(err)
+	}
+}
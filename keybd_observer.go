@@ -0,0 +1,62 @@
+package keybd
+
+import (
+	"fmt"
+	"time"
+)
+
+// A TypeEventKind is the kind of a [TypeEvent].
+type TypeEventKind int
+
+// Constants for kinds of events of typing.
+const (
+	TypeEventStarted  TypeEventKind = iota + 1 // typing started
+	TypeEventRune                              // a rune was typed
+	TypeEventFinished                          // typing finished, with or without errors
+	TypeEventStopped                           // typing stopped early, aborted or timed out
+)
+
+// A TypeEvent is a struct that describes the progress of a call to
+// [Typer.Type], reported to the function of [WithObserver].
+//
+// A call reports TypeEventStarted once it is typing, TypeEventRune for every
+// rune typed, and either TypeEventFinished or TypeEventStopped when it returns.
+// A call that is stopped before it starts typing only reports
+// TypeEventStopped. Taps of Backspace that correct a typo of [WithTypos] are
+// reported as runes '\b'.
+type TypeEvent struct {
+	Kind TypeEventKind
+
+	// Index is the index of the rune for TypeEventRune, the index typing
+	// starts at for TypeEventStarted, and the number of runes typed for
+	// TypeEventFinished and TypeEventStopped, counted in runes.
+	Index int
+
+	// Total is the number of runes of the string for every kind but
+	// TypeEventRune.
+	Total int
+
+	Rune     rune          // rune typed, for TypeEventRune
+	Plan     RunePlan      // translation of the rune, for TypeEventRune
+	Time     time.Time     // time the event occurred, or the rune started to be typed
+	Duration time.Duration // time it took to type the rune, for TypeEventRune
+
+	// Err is the [TypeError] of the rune for TypeEventRune, and the error
+	// returned by the call for TypeEventFinished and TypeEventStopped.
+	Err error
+}
+
+func (k TypeEventKind) String() string {
+	switch k {
+	case TypeEventStarted:
+		return "started"
+	case TypeEventRune:
+		return "rune"
+	case TypeEventFinished:
+		return "finished"
+	case TypeEventStopped:
+		return "stopped"
+	}
+
+	return fmt.Sprintf("TypeEventKind(%d)", int(k))
+}
@@ -0,0 +1,165 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+// eventLog is an observer that logs the events of typing.
+type eventLog struct {
+	events []keybd.TypeEvent
+	mu     sync.Mutex
+}
+
+func (l *eventLog) observe(e keybd.TypeEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, e)
+}
+
+// kinds returns the kinds of the logged events, with the runes of
+// TypeEventRune.
+func (l *eventLog) kinds() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var s string
+	for _, e := range l.events {
+		if e.Kind == keybd.TypeEventRune {
+			s += fmt.Sprintf("%q ", e.Rune)
+		} else {
+			s += e.Kind.String() + " "
+		}
+	}
+
+	return s
+}
+
+func TestTyperWithObserver(t *testing.T) {
+	tName := "Observer"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	log := &eventLog{}
+	rec := keybd.NewRecorder()
+	typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithObserver(log.observe))
+
+	start := time.Now()
+	if err := typer.Type(context.Background(), "Hi!"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if got, want := log.kinds(), `started 'H' 'i' '!' finished `; got != want {
+		t.Fatalf(test.ErrWantFGotF, want, got)
+	}
+
+	first, last := log.events[0], log.events[len(log.events)-1]
+	if first.Index != 0 || first.Total != 3 {
+		t.Errorf(test.ErrWantFGotF, "index 0 of 3", fmt.Sprintf("index %d of %d", first.Index, first.Total))
+	}
+	if last.Index != 3 || last.Total != 3 || last.Err != nil {
+		t.Errorf(test.ErrWantFGotF, "3 of 3 typed", fmt.Sprintf("%d of %d typed: %v", last.Index, last.Total, last.Err))
+	}
+
+	for i, e := range log.events[1:4] {
+		if e.Index != i || e.Err != nil {
+			t.Errorf(test.ErrWantFGotF, i, e.Index)
+		}
+		if e.Plan.Strategy != keybd.StrategyLayout || e.Plan.Rune != e.Rune {
+			t.Errorf(test.ErrWantFGotF, keybd.StrategyLayout, e.Plan)
+		}
+		if e.Time.Before(start) || e.Duration < 2*time.Millisecond {
+			t.Errorf(test.ErrWantFGotF, "rune timed", e.Duration)
+		}
+		start = e.Time
+	}
+}
+
+func TestTyperWithObserverErrors(t *testing.T) {
+	tName := "Observer"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	typos := &keybd.TypoPlanner{Rate: 1, Kinds: []keybd.TypoKind{keybd.TypoDoubled}, Notice: -1, Pause: time.Microsecond}
+
+	// Typing is canceled once the rune at the index before stopAfter is typed.
+	scenes := []test.Scene{
+		{Input: []any{"a€b", (*keybd.TypoPlanner)(nil), 0, 3}, Output: `started 'a' '€' 'b' finished `},
+		{Input: []any{"abc", (*keybd.TypoPlanner)(nil), 2, 2}, Output: `started 'a' 'b' stopped `},
+		{Input: []any{"ab", typos, 0, 2}, Output: `started 'a' 'a' '\b' '\b' 'a' 'b' 'b' '\b' '\b' 'b' finished `},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.([]any)
+			str, stopAfter, typed := in[0].(string), in[2].(int), in[3].(int)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			log := &eventLog{}
+			typer := keybd.NewTyper(
+				keybd.WithBackend(keybd.NewRecorder()),
+				keybd.WithTypos(in[1].(*keybd.TypoPlanner)),
+				keybd.WithObserver(func(e keybd.TypeEvent) {
+					log.observe(e)
+					if e.Kind == keybd.TypeEventRune && e.Index+1 == stopAfter {
+						cancel()
+					}
+				}),
+			)
+
+			err := typer.Type(ctx, str)
+
+			if got := log.kinds(); got != s.Output.(string) {
+				t.Fatalf(test.ErrWantFGotF, s.Output, got)
+			}
+
+			last := log.events[len(log.events)-1]
+			if last.Err != err || last.Index != typed {
+				t.Errorf(test.ErrWantFGotF, err, last)
+			}
+
+			for _, e := range log.events {
+				var typeErr *keybd.TypeError
+				if e.Kind == keybd.TypeEventRune && (e.Err != nil) != (e.Rune == '€') {
+					t.Errorf(test.ErrUnexpectedF, e.Err)
+				} else if e.Rune == '€' && (!errors.As(e.Err, &typeErr) || typeErr.Index != e.Index) {
+					t.Errorf(test.ErrWantFGotF, e.Index, e.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestTypeStringObserver(t *testing.T) {
+	tName := "Observer"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	log := &eventLog{}
+	keybd.TypeString.Observer = log.observe
+	defer func() { keybd.TypeString.Observer = nil }()
+
+	if err := keybd.TypeStrOnFrom(keybd.NewRecorder(), "xyz", 1); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if got, want := log.kinds(), `started 'y' 'z' finished `; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if first := log.events[0]; first.Index != 1 || first.Total != 3 {
+		t.Errorf(test.ErrWantFGotF, "index 1 of 3", fmt.Sprintf("index %d of %d", first.Index, first.Total))
+	}
+}
@@ -0,0 +1,122 @@
+package keybd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A pauser is a struct that pauses typing between grapheme clusters and the
+// timeouts of the calls it pauses. A [Typer] has its own, while the typers of
+// [TypeString] share one.
+type pauser struct {
+	resumed chan struct{}        // closed on resume, nil while not paused
+	clocks  map[*pauseClock]bool // timeouts of the running calls
+	mu      sync.Mutex
+}
+
+// A pauseClock is the timeout of a call, which does not run while paused.
+type pauseClock struct {
+	timer    *time.Timer
+	deadline time.Time
+	left     time.Duration // time left when paused
+	stopped  bool          // whether the timer was stopped by a pause
+}
+
+// Pause pauses the calls of t at the next grapheme cluster, releasing the held
+// modifier keys, until [Typer.Resume] is called. Calls made while paused wait
+// to start, and the timeout of t does not run while paused.
+func (t *Typer) Pause() { t.pause.pause() }
+
+// Resume resumes the calls of t paused by [Typer.Pause].
+func (t *Typer) Resume() { t.pause.resume() }
+
+// Paused reports whether the calls of t are paused.
+func (t *Typer) Paused() bool { return t.pause.paused() }
+
+func (p *pauser) pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resumed != nil {
+		return
+	}
+
+	p.resumed = make(chan struct{})
+	for c := range p.clocks {
+		if c.stopped = c.timer.Stop(); c.stopped {
+			c.left = time.Until(c.deadline)
+		}
+	}
+}
+
+func (p *pauser) resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.resumed == nil {
+		return
+	}
+
+	close(p.resumed)
+	p.resumed = nil
+	for c := range p.clocks {
+		if c.stopped {
+			c.deadline = time.Now().Add(c.left)
+			c.timer.Reset(c.left)
+			c.stopped = false
+		}
+	}
+}
+
+func (p *pauser) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.resumed != nil
+}
+
+// wait waits until p is resumed or ctx is done.
+// It returns the error of ctx if it is done.
+func (p *pauser) wait(ctx context.Context) error {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+
+	if resumed != nil {
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+		}
+	}
+
+	return ctx.Err()
+}
+
+// startTimeout calls fn after d has elapsed while not paused.
+func (p *pauser) startTimeout(d time.Duration, fn func()) *pauseClock {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c := &pauseClock{timer: time.AfterFunc(d, fn), deadline: time.Now().Add(d)}
+	if p.resumed != nil {
+		c.stopped = c.timer.Stop()
+		c.left = d
+	}
+
+	if p.clocks == nil {
+		p.clocks = make(map[*pauseClock]bool)
+	}
+	p.clocks[c] = true
+
+	return c
+}
+
+// stopTimeout stops the timeout of c.
+func (p *pauser) stopTimeout(c *pauseClock) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c.timer.Stop()
+	delete(p.clocks, c)
+}
@@ -0,0 +1,277 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf(test.ErrWantFGotF, "condition", "timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTyperPause(t *testing.T) {
+	tName := "Pause"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+
+	var typer *keybd.Typer
+	typer = keybd.NewTyper(
+		keybd.WithBackend(rec),
+		keybd.WithTimeout(100*time.Millisecond),
+		keybd.WithStrategyReport(func(i int, _ keybd.RunePlan) {
+			if i == 3 {
+				typer.Pause()
+			}
+		}),
+	)
+
+	done := make(chan error, 1)
+	go func() { done <- typer.Type(context.Background(), "ABCDEF") }()
+
+	// Typing pauses before the fourth rune, releasing Shift.
+	waitFor(t, func() bool { return rec.Text() == "ABC" && !rec.KeyIsDown(keybd.KEY_LEFTSHIFT) })
+	if !typer.Paused() {
+		t.Errorf(test.ErrWantFGotF, true, false)
+	}
+
+	// The timeout does not run while paused.
+	time.Sleep(250 * time.Millisecond)
+	if got := rec.Text(); got != "ABC" {
+		t.Errorf(test.ErrWantFGotF, "ABC", got)
+	}
+
+	typer.Resume()
+	if err := <-done; err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := rec.EqualText("ABCDEF"); err != nil {
+		t.Error(err)
+	}
+
+	// Calls made while paused wait to start.
+	rec.Reset()
+	typer.Pause()
+	go func() { done <- typer.Type(context.Background(), "ab") }()
+
+	time.Sleep(20 * time.Millisecond)
+	if events := rec.Events(); len(events) != 0 {
+		t.Errorf(test.ErrWantFGotF, 0, len(events))
+	}
+
+	typer.Resume()
+	if err := <-done; err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := rec.EqualText("ab"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTyperTypeFrom(t *testing.T) {
+	tName := "Pause"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	typos := &keybd.TypoPlanner{Rate: 1, Kinds: []keybd.TypoKind{keybd.TypoDoubled}, Notice: -1, Pause: time.Microsecond}
+
+	// Typing is canceled when the report is called for the nth time, which
+	// plans rune n-1, so that it stops at that rune.
+	scenes := []test.Scene{
+		{Input: []any{"Hello World", 6, (*keybd.TypoPlanner)(nil)}, Output: 5},
+		{Input: []any{"Hello World", 2, (*keybd.TypoPlanner)(nil)}, Output: 1},
+		// The stop erases the typo "hh" once its first rune is typed.
+		{Input: []any{"hello", 2, typos}, Output: 0},
+		{Input: []any{"hello", 5, typos}, Output: 1},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.([]any)
+			str, stopAt := in[0].(string), in[1].(int)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var reports int
+			rec := keybd.NewRecorder()
+			typer := keybd.NewTyper(
+				keybd.WithBackend(rec),
+				keybd.WithTypos(in[2].(*keybd.TypoPlanner)),
+				keybd.WithStrategyReport(func(int, keybd.RunePlan) {
+					if reports++; reports == stopAt {
+						cancel()
+					}
+				}),
+			)
+
+			err := typer.Type(ctx, str)
+
+			var stop *keybd.StopError
+			if !errors.As(err, &stop) || !errors.Is(err, keybd.ErrAborted) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrAborted, err)
+			}
+			if want := s.Output.(int); stop.Offset != want {
+				t.Fatalf(test.ErrWantFGotF, want, stop.Offset)
+			}
+			if err := rec.EqualText(string([]rune(str)[:stop.Offset])); err != nil {
+				t.Error(err)
+			}
+			if rec.KeyIsDown(keybd.KEY_LEFTSHIFT) {
+				t.Errorf(test.ErrWantFGotF, false, true)
+			}
+
+			if err := typer.TypeFrom(context.Background(), str, stop.Offset); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+			if err := rec.EqualText(str); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// hanging is a [keybd.Backend] whose key presses of code hang, closing hung,
+// until release is closed.
+type hanging struct {
+	keybd.Backend
+	code    keybd.KeyCode
+	hung    chan struct{}
+	release chan struct{}
+}
+
+func (h hanging) KeyPress(code keybd.KeyCode) error {
+	if code == h.code {
+		close(h.hung)
+		<-h.release
+	}
+
+	return h.Backend.KeyPress(code)
+}
+
+func TestTyperStopHung(t *testing.T) {
+	tName := "Pause"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	b := hanging{Backend: rec, code: keybd.KEY_C, hung: make(chan struct{}), release: make(chan struct{})}
+	defer close(b.release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-b.hung
+		cancel()
+	}()
+
+	// The call returns without waiting for the hung key press, reporting the
+	// runes typed before it.
+	start := time.Now()
+	err := keybd.NewTyper(keybd.WithBackend(b)).Type(ctx, "abcd")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf(test.ErrWantFGotF, "at most 5s", elapsed)
+	}
+
+	var stop *keybd.StopError
+	if !errors.As(err, &stop) || !errors.Is(err, keybd.ErrAborted) {
+		t.Fatalf(test.ErrWantFGotF, keybd.ErrAborted, err)
+	}
+	if stop.Offset != 2 {
+		t.Errorf(test.ErrWantFGotF, 2, stop.Offset)
+	}
+	if err := rec.EqualText("ab"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTypeFromErrors(t *testing.T) {
+	tName := "Pause"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	typer := keybd.NewTyper(keybd.WithBackend(rec))
+
+	// Offsets outside of the string are clamped to it.
+	if err := typer.TypeFrom(context.Background(), "abc", 3); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := typer.TypeFrom(context.Background(), "abc", -1); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := rec.EqualText("abc"); err != nil {
+		t.Error(err)
+	}
+
+	// The indexes of errors count the runes of the whole string.
+	rec.Reset()
+	err := typer.TypeFrom(context.Background(), "ab€c€", 2)
+
+	var typeErr *keybd.TypeError
+	if !errors.As(err, &typeErr) || typeErr.Index != 2 {
+		t.Fatalf(test.ErrWantFGotF, 2, err)
+	}
+	if err := rec.EqualText("c"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPauseTypeStr(t *testing.T) {
+	tName := "Pause"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+
+	keybd.PauseTypeStr()
+	defer keybd.ResumeTypeStr()
+
+	done := make(chan error, 1)
+	go func() { done <- keybd.TypeStrOn(rec, "abc") }()
+
+	time.Sleep(20 * time.Millisecond)
+	keybd.AbortTypeStr()
+
+	err := <-done
+
+	var stop *keybd.StopError
+	if !errors.As(err, &stop) || !errors.Is(err, keybd.ErrAborted) {
+		t.Fatalf(test.ErrWantFGotF, keybd.ErrAborted, err)
+	}
+	if stop.Offset != 0 {
+		t.Errorf(test.ErrWantFGotF, 0, stop.Offset)
+	}
+	if events := rec.Events(); len(events) != 0 {
+		t.Errorf(test.ErrWantFGotF, 0, len(events))
+	}
+
+	keybd.ResumeTypeStr()
+	if err := keybd.TypeStrOnFrom(rec, "abc", 1); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := rec.EqualText("bc"); err != nil {
+		t.Error(err)
+	}
+}
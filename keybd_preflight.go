@@ -0,0 +1,140 @@
+package keybd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// heldModsPoll is how often [HeldModsWait] checks whether the modifier keys
+// are released.
+const heldModsPoll = 10 * time.Millisecond
+
+// Constants for the ways a [Typer] deals with modifier keys that are held when
+// it starts typing, such as Control still held from the hotkey that triggered
+// it, which would turn every letter into a shortcut.
+const (
+	// HeldModsIgnore types while the modifier keys are held.
+	HeldModsIgnore HeldModsMode = iota
+
+	// HeldModsWait waits until the modifier keys are released, failing with
+	// ErrModsHeld after the timeout of WithHeldModsTimeout.
+	HeldModsWait
+
+	// HeldModsRelease sends key-up events for the held modifier keys before
+	// typing and key-down events afterwards for the ones that are still held
+	// physically, which [ReleaseAll] releases. On backends that are not a
+	// [PhysicalKeyReporter], the modifier keys are left released.
+	HeldModsRelease
+)
+
+// A PhysicalKeyReporter is a [Backend] that can tell whether a key is held on
+// the physical keyboard, apart from the key events sent through the backend.
+type PhysicalKeyReporter interface {
+	// PhysicalKeyIsDown reports whether code is held on the physical keyboard.
+	PhysicalKeyIsDown(code KeyCode) bool
+}
+
+// A HeldModsMode is a way a [Typer] deals with modifier keys that are held
+// when it starts typing, see [WithHeldMods].
+type HeldModsMode int
+
+// WithHeldMods sets how the Typer deals with modifier keys that are held when a
+// call starts, on backends with CapKeyState. Modifier keys pressed by the
+// package, such as by a script, are left alone.
+//
+// Default: HeldModsIgnore
+func WithHeldMods(mode HeldModsMode) TyperOption { return func(t *Typer) { t.heldMods = mode } }
+
+// WithHeldModsTimeout sets how long [HeldModsWait] waits for the modifier keys
+// to be released. The time counts toward the timeout of the Typer.
+//
+// Default: 5 s
+func WithHeldModsTimeout(d time.Duration) TyperOption {
+	return func(t *Typer) { t.heldModsTimeout = d }
+}
+
+// HeldModsOn returns the modifiers whose keys are down on b without having
+// been pressed by the package, such as the ones held by the user. Backends
+// without CapKeyState only know the keys pressed through them, so they never
+// report any.
+func HeldModsOn(b Backend) Mods { return heldMods(b, heldOn(b)) }
+
+// neutralizeMods deals with the modifier keys that are held on b, except the
+// ones of own, according to the mode of t. It returns the function that
+// restores the ones still held physically once typing is done, pressing them
+// with pressKey so that they are released like the keys the package pressed.
+// It returns an error matching [ErrModsHeld] if they are not released in time,
+// or the error of ctx if it is done while waiting.
+func (t *Typer) neutralizeMods(ctx context.Context, b Backend, own map[KeyCode]bool) (func(), error) {
+	if t.heldMods == HeldModsIgnore {
+		return func() {}, nil
+	}
+
+	mods := heldMods(b, own)
+	if mods == 0 {
+		return func() {}, nil
+	}
+
+	if t.heldMods == HeldModsWait {
+		deadline := time.Now().Add(t.heldModsTimeout)
+		for mods != 0 {
+			if !time.Now().Before(deadline) {
+				return func() {}, fmt.Errorf("%w: %s", ErrModsHeld, mods)
+			}
+			if sleepContext(ctx, heldModsPoll) != nil {
+				return func() {}, stopError(ctx)
+			}
+			mods = heldMods(b, own)
+		}
+
+		return func() {}, nil
+	}
+
+	// A modifier key whose physical state is unknown is left released rather
+	// than risk leaving it stuck.
+	restore := func() {}
+	if physical, ok := b.(PhysicalKeyReporter); ok {
+		restore = func() {
+			for _, m := range modKeys {
+				if mods&m.mod != 0 && physical.PhysicalKeyIsDown(m.code) {
+					_ = pressKey(b, m.code)
+				}
+			}
+		}
+	}
+
+	var errs []error
+	for _, m := range modKeys {
+		if mods&m.mod != 0 {
+			if err := b.KeyRelease(m.code); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		restore()
+		return func() {}, err
+	}
+
+	return restore, nil
+}
+
+// heldMods returns the modifiers whose keys are down on b, except the ones of
+// own, if b has CapKeyState.
+func heldMods(b Backend, own map[KeyCode]bool) Mods {
+	if !b.Capabilities().Has(CapKeyState) {
+		return 0
+	}
+
+	var mods Mods
+	for _, m := range modKeys {
+		if !own[m.code] && b.KeyIsDown(m.code) {
+			mods |= m.mod
+		}
+	}
+
+	return mods
+}
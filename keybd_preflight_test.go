@@ -0,0 +1,217 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestTyperHeldMods(t *testing.T) {
+	tName := "Preflight"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	held := []keybd.RecordedEvent{
+		{Code: keybd.KEY_LEFTCTRL, Down: true},
+		{Code: keybd.KEY_RIGHTSHIFT, Down: true, Mods: keybd.ModCtrl},
+	}
+	mods := keybd.ModCtrl | keybd.ModRightShift
+
+	released := append(held,
+		keybd.RecordedEvent{Code: keybd.KEY_LEFTCTRL, Down: false, Mods: keybd.ModRightShift},
+		keybd.RecordedEvent{Code: keybd.KEY_RIGHTSHIFT, Down: false},
+		keybd.RecordedEvent{Code: keybd.KEY_H, Down: true},
+		keybd.RecordedEvent{Code: keybd.KEY_H, Down: false},
+	)
+
+	// The modifier keys are only pressed again if the backend can tell that
+	// they are still held physically, and ReleaseAll releases them.
+	scenes := []test.Scene{
+		{
+			Input: []any{keybd.HeldModsIgnore, false, mods},
+			Output: append(held,
+				keybd.RecordedEvent{Code: keybd.KEY_H, Down: true, Mods: mods},
+				keybd.RecordedEvent{Code: keybd.KEY_H, Down: false, Mods: mods},
+			),
+		},
+		{
+			Input:  []any{keybd.HeldModsRelease, false, keybd.Mods(0)},
+			Output: released,
+		},
+		{
+			Input: []any{keybd.HeldModsRelease, true, keybd.Mods(0)},
+			Output: append(released,
+				keybd.RecordedEvent{Code: keybd.KEY_LEFTCTRL, Down: true},
+				keybd.RecordedEvent{Code: keybd.KEY_RIGHTSHIFT, Down: true, Mods: keybd.ModCtrl},
+			),
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.([]any)
+
+			rec := keybd.NewRecorder()
+			_ = rec.KeyPress(keybd.KEY_LEFTCTRL)
+			_ = rec.KeyPress(keybd.KEY_RIGHTSHIFT)
+
+			var b keybd.Backend = rec
+			if in[1].(bool) {
+				b = &physicalKeys{Recorder: rec}
+			}
+
+			if got := keybd.HeldModsOn(rec); got != mods {
+				t.Errorf(test.ErrWantFGotF, mods, got)
+			}
+
+			typer := keybd.NewTyper(keybd.WithBackend(b), keybd.WithHeldMods(in[0].(keybd.HeldModsMode)))
+			if err := typer.Type(context.Background(), "h"); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+
+			if err := rec.EqualEvents(s.Output.([]keybd.RecordedEvent)); err != nil {
+				t.Error(err)
+			}
+
+			if err := keybd.ReleaseAll(); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+			if got, want := keybd.HeldModsOn(rec), in[2].(keybd.Mods); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+// physicalKeys is a [keybd.Recorder] that reports the keys of up as released
+// on the physical keyboard.
+type physicalKeys struct {
+	*keybd.Recorder
+	up map[keybd.KeyCode]bool
+}
+
+func (p *physicalKeys) PhysicalKeyIsDown(code keybd.KeyCode) bool { return !p.up[code] }
+
+func TestTyperHeldModsPhysical(t *testing.T) {
+	tName := "Preflight"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	t.Cleanup(func() { _ = keybd.ReleaseAll() })
+
+	rec := keybd.NewRecorder()
+	_ = rec.KeyPress(keybd.KEY_LEFTCTRL)
+	_ = rec.KeyPress(keybd.KEY_RIGHTSHIFT)
+
+	// Right Shift is released physically while typing, so it is not pressed
+	// again.
+	b := &physicalKeys{Recorder: rec, up: map[keybd.KeyCode]bool{keybd.KEY_RIGHTSHIFT: true}}
+	typer := keybd.NewTyper(keybd.WithBackend(b), keybd.WithHeldMods(keybd.HeldModsRelease))
+	if err := typer.Type(context.Background(), "h"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if !rec.KeyIsDown(keybd.KEY_LEFTCTRL) {
+		t.Errorf(test.ErrWantFGotF, true, false)
+	}
+	if rec.KeyIsDown(keybd.KEY_RIGHTSHIFT) {
+		t.Errorf(test.ErrWantFGotF, false, true)
+	}
+}
+
+func TestTyperHeldModsWait(t *testing.T) {
+	tName := "Preflight"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	_ = rec.KeyPress(keybd.KEY_LEFTALT)
+
+	typer := keybd.NewTyper(
+		keybd.WithBackend(rec),
+		keybd.WithHeldMods(keybd.HeldModsWait),
+		keybd.WithHeldModsTimeout(30*time.Millisecond),
+	)
+
+	err := typer.Type(context.Background(), "hi")
+	if !errors.Is(err, keybd.ErrModsHeld) {
+		t.Errorf(test.ErrWantFGotF, keybd.ErrModsHeld, err)
+	}
+	if got := len(rec.Events()); got != 1 {
+		t.Errorf(test.ErrWantFGotF, 1, got)
+	}
+
+	typer = keybd.NewTyper(
+		keybd.WithBackend(rec),
+		keybd.WithHeldMods(keybd.HeldModsWait),
+		keybd.WithHeldModsTimeout(5*time.Second),
+	)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = rec.KeyRelease(keybd.KEY_LEFTALT)
+	}()
+
+	start := time.Now()
+	if err := typer.Type(context.Background(), "hi"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf(test.ErrWantFGotF, ">= 50ms", d)
+	}
+	if err := rec.EqualText("hi"); err != nil {
+		t.Error(err)
+	}
+
+	_ = rec.KeyPress(keybd.KEY_LEFTALT)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	var stop *keybd.StopError
+	if err := typer.Type(ctx, "hi"); !errors.As(err, &stop) || stop.Offset != 0 || !errors.Is(err, keybd.ErrTimeout) {
+		t.Errorf(test.ErrWantFGotF, &keybd.StopError{Offset: 0, Err: keybd.ErrTimeout}, err)
+	}
+}
+
+func TestTyperHeldModsScript(t *testing.T) {
+	tName := "Preflight"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	t.Cleanup(func() { _ = keybd.ReleaseAll() })
+
+	rec := keybd.NewRecorder()
+	script, err := keybd.ParseScript("{Ctrl down}")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := keybd.RunScriptOn(rec, script); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if got := keybd.HeldModsOn(rec); got != 0 {
+		t.Errorf(test.ErrWantFGotF, keybd.Mods(0), got)
+	}
+
+	typer := keybd.NewTyper(
+		keybd.WithBackend(rec),
+		keybd.WithHeldMods(keybd.HeldModsWait),
+		keybd.WithHeldModsTimeout(30*time.Millisecond),
+	)
+	if err := typer.Type(context.Background(), "a"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if !rec.KeyIsDown(keybd.KEY_LEFTCTRL) {
+		t.Errorf(test.ErrWantFGotF, true, false)
+	}
+}
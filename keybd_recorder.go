@@ -0,0 +1,242 @@
+package keybd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A RecordedEvent is a struct that contains a key event captured by a
+// [Recorder].
+type RecordedEvent struct {
+	Code  KeyCode   // key code of the key
+	Down  bool      // true for a key-down event, false for a key-up event
+	Mods  Mods      // modifiers held when the event was sent
+	Locks Locks     // lock keys on when the event was sent
+	Time  time.Time // time the event was sent
+}
+
+// A Recorder is an in-memory [Backend] that captures every key event instead of
+// sending it anywhere. It translates runes using a US QWERTY layout, which
+// makes it suitable for deterministic tests on any platform. Its lock keys
+// toggle when they are pressed, like the ones of a PC keyboard.
+type Recorder struct {
+	events []RecordedEvent
+	down   map[KeyCode]bool
+	locks  Locks
+	mu     sync.Mutex
+}
+
+var (
+	_ Backend      = (*Recorder)(nil)
+	_ LockReporter = (*Recorder)(nil)
+)
+
+// NewRecorder creates a [Recorder] with no recorded events.
+func NewRecorder() *Recorder {
+	return &Recorder{down: make(map[KeyCode]bool)}
+}
+
+// Name returns the name the backend is registered under.
+func (*Recorder) Name() string { return "recorder" }
+
+// Capabilities returns the capability flags of the backend.
+func (*Recorder) Capabilities() Capabilities { return CapKeyState }
+
+// Close does nothing, since the recorder holds no resources.
+// It always returns nil.
+func (*Recorder) Close() error { return nil }
+
+// KeyPress records a key-down event for code with the modifiers and lock keys
+// in effect.
+// It always returns nil.
+func (rec *Recorder) KeyPress(code KeyCode) error { return rec.record(code, true) }
+
+// KeyRelease records a key-up event for code with the modifiers and lock keys
+// in effect.
+// It always returns nil.
+func (rec *Recorder) KeyRelease(code KeyCode) error { return rec.record(code, false) }
+
+// KeyIsDown detects the down state of code as it was last recorded.
+// It returns true if the key is currently depressed and false if it is not.
+func (rec *Recorder) KeyIsDown(code KeyCode) bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return rec.down[code]
+}
+
+// RuneToKeystroke translates r to a keystroke using a US QWERTY layout.
+// It returns a zero [Keystroke] with an error if the translation fails,
+// otherwise it returns the keystroke and a nil error.
+func (rec *Recorder) RuneToKeystroke(r rune) (Keystroke, error) {
+	return runeToKeystrokeUS(r)
+}
+
+// LockState returns the lock keys that are on, as toggled by the recorded
+// events or set with [Recorder.SetLocks].
+// It always returns a nil error.
+func (rec *Recorder) LockState() (Locks, error) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return rec.locks, nil
+}
+
+// SetLocks sets the lock keys that are on without recording any event, such as
+// to act as a keyboard that has Caps Lock on.
+func (rec *Recorder) SetLocks(locks Locks) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.locks = locks
+}
+
+// Events returns a copy of the events recorded so far.
+func (rec *Recorder) Events() []RecordedEvent {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return slices.Clone(rec.events)
+}
+
+// Reset discards the recorded events, releases every key, and turns the lock
+// keys off.
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.events = nil
+	clear(rec.down)
+	rec.locks = 0
+}
+
+// Text decodes the recorded key-down events into the text they type using a US
+// QWERTY layout, inverting the case of letters typed while Caps Lock is on. A
+// backspace removes the last decoded rune and keys that type nothing are
+// skipped.
+func (rec *Recorder) Text() string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	var text []rune
+	for _, e := range rec.events {
+		if !e.Down {
+			continue
+		}
+
+		if e.Code == KEY_BACKSPACE {
+			if len(text) > 0 {
+				text = text[:len(text)-1]
+			}
+			continue
+		}
+
+		mods := e.Mods.Generic()
+		if e.Locks&LockCaps != 0 && isCapsLetter(textUS[Keystroke{Code: e.Code}]) {
+			mods ^= ModShift
+		}
+		if r, ok := textUS[Keystroke{Code: e.Code, Mods: mods & ModShift}]; ok && mods&^ModShift == 0 {
+			text = append(text, r)
+		}
+	}
+
+	return string(text)
+}
+
+// EqualEvents compares the recorded events with want, ignoring their times.
+// It returns an error that describes the first difference, otherwise nil.
+func (rec *Recorder) EqualEvents(want []RecordedEvent) error {
+	got := rec.Events()
+
+	for i := range max(len(got), len(want)) {
+		switch {
+		case i >= len(got):
+			return fmt.Errorf("event #%d: want %v, got none", i, want[i])
+		case i >= len(want):
+			return fmt.Errorf("event #%d: want none, got %v", i, got[i])
+		}
+
+		g, w := got[i], want[i]
+		if g.Code != w.Code || g.Down != w.Down || g.Mods != w.Mods || g.Locks != w.Locks {
+			return fmt.Errorf("event #%d: want %v, got %v", i, w, g)
+		}
+	}
+
+	return nil
+}
+
+// EqualText compares the text decoded by [Recorder.Text] with want.
+// It returns an error that describes the difference, otherwise nil.
+func (rec *Recorder) EqualText(want string) error {
+	if got := rec.Text(); got != want {
+		return fmt.Errorf("text: want %q, got %q", want, got)
+	}
+
+	return nil
+}
+
+// String formats e as the key code, its direction, the held modifiers, and the
+// lock keys that are on.
+func (e RecordedEvent) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d", e.Code)
+	if e.Down {
+		b.WriteString(" down")
+	} else {
+		b.WriteString(" up")
+	}
+
+	if e.Mods != 0 {
+		fmt.Fprintf(&b, " mods=%#x", uint16(e.Mods))
+	}
+
+	if e.Locks != 0 {
+		fmt.Fprintf(&b, " locks=%s", e.Locks)
+	}
+
+	return b.String()
+}
+
+// record updates the down state of code, toggles the lock of a lock key that
+// is pressed, and appends the event along with the modifiers held and the lock
+// keys on when it was sent.
+func (rec *Recorder) record(code KeyCode, down bool) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	var mods Mods
+	for _, m := range modKeys {
+		if rec.down[m.code] && m.code != code {
+			mods |= m.mod
+		}
+	}
+
+	if down {
+		for _, k := range lockKeys {
+			if k.code == code && !rec.down[code] {
+				rec.locks ^= k.lock
+			}
+		}
+		rec.down[code] = true
+	} else {
+		delete(rec.down, code)
+	}
+
+	rec.events = append(rec.events, RecordedEvent{
+		Code:  code,
+		Down:  down,
+		Mods:  mods,
+		Locks: rec.locks,
+		Time:  time.Now(),
+	})
+
+	return nil
+}
+
+func init() {
+	RegisterBackend("recorder", func() (Backend, error) { return NewRecorder(), nil })
+}
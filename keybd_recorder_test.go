@@ -0,0 +1,96 @@
+package keybd_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestRecorderEvents(t *testing.T) {
+	tName := "Recorder"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	if err := keybd.TypeStrOn(rec, "kK"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	want := []keybd.RecordedEvent{
+		{Code: keybd.KEY_K, Down: true},
+		{Code: keybd.KEY_K, Down: false},
+		{Code: keybd.KEY_LEFTSHIFT, Down: true},
+		{Code: keybd.KEY_K, Down: true, Mods: keybd.ModShift},
+		{Code: keybd.KEY_K, Down: false, Mods: keybd.ModShift},
+		{Code: keybd.KEY_LEFTSHIFT, Down: false},
+	}
+	if err := rec.EqualEvents(want); err != nil {
+		t.Error(err)
+	}
+
+	events := rec.Events()
+	for i := 1; i < len(events); i++ {
+		if events[i].Time.Before(events[i-1].Time) {
+			t.Errorf(test.ErrWantFGotF, events[i-1].Time, events[i].Time)
+		}
+	}
+
+	rec.Reset()
+	if err := rec.EqualEvents(nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRecorderTypeStr(t *testing.T) {
+	tName := "Recorder"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{Input: testStrings["shortWord"], Output: testStrings["shortWord"]},
+		{Input: testStrings["complexWord"], Output: testStrings["complexWord"]},
+		{Input: testStrings["shortSentence"], Output: testStrings["shortSentence"]},
+		{Input: testStrings["multiLineStringWithTabs"], Output: testStrings["multiLineStringWithTabs"]},
+		{Input: testStrings["multiLineStringWithSpaces"], Output: testStrings["multiLineStringWithSpaces"]},
+		{Input: testStrings["shortSentence"] + "\r\n", Output: testStrings["shortSentence"] + "\n"},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			rec := keybd.NewRecorder()
+			if err := keybd.TypeStrOn(rec, s.Input.(string)); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+			if err := rec.EqualText(s.Output.(string)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRecorderTypeStrWithOpts(t *testing.T) {
+	tName := "Recorder"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	tabsToSpaces, tabSize := keybd.TypeString.TabsToSpaces, keybd.TypeString.TabSize
+	t.Cleanup(func() {
+		keybd.TypeString.TabsToSpaces, keybd.TypeString.TabSize = tabsToSpaces, tabSize
+	})
+
+	keybd.TypeString.TabsToSpaces = true
+	keybd.TypeString.TabSize = 4
+
+	rec := keybd.NewRecorder()
+	if err := keybd.TypeStrOn(rec, testStrings["multiLineStringWithTabs"]); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := rec.EqualText(testStrings["multiLineStringWithSpaces"]); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,140 @@
+package keybd
+
+import (
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// heldKeys tracks the keys that the package pressed on every backend and has
+// not released yet, so that they can be released when a call stops early and
+// by [ReleaseAll].
+var heldKeys struct {
+	keys map[Backend]map[KeyCode]bool
+	mu   sync.Mutex
+}
+
+// ReleaseAll releases every key that the package pressed on any backend and
+// has not released yet, such as a key left down by a script or by a call that
+// was interrupted. Keys pressed with the platform functions that take native
+// key codes, such as [KeyPress], are not tracked. A key whose release fails
+// stays tracked, so that ReleaseAll can be called again.
+// It returns an error if a release fails.
+func ReleaseAll() error {
+	heldKeys.mu.Lock()
+	backends := slices.Collect(maps.Keys(heldKeys.keys))
+	heldKeys.mu.Unlock()
+
+	var errs []error
+	for _, b := range backends {
+		if err := releaseHeld(b, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// pressKey sends a key-down event for code to b and tracks code as held.
+func pressKey(b Backend, code KeyCode) error {
+	err := b.KeyPress(code)
+	trackKey(b, code, true)
+
+	return err
+}
+
+// releaseKey sends a key-up event for code to b and stops tracking code once
+// it is released.
+func releaseKey(b Backend, code KeyCode) error {
+	err := b.KeyRelease(code)
+	if err == nil {
+		trackKey(b, code, false)
+	}
+
+	return err
+}
+
+// trackKey tracks code as held on b if down is true, or as released otherwise.
+// Backends that cannot be map keys are not tracked.
+func trackKey(b Backend, code KeyCode, down bool) {
+	if !reflect.TypeOf(b).Comparable() {
+		return
+	}
+
+	heldKeys.mu.Lock()
+	defer heldKeys.mu.Unlock()
+
+	keys := heldKeys.keys[b]
+	if !down {
+		delete(keys, code)
+		if len(keys) == 0 {
+			delete(heldKeys.keys, b)
+		}
+		return
+	}
+
+	if keys == nil {
+		if heldKeys.keys == nil {
+			heldKeys.keys = make(map[Backend]map[KeyCode]bool)
+		}
+		keys = make(map[KeyCode]bool)
+		heldKeys.keys[b] = keys
+	}
+	keys[code] = true
+}
+
+// heldOn returns a copy of the keys tracked as held on b.
+func heldOn(b Backend) map[KeyCode]bool {
+	if !reflect.TypeOf(b).Comparable() {
+		return nil
+	}
+
+	heldKeys.mu.Lock()
+	defer heldKeys.mu.Unlock()
+
+	return maps.Clone(heldKeys.keys[b])
+}
+
+// releaseHeld releases the keys tracked as held on b except the ones of keep,
+// the modifier keys last.
+// It returns an error if a release fails.
+func releaseHeld(b Backend, keep map[KeyCode]bool) error {
+	var codes []KeyCode
+	for code := range heldOn(b) {
+		if !keep[code] {
+			codes = append(codes, code)
+		}
+	}
+
+	slices.SortFunc(codes, func(a, b KeyCode) int {
+		if isModKey(a) != isModKey(b) {
+			if isModKey(a) {
+				return 1
+			}
+			return -1
+		}
+		return int(a) - int(b)
+	})
+
+	var errs []error
+	for _, code := range codes {
+		if err := releaseKey(b, code); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isModKey reports whether code is the key of a modifier flag.
+func isModKey(code KeyCode) bool {
+	for _, m := range modKeys {
+		if m.code == code {
+			return true
+		}
+	}
+
+	return false
+}
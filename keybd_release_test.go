@@ -0,0 +1,162 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+// failingRecorder is a [keybd.Recorder] whose key-up events fail while fail is
+// set.
+type failingRecorder struct {
+	*keybd.Recorder
+	fail bool
+}
+
+func (f *failingRecorder) KeyRelease(code keybd.KeyCode) error {
+	if f.fail {
+		return keybd.ErrUnknown
+	}
+
+	return f.Recorder.KeyRelease(code)
+}
+
+// heldKeys returns the keys that rec holds down.
+func heldKeys(rec *keybd.Recorder) []keybd.KeyCode {
+	var held []keybd.KeyCode
+	for code := range keybd.KeyCode(0x300) {
+		if rec.KeyIsDown(code) {
+			held = append(held, code)
+		}
+	}
+
+	return held
+}
+
+func TestTyperReleasesKeys(t *testing.T) {
+	tName := "Release"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			// A panic of the observer while Shift is held.
+			Input: func(rec *keybd.Recorder) error {
+				typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithObserver(func(e keybd.TypeEvent) {
+					if e.Rune == 'B' {
+						panic("observer failed")
+					}
+				}))
+				return typer.Type(context.Background(), "ABC")
+			},
+			Output: keybd.ErrUncaught,
+		},
+		{
+			// A timeout while a key is held.
+			Input: func(rec *keybd.Recorder) error {
+				typer := keybd.NewTyper(
+					keybd.WithBackend(rec),
+					keybd.WithRhythm(keybd.FixedRhythm(50*time.Millisecond, 0)),
+					keybd.WithTimeout(10*time.Millisecond),
+				)
+				return typer.Type(context.Background(), "AB")
+			},
+			Output: keybd.ErrTimeout,
+		},
+		{
+			// An abort of a script with a key pressed by a down command.
+			Input: func(rec *keybd.Recorder) error {
+				s, err := keybd.ParseScript("{Ctrl down}ab{Ctrl up}")
+				if err != nil {
+					return err
+				}
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithObserver(func(e keybd.TypeEvent) {
+					if e.Rune == 'a' {
+						cancel()
+					}
+				}))
+				return typer.Run(ctx, s)
+			},
+			Output: keybd.ErrAborted,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			rec := keybd.NewRecorder()
+
+			// Keys held before the call are left alone.
+			if err := rec.KeyPress(keybd.KEY_F1); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+
+			if err := s.Input.(func(*keybd.Recorder) error)(rec); !errors.Is(err, s.Output.(error)) {
+				t.Fatalf(test.ErrWantFGotF, s.Output, err)
+			}
+
+			if held := heldKeys(rec); len(held) != 1 || held[0] != keybd.KEY_F1 {
+				t.Errorf(test.ErrWantFGotF, []keybd.KeyCode{keybd.KEY_F1}, held)
+			}
+		})
+	}
+}
+
+func TestReleaseAll(t *testing.T) {
+	tName := "Release"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	s, err := keybd.ParseScript("{Shift down}{A down}")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	b := &failingRecorder{Recorder: keybd.NewRecorder()}
+	typer := keybd.NewTyper(keybd.WithBackend(b))
+
+	// A script that succeeds keeps its keys down.
+	if err := typer.Run(context.Background(), s); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if held := heldKeys(b.Recorder); len(held) != 2 {
+		t.Fatalf(test.ErrWantFGotF, 2, held)
+	}
+
+	// Keys whose release fails stay tracked.
+	b.fail = true
+	if err := keybd.ReleaseAll(); !errors.Is(err, keybd.ErrUnknown) {
+		t.Fatalf(test.ErrWantFGotF, keybd.ErrUnknown, err)
+	}
+
+	b.fail = false
+	if err := keybd.ReleaseAll(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if held := heldKeys(b.Recorder); len(held) != 0 {
+		t.Errorf(test.ErrWantFGotF, 0, held)
+	}
+
+	// Modifier keys are released last.
+	events := b.Events()
+	if got := events[len(events)-1]; got.Code != keybd.KEY_LEFTSHIFT || got.Down {
+		t.Errorf(test.ErrWantFGotF, keybd.KEY_LEFTSHIFT, got)
+	}
+
+	if err := keybd.ReleaseAll(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if got := len(b.Events()); got != len(events) {
+		t.Errorf(test.ErrWantFGotF, len(events), got)
+	}
+}
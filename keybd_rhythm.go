@@ -0,0 +1,164 @@
+package keybd
+
+import (
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// rhythmHoldShare is the share of the time per key that a key is held for by
+// the rhythms of [WPMRhythm] and [BigramRhythm].
+const rhythmHoldShare = 0.4
+
+// Factors by which [BigramRhythm] scales the gap between two keys.
+const (
+	bigramCommon    = 0.6  // common English digraph, such as "th"
+	bigramCrossHand = 1.25 // keys typed by different hands
+	bigramShift     = 1.3  // next key is typed with Shift
+	bigramSymbol    = 1.2  // next key is a digit or a symbol
+)
+
+// Keys of a US QWERTY keyboard typed by the left and the right hand.
+const (
+	leftHandKeys  = "`12345qwertasdfgzxcvb~!@#$%"
+	rightHandKeys = "67890-=yuiop[]\\hjkl;'nm,./^&*()_+{}|:\"<>?"
+)
+
+// commonBigrams lists the most frequent digraphs of English text.
+var commonBigrams = map[[2]rune]bool{}
+
+// A Rhythm is an interface that times typing: how long every key is held and
+// how long to wait between keys. A [Typer] with a Rhythm uses it instead of
+// its key press duration and key delay.
+type Rhythm interface {
+	// Hold returns how long to hold the key that types r.
+	Hold(r rune) time.Duration
+
+	// Gap returns how long to wait after releasing the key that types prev
+	// and before pressing the key that types next.
+	Gap(prev, next rune) time.Duration
+}
+
+// FixedRhythm returns a [Rhythm] that holds every key for hold and waits gap
+// between keys, the timing of [WithKeyPressDuration] and [WithKeyDelay].
+func FixedRhythm(hold, gap time.Duration) Rhythm { return fixedRhythm{hold: hold, gap: gap} }
+
+// WPMRhythm returns a [Rhythm] that types wpm words per minute, a word being
+// five keys. The hold and gap of every key are drawn from a normal
+// distribution whose standard deviation is jitter times its mean, such as 0.2
+// for 20%, with a random source seeded with seed, so that the same seed times
+// the same text the same way. A Rhythm of WPMRhythm is safe for concurrent use.
+func WPMRhythm(wpm, jitter float64, seed uint64) Rhythm {
+	return newWPMRhythm(wpm, jitter, seed, false)
+}
+
+// BigramRhythm returns a [Rhythm] like [WPMRhythm] whose gaps depend on the
+// pair of keys: shorter for common English digraphs such as "th", and longer
+// for keys typed by different hands of a US QWERTY keyboard, keys typed with
+// Shift, and digits and symbols. A Rhythm of BigramRhythm is safe for
+// concurrent use.
+func BigramRhythm(wpm, jitter float64, seed uint64) Rhythm {
+	return newWPMRhythm(wpm, jitter, seed, true)
+}
+
+// fixedRhythm is the [Rhythm] of [FixedRhythm].
+type fixedRhythm struct {
+	hold, gap time.Duration
+}
+
+func (f fixedRhythm) Hold(rune) time.Duration     { return f.hold }
+func (f fixedRhythm) Gap(_, _ rune) time.Duration { return f.gap }
+
+// wpmRhythm is the [Rhythm] of [WPMRhythm] and [BigramRhythm].
+type wpmRhythm struct {
+	hold    time.Duration // mean hold
+	gap     time.Duration // mean gap
+	jitter  float64
+	bigrams bool
+	rng     *rand.Rand
+	mu      sync.Mutex
+}
+
+// newWPMRhythm is the base function for WPMRhythm and BigramRhythm that splits
+// the time per key of wpm into its hold and gap.
+func newWPMRhythm(wpm, jitter float64, seed uint64, bigrams bool) *wpmRhythm {
+	perKey := time.Duration(float64(time.Minute) / (5 * max(wpm, 1)))
+	hold := time.Duration(float64(perKey) * rhythmHoldShare)
+
+	return &wpmRhythm{
+		hold:    hold,
+		gap:     perKey - hold,
+		jitter:  max(jitter, 0),
+		bigrams: bigrams,
+		rng:     rand.New(rand.NewPCG(seed, 0)),
+	}
+}
+
+func (w *wpmRhythm) Hold(rune) time.Duration { return w.draw(w.hold) }
+
+func (w *wpmRhythm) Gap(prev, next rune) time.Duration {
+	mean := w.gap
+	if w.bigrams {
+		mean = time.Duration(float64(mean) * bigramFactor(prev, next))
+	}
+
+	return w.draw(mean)
+}
+
+// draw returns a duration drawn from the normal distribution around mean,
+// bounded below by a quarter of mean.
+func (w *wpmRhythm) draw(mean time.Duration) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	d := time.Duration(float64(mean) * (1 + w.jitter*w.rng.NormFloat64()))
+
+	return max(d, mean/4)
+}
+
+// bigramFactor returns the factor by which the gap between typing prev and
+// next is scaled.
+func bigramFactor(prev, next rune) float64 {
+	factor := 1.0
+
+	lower := [2]rune{unicode.ToLower(prev), unicode.ToLower(next)}
+	switch {
+	case commonBigrams[lower]:
+		factor *= bigramCommon
+	case hand(lower[0]) != 0 && hand(lower[1]) != 0 && hand(lower[0]) != hand(lower[1]):
+		factor *= bigramCrossHand
+	}
+
+	switch {
+	case unicode.IsUpper(next) || strings.ContainsRune("~!@#$%^&*()_+{}|:\"<>?", next):
+		factor *= bigramShift
+	case !unicode.IsLetter(next) && !unicode.IsSpace(next):
+		factor *= bigramSymbol
+	}
+
+	return factor
+}
+
+// hand returns the hand that types r on a US QWERTY keyboard, -1 for the left
+// and 1 for the right, or 0 if r is typed with a thumb or not at all.
+func hand(r rune) int {
+	switch {
+	case strings.ContainsRune(leftHandKeys, r):
+		return -1
+	case strings.ContainsRune(rightHandKeys, r):
+		return 1
+	}
+
+	return 0
+}
+
+func init() {
+	for _, bigram := range strings.Fields(`th he in er an re on at en nd ti es or te
+		of ed is it al ar st to nt ng se ha as ou io le ve co me de hi ri ro ic ne
+		ea ra ce`) {
+		r := []rune(bigram)
+		commonBigrams[[2]rune{r[0], r[1]}] = true
+	}
+}
@@ -0,0 +1,187 @@
+package keybd_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+// loggingRhythm is a [keybd.Rhythm] that logs the keys it times and returns
+// no delay.
+type loggingRhythm struct {
+	holds []rune
+	gaps  [][2]rune
+	mu    sync.Mutex
+}
+
+func (l *loggingRhythm) Hold(r rune) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.holds = append(l.holds, r)
+
+	return 0
+}
+
+func (l *loggingRhythm) Gap(prev, next rune) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.gaps = append(l.gaps, [2]rune{prev, next})
+
+	return 0
+}
+
+func TestFixedRhythm(t *testing.T) {
+	tName := "Rhythm"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	r := keybd.FixedRhythm(3*time.Millisecond, 5*time.Millisecond)
+
+	if got, want := r.Hold('a'), 3*time.Millisecond; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := r.Gap('a', 'b'), 5*time.Millisecond; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestWPMRhythm(t *testing.T) {
+	tName := "Rhythm"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	// Without jitter, a key takes 60 s / (5 * 60) = 200 ms, 40% of it held.
+	exact := keybd.WPMRhythm(60, 0, 1)
+	if got, want := exact.Hold('a'), 80*time.Millisecond; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := exact.Gap('a', 'b'), 120*time.Millisecond; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	timings := func(r keybd.Rhythm) []time.Duration {
+		var d []time.Duration
+		for range 1000 {
+			d = append(d, r.Hold('a'), r.Gap('a', 'b'))
+		}
+		return d
+	}
+
+	// The same seed times the same keys the same way.
+	a, b := timings(keybd.WPMRhythm(60, 0.2, 42)), timings(keybd.WPMRhythm(60, 0.2, 42))
+	if !slices.Equal(a, b) {
+		t.Errorf(test.ErrWantFGotF, "equal timings", "different timings")
+	}
+	if c := timings(keybd.WPMRhythm(60, 0.2, 43)); slices.Equal(a, c) {
+		t.Errorf(test.ErrWantFGotF, "different timings", "equal timings")
+	}
+
+	// The jitter averages out to the requested speed.
+	var total time.Duration
+	for _, d := range a {
+		total += d
+	}
+	if perKey := total / 1000; perKey < 190*time.Millisecond || perKey > 210*time.Millisecond {
+		t.Errorf(test.ErrWantFGotF, 200*time.Millisecond, perKey)
+	}
+	if slices.Min(a) == slices.Max(a) {
+		t.Errorf(test.ErrWantFGotF, "jitter", "none")
+	}
+}
+
+func TestBigramRhythm(t *testing.T) {
+	tName := "Rhythm"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	base := 120 * time.Millisecond
+	r := keybd.BigramRhythm(60, 0, 1)
+
+	scenes := []test.Scene{
+		{Input: "ag", Output: base},                       // same hand
+		{Input: "th", Output: base * 6 / 10},              // common digraph
+		{Input: "Th", Output: base * 6 / 10},              // common digraph
+		{Input: "aj", Output: base * 125 / 100},           // other hand
+		{Input: "aD", Output: base * 13 / 10},             // Shift
+		{Input: "a5", Output: base * 12 / 10},             // digit
+		{Input: "a!", Output: base * 13 / 10},             // shifted symbol
+		{Input: "a ", Output: base},                       // thumb
+		{Input: "jA", Output: base * 125 / 100 * 13 / 10}, // other hand with Shift
+		{Input: "h;", Output: base * 12 / 10},             // symbol on the same hand
+		{Input: "ée", Output: base},                       // unknown hand
+		{Input: "e\n", Output: base},                      // Enter
+		{Input: "o,", Output: base * 12 / 10},             // punctuation
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := []rune(s.Input.(string))
+			got, want := r.Gap(in[0], in[1]), s.Output.(time.Duration)
+			if diff := got - want; diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestTyperWithRhythm(t *testing.T) {
+	tName := "Rhythm"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	rhythm := &loggingRhythm{}
+	typer := keybd.NewTyper(
+		keybd.WithBackend(rec),
+		keybd.WithRhythm(rhythm),
+		keybd.WithKeyDelay(time.Hour),
+		keybd.WithKeyPressDuration(time.Hour),
+		keybd.WithModPressDuration(0),
+	)
+
+	if err := typer.Type(context.Background(), "Hi!"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := rec.EqualText("Hi!"); err != nil {
+		t.Error(err)
+	}
+
+	if want := []rune("Hi!"); !slices.Equal(rhythm.holds, want) {
+		t.Errorf(test.ErrWantFGotF, string(want), string(rhythm.holds))
+	}
+	if want := [][2]rune{{'H', 'i'}, {'i', '!'}}; !slices.Equal(rhythm.gaps, want) {
+		t.Errorf(test.ErrWantFGotF, want, rhythm.gaps)
+	}
+
+	// The hold of the rhythm is how long the recorder sees the key down.
+	rec.Reset()
+	typer = keybd.NewTyper(
+		keybd.WithBackend(rec),
+		keybd.WithRhythm(keybd.FixedRhythm(5*time.Millisecond, 0)),
+		keybd.WithModPressDuration(0),
+	)
+
+	if err := typer.Type(context.Background(), "a"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	events := rec.Events()
+	if len(events) != 2 {
+		t.Fatalf(test.ErrWantFGotF, 2, len(events))
+	}
+	if held := events[1].Time.Sub(events[0].Time); held < 5*time.Millisecond {
+		t.Errorf(test.ErrWantFGotF, 5*time.Millisecond, held)
+	}
+}
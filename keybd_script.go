@@ -0,0 +1,317 @@
+package keybd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Constants for the kinds of script operations.
+const (
+	opText = iota
+	opTap
+	opCombo
+	opPress
+	opRelease
+	opDelay
+)
+
+// A Script is a compiled key sequence. Scripts are made of literal text and
+// commands in braces:
+//
+//	Hello{Enter}{Delay 200}{Ctrl down}a{Ctrl up}{Tab 3}{Ctrl+Shift+T}
+//
+// Literal text is typed like [TypeStr] types it. A key name in braces, such as
+// {Enter}, taps the key, and {Enter 3} taps it three times. {Ctrl down} and
+// {Ctrl up} press and release a key without tapping it. A key combination in
+// braces, such as {Ctrl+Shift+T}, is sent like [SendComboOn] sends it.
+// {Delay 200} pauses for 200 ms. Key names are the ones understood by
+// [ParseCombo] and are not case sensitive. {{} and {}} type literal braces.
+type Script struct {
+	src string
+	ops []scriptOp
+}
+
+// A scriptOp is a struct that contains a compiled script operation.
+type scriptOp struct {
+	kind  int
+	pos   int
+	text  string
+	code  KeyCode
+	combo Combo
+	count int
+	delay time.Duration
+}
+
+// A ScriptError is a struct that describes a syntax error in a script.
+type ScriptError struct {
+	Offset int    // byte offset of the error
+	Line   int    // line of the error, starting at 1
+	Column int    // column of the error in runes, starting at 1
+	Msg    string // description of the error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("script:%d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+func (e *ScriptError) Unwrap() error { return ErrInvalidScript }
+
+// ParseScript compiles src into a [Script].
+// It returns nil with a [ScriptError] if the parsing fails.
+func ParseScript(src string) (*Script, error) {
+	s := &Script{src: src}
+
+	var (
+		text    strings.Builder
+		textPos int
+	)
+
+	addText := func(pos int, str string) {
+		if text.Len() == 0 {
+			textPos = pos
+		}
+		text.WriteString(str)
+	}
+
+	flush := func() {
+		if text.Len() > 0 {
+			s.ops = append(s.ops, scriptOp{kind: opText, pos: textPos, text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(src); {
+		switch {
+		case strings.HasPrefix(src[i:], "{{}"):
+			addText(i, "{")
+			i += 3
+		case strings.HasPrefix(src[i:], "{}}"):
+			addText(i, "}")
+			i += 3
+		case src[i] == '{':
+			end := strings.IndexByte(src[i+1:], '}')
+			if end < 0 {
+				return nil, newScriptError(src, i, "unclosed brace")
+			}
+
+			op, err := parseCommand(src, i+1, i+1+end)
+			if err != nil {
+				return nil, err
+			}
+
+			flush()
+			s.ops = append(s.ops, op)
+			i += end + 2
+		case src[i] == '}':
+			return nil, newScriptError(src, i, "unexpected '}'")
+		default:
+			_, n := utf8.DecodeRuneInString(src[i:])
+			addText(i, src[i:i+n])
+			i += n
+		}
+	}
+
+	flush()
+
+	return s, nil
+}
+
+// String returns the source of s.
+func (s *Script) String() string { return s.src }
+
+// RunScriptOn runs s on b using [TypeString] options. A timeout prevents the
+// function call from hanging indefinitely while an abort channel allows
+// aborting the operation. Keys pressed with a down command are released when
+// the script is aborted.
+// It returns an error if the call fails.
+func RunScriptOn(b Backend, s *Script) error {
+	ctx, cancel := abortContext()
+	defer cancel()
+
+	return RunScriptOnContext(ctx, b, s)
+}
+
+// RunScriptOnContext runs s on b using [TypeString] options until it is done
+// or ctx is done. Unlike [RunScriptOn], it is not aborted by [AbortTypeStr].
+// It returns an error if the call fails.
+func RunScriptOnContext(ctx context.Context, b Backend, s *Script) error {
+	return typeStringTyper(b).Run(ctx, s)
+}
+
+// Run runs s until it is done, the timeout of t is exceeded, or ctx is done.
+// It pauses between operations like [Typer.Type], keeping the keys pressed
+// with a down command held. Those keys are released when the script stops
+// early. The errors of an operation are prefixed with its line and column in
+// the script, such as "script:2:5: ", and the index of a [TypeError] counts
+// the runes of the text that starts there.
+// It returns an error if the call fails.
+func (t *Typer) Run(ctx context.Context, s *Script) error {
+	var n int
+	for _, op := range s.ops {
+		n += GraphemeCount(op.text)
+	}
+
+	if n > t.maxCharacters {
+		return ErrMaxCharacter
+	}
+
+	return t.run(ctx, func(ctx context.Context, b Backend) error {
+		return t.runScript(ctx, b, s)
+	})
+}
+
+// runScript is the base function for Run that performs the operations of s.
+func (t *Typer) runScript(ctx context.Context, b Backend, s *Script) error {
+	var errs []error
+
+	// Keys pressed with a down command are released by run when the script
+	// stops early.
+	for i, op := range s.ops {
+		if err := t.pause.wait(ctx); err != nil {
+			return errors.Join(append(errs, stopError(ctx))...)
+		}
+
+		var err error
+		switch op.kind {
+		case opText:
+			_, err = t.typeStr(ctx, b, op.text, 0, nil)
+		case opTap, opCombo:
+			for n := range op.count {
+				if n > 0 {
+					time.Sleep(t.keyDelay)
+				}
+				if op.kind == opTap {
+					err = errors.Join(err, keyTap(ctx, b, op.code, t.keyPressDuration))
+				} else {
+					err = errors.Join(err, sendPlan(b, op.combo.Plan(), t.modPressDuration, t.keyPressDuration))
+				}
+			}
+		case opPress:
+			err = pressKey(b, op.code)
+		case opRelease:
+			err = releaseKey(b, op.code)
+		case opDelay:
+			_ = sleepContext(ctx, op.delay)
+			continue
+		}
+
+		if err != nil {
+			line, col := position(s.src, op.pos)
+			errs = append(errs, fmt.Errorf("script:%d:%d: %w", line, col, err))
+		}
+
+		if i < len(s.ops)-1 {
+			time.Sleep(t.keyDelay)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseCommand compiles the command between the braces at src[start:end].
+func parseCommand(src string, start, end int) (scriptOp, error) {
+	body := src[start:end]
+	fields := strings.Fields(body)
+
+	fieldPos := func(i int) int {
+		pos := start
+		for j := range i + 1 {
+			pos += strings.Index(src[pos:end], fields[j])
+			if j < i {
+				pos += len(fields[j])
+			}
+		}
+		return pos
+	}
+
+	switch len(fields) {
+	case 0:
+		return scriptOp{}, newScriptError(src, start-1, "empty command")
+	case 1, 2:
+	default:
+		return scriptOp{}, newScriptError(src, fieldPos(2), "too many arguments")
+	}
+
+	op := scriptOp{pos: start - 1, count: 1}
+	name := strings.ToLower(fields[0])
+
+	var arg string
+	if len(fields) == 2 {
+		arg = strings.ToLower(fields[1])
+	}
+
+	if name == "delay" {
+		ms, err := strconv.Atoi(arg)
+		if err != nil || ms < 0 {
+			return scriptOp{}, newScriptError(src, fieldPos(len(fields)-1), "delay needs a duration in milliseconds")
+		}
+
+		op.kind = opDelay
+		op.delay = time.Duration(ms) * time.Millisecond
+
+		return op, nil
+	}
+
+	if strings.Contains(name, "+") {
+		c, err := ParseCombo(name)
+		if err != nil {
+			return scriptOp{}, newScriptError(src, fieldPos(0), err.Error())
+		}
+
+		op.kind = opCombo
+		op.combo = c
+	} else {
+		code, ok := keyCodesByName[name]
+		if mod, isMod := modName(name); isMod {
+			code, ok = modKey(mod), true
+		}
+		if !ok {
+			return scriptOp{}, newScriptError(src, fieldPos(0), fmt.Sprintf("unknown key %q", fields[0]))
+		}
+
+		op.kind = opTap
+		op.code = code
+	}
+
+	switch {
+	case arg == "":
+	case arg == "down" || arg == "up":
+		if op.kind == opCombo {
+			return scriptOp{}, newScriptError(src, fieldPos(1), "a key combination cannot be held")
+		}
+
+		op.kind = opPress
+		if arg == "up" {
+			op.kind = opRelease
+		}
+	default:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return scriptOp{}, newScriptError(src, fieldPos(1), fmt.Sprintf("invalid argument %q", fields[1]))
+		}
+		op.count = n
+	}
+
+	return op, nil
+}
+
+// newScriptError creates a [ScriptError] for the byte offset pos of src.
+func newScriptError(src string, pos int, msg string) *ScriptError {
+	line, col := position(src, pos)
+	return &ScriptError{Offset: pos, Line: line, Column: col, Msg: msg}
+}
+
+// position translates the byte offset pos of src to a line and a column in
+// runes, both starting at 1.
+func position(src string, pos int) (line, col int) {
+	before := src[:pos]
+	line = strings.Count(before, "\n") + 1
+	col = utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+
+	return line, col
+}
@@ -0,0 +1,183 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestParseScript(t *testing.T) {
+	tName := "Script"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{Input: "Hello{Enter}{Delay 200}{Ctrl down}a{Ctrl up}{Tab 3}", Passing: true},
+		{Input: "{ctrl+shift+t}{{}x{}}{ESC 0}", Passing: true},
+		{Input: "Hello{Entr}", Output: []int{1, 7}},
+		{Input: "ok\nab{Delay}", Output: []int{2, 4}},
+		{Input: "ok\nab{Delay soon}", Output: []int{2, 10}},
+		{Input: "{Tab  many}", Output: []int{1, 7}},
+		{Input: "{Ctrl+Shift down}", Output: []int{1, 13}},
+		{Input: "{Enter 1 2}", Output: []int{1, 10}},
+		{Input: "é{Enter", Output: []int{1, 2}},
+		{Input: "a}b", Output: []int{1, 2}},
+		{Input: "{ }", Output: []int{1, 1}},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			_, err := keybd.ParseScript(s.Input.(string))
+
+			if s.Passing {
+				if err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+				return
+			}
+
+			var scriptErr *keybd.ScriptError
+			if !errors.As(err, &scriptErr) || !errors.Is(err, keybd.ErrInvalidScript) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrInvalidScript, err)
+			}
+			if got, want := []int{scriptErr.Line, scriptErr.Column}, s.Output.([]int); got[0] != want[0] || got[1] != want[1] {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestRunScriptOn(t *testing.T) {
+	tName := "Script"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:  "Hello{Enter}{Delay 20}{Shift down}a{Shift up}{Tab 3}{{}x{}}",
+			Output: "Hello\nA\t\t\t{x}",
+		},
+		{
+			Input:  "typo{Backspace 2}{BACKSPACE}e",
+			Output: "te",
+		},
+		{
+			Input:  strings.NewReplacer("{", "{{}", "}", "{}}").Replace(testStrings["multiLineStringWithTabs"]),
+			Output: testStrings["multiLineStringWithTabs"],
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			script, err := keybd.ParseScript(s.Input.(string))
+			if err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+
+			rec := keybd.NewRecorder()
+			if err := keybd.RunScriptOn(rec, script); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+			if err := rec.EqualText(s.Output.(string)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRunScriptOnCombo(t *testing.T) {
+	tName := "Script"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	script, err := keybd.ParseScript("{Ctrl+T}")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	rec := keybd.NewRecorder()
+	if err := keybd.RunScriptOn(rec, script); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	err = rec.EqualEvents([]keybd.RecordedEvent{
+		{Code: keybd.KEY_LEFTCTRL, Down: true},
+		{Code: keybd.KEY_T, Down: true, Mods: keybd.ModCtrl},
+		{Code: keybd.KEY_T, Down: false, Mods: keybd.ModCtrl},
+		{Code: keybd.KEY_LEFTCTRL, Down: false},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunScriptOnContext(t *testing.T) {
+	tName := "Script"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	script, err := keybd.ParseScript("{Ctrl down}{Delay 5000}a{Ctrl up}")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	rec := keybd.NewRecorder()
+	if err := keybd.RunScriptOnContext(ctx, rec, script); !errors.Is(err, keybd.ErrTimeout) {
+		t.Fatalf(test.ErrWantFGotF, keybd.ErrTimeout, err)
+	}
+
+	// The held key is released once the delay notices the deadline.
+	deadline := time.Now().Add(time.Second)
+	for rec.KeyIsDown(keybd.KEY_LEFTCTRL) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if rec.KeyIsDown(keybd.KEY_LEFTCTRL) {
+		t.Errorf(test.ErrWantFGotF, false, true)
+	}
+	if err := rec.EqualText(""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunScriptOnContextErrors(t *testing.T) {
+	tName := "Script"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	script, err := keybd.ParseScript("a\n b€{Delay 5000}c")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// The rune that failed before the timeout is reported along with it.
+	rec := keybd.NewRecorder()
+	err = keybd.RunScriptOnContext(ctx, rec, script)
+	if !errors.Is(err, keybd.ErrTimeout) {
+		t.Fatalf(test.ErrWantFGotF, keybd.ErrTimeout, err)
+	}
+
+	var typeErr *keybd.TypeError
+	if !errors.As(err, &typeErr) || typeErr.Index != 4 {
+		t.Fatalf(test.ErrWantFGotF, 4, err)
+	}
+	if want := "script:1:1: "; !strings.Contains(err.Error(), want) {
+		t.Errorf(test.ErrWantFGotF, want, err)
+	}
+}
@@ -0,0 +1,160 @@
+package keybd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Constants for the strategies that type a rune, in the order they are tried
+// by default.
+const (
+	// StrategyLayout taps the key that produces the rune in the keyboard
+	// layout, holding the modifiers it needs.
+	StrategyLayout Strategy = iota
+
+	// StrategyDeadKey composes the rune from a sequence of keystrokes, such as
+	// a dead key followed by a base letter. It needs a [Composer].
+	StrategyDeadKey
+
+	// StrategyUnicode injects the rune without a key. It needs a
+	// [UnicodeTyper].
+	StrategyUnicode
+
+	// StrategyPaste pastes the rune through the clipboard. It needs a
+	// [Paster].
+	StrategyPaste
+)
+
+// defaultStrategies is the strategy chain used when none is given.
+var defaultStrategies = []Strategy{StrategyLayout, StrategyDeadKey, StrategyUnicode, StrategyPaste}
+
+// A Strategy is a way of typing a rune.
+type Strategy int
+
+// A Composer is a [Backend] that can compose runes missing from the keyboard
+// layout out of several keystrokes.
+type Composer interface {
+	// ComposeKeystrokes translates r to the keystrokes that compose it.
+	ComposeKeystrokes(r rune) ([]Keystroke, error)
+}
+
+// A UnicodeTyper is a [Backend] that can type any rune without a matching key,
+// such as with KEYEVENTF_UNICODE input on Windows or by remapping a spare key
+// code on X11.
+type UnicodeTyper interface {
+	// TypeRune types r.
+	TypeRune(r rune) error
+}
+
+// A Paster is a [Backend] that can paste text through the clipboard.
+type Paster interface {
+	// Paste pastes text.
+	Paste(text string) error
+}
+
+// A RunePlan is a struct that contains the strategy chosen to type a rune.
+type RunePlan struct {
+	Rune       rune        // rune to type
+	Strategy   Strategy    // strategy chosen to type the rune
+	Keystrokes []Keystroke // keystrokes to tap for StrategyLayout and StrategyDeadKey
+}
+
+func (s Strategy) String() string {
+	switch s {
+	case StrategyLayout:
+		return "layout"
+	case StrategyDeadKey:
+		return "dead key"
+	case StrategyUnicode:
+		return "unicode"
+	case StrategyPaste:
+		return "paste"
+	}
+
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// PlanRune chooses the first strategy of strategies that b supports for r. An
+// empty strategies tries every strategy in the order of the constants.
+// It returns a plan with an error joining the failure of every strategy if no
+// strategy can type r.
+func PlanRune(b Backend, r rune, strategies ...Strategy) (RunePlan, error) {
+	return planRune(b, nil, r, strategies)
+}
+
+// planRune is [PlanRune] translating r with l instead of b unless l is nil.
+func planRune(b Backend, l *Layout, r rune, strategies []Strategy) (RunePlan, error) {
+	if len(strategies) == 0 {
+		strategies = defaultStrategies
+	}
+
+	var errs []error
+	for _, s := range strategies {
+		p := RunePlan{Rune: r, Strategy: s}
+
+		switch s {
+		case StrategyLayout:
+			translate := b.RuneToKeystroke
+			if l != nil {
+				translate = l.RuneToKeystroke
+			}
+			ks, err := translate(r)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			p.Keystrokes = []Keystroke{ks}
+		case StrategyDeadKey:
+			c, ok := b.(Composer)
+			if l != nil {
+				c, ok = l, true
+			}
+			if !ok {
+				continue
+			}
+			keystrokes, err := c.ComposeKeystrokes(r)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			p.Keystrokes = keystrokes
+		case StrategyUnicode:
+			if _, ok := b.(UnicodeTyper); !ok {
+				continue
+			}
+		case StrategyPaste:
+			if _, ok := b.(Paster); !ok {
+				continue
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown strategy %v", s))
+			continue
+		}
+
+		return p, nil
+	}
+
+	if len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrNoKeystroke, r))
+	}
+
+	return RunePlan{Rune: r}, errors.Join(errs...)
+}
+
+// leadMods returns the modifiers of the first keystroke of p.
+func (p RunePlan) leadMods() Mods {
+	if len(p.Keystrokes) == 0 {
+		return 0
+	}
+
+	return p.Keystrokes[0].Mods
+}
+
+// tailMods returns the modifiers of the last keystroke of p.
+func (p RunePlan) tailMods() Mods {
+	if len(p.Keystrokes) == 0 {
+		return 0
+	}
+
+	return p.Keystrokes[len(p.Keystrokes)-1].Mods
+}
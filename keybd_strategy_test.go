@@ -0,0 +1,216 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+// composer is a recorder that composes 'é' from a dead acute on AltGr+' and
+// the letter e.
+type composer struct{ *keybd.Recorder }
+
+func (composer) ComposeKeystrokes(r rune) ([]keybd.Keystroke, error) {
+	if r != 'é' {
+		return nil, fmt.Errorf("%w: %q", keybd.ErrNoKeystroke, r)
+	}
+
+	return []keybd.Keystroke{
+		{Code: keybd.KEY_APOSTROPHE, Mods: keybd.ModAltGr},
+		{Code: keybd.KEY_E},
+	}, nil
+}
+
+// unicodeTyper is a recorder that records the runes typed without a key.
+type unicodeTyper struct {
+	*keybd.Recorder
+	typed []rune
+}
+
+func (b *unicodeTyper) TypeRune(r rune) error {
+	b.typed = append(b.typed, r)
+	return nil
+}
+
+// paster is a unicodeTyper that also records the pasted text.
+type paster struct {
+	*unicodeTyper
+	pasted []string
+}
+
+func (b *paster) Paste(text string) error {
+	b.pasted = append(b.pasted, text)
+	return nil
+}
+
+func TestPlanRune(t *testing.T) {
+	tName := "Strategy"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	type input struct {
+		b          keybd.Backend
+		r          rune
+		strategies []keybd.Strategy
+	}
+
+	rec := keybd.NewRecorder()
+	c := composer{rec}
+	u := &unicodeTyper{Recorder: rec}
+	p := &paster{unicodeTyper: u}
+
+	scenes := []test.Scene{
+		{
+			Input:   input{b: rec, r: 'A'},
+			Output:  keybd.RunePlan{Rune: 'A', Strategy: keybd.StrategyLayout, Keystrokes: []keybd.Keystroke{{Code: keybd.KEY_A, Mods: keybd.ModShift}}},
+			Passing: true,
+		},
+		{
+			Input:   input{b: c, r: 'é'},
+			Output:  keybd.RunePlan{Rune: 'é', Strategy: keybd.StrategyDeadKey, Keystrokes: []keybd.Keystroke{{Code: keybd.KEY_APOSTROPHE, Mods: keybd.ModAltGr}, {Code: keybd.KEY_E}}},
+			Passing: true,
+		},
+		{
+			Input:   input{b: u, r: 'é'},
+			Output:  keybd.RunePlan{Rune: 'é', Strategy: keybd.StrategyUnicode},
+			Passing: true,
+		},
+		{
+			Input:   input{b: p, r: '😀'},
+			Output:  keybd.RunePlan{Rune: '😀', Strategy: keybd.StrategyUnicode},
+			Passing: true,
+		},
+		{
+			Input:   input{b: p, r: '😀', strategies: []keybd.Strategy{keybd.StrategyPaste, keybd.StrategyUnicode}},
+			Output:  keybd.RunePlan{Rune: '😀', Strategy: keybd.StrategyPaste},
+			Passing: true,
+		},
+		{
+			Input:   input{b: p, r: 'a', strategies: []keybd.Strategy{keybd.StrategyDeadKey, keybd.StrategyLayout}},
+			Output:  keybd.RunePlan{Rune: 'a', Strategy: keybd.StrategyLayout, Keystrokes: []keybd.Keystroke{{Code: keybd.KEY_A}}},
+			Passing: true,
+		},
+		{
+			Input:   input{b: rec, r: '😀'},
+			Output:  keybd.RunePlan{Rune: '😀'},
+			Passing: false,
+		},
+		{
+			Input:   input{b: c, r: 'ü'},
+			Output:  keybd.RunePlan{Rune: 'ü'},
+			Passing: false,
+		},
+		{
+			Input:   input{b: u, r: 'a', strategies: []keybd.Strategy{keybd.StrategyPaste}},
+			Output:  keybd.RunePlan{Rune: 'a'},
+			Passing: false,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.(input)
+			got, err := keybd.PlanRune(in.b, in.r, in.strategies...)
+			if s.Passing && err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			} else if !s.Passing && !errors.Is(err, keybd.ErrNoKeystroke) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
+			}
+			if want := s.Output.(keybd.RunePlan); !reflect.DeepEqual(got, want) {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestTyperStrategies(t *testing.T) {
+	tName := "Strategy"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	p := &paster{unicodeTyper: &unicodeTyper{Recorder: rec}}
+
+	var report []keybd.Strategy
+	typer := keybd.NewTyper(
+		keybd.WithBackend(p),
+		keybd.WithKeyDelay(0),
+		keybd.WithStrategies(keybd.StrategyLayout, keybd.StrategyPaste, keybd.StrategyUnicode),
+		keybd.WithStrategyReport(func(i int, p keybd.RunePlan) { report = append(report, p.Strategy) }),
+	)
+
+	if err := typer.Type(context.Background(), "Hé😀!"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if err := rec.EqualText("H!"); err != nil {
+		t.Error(err)
+	}
+	if want := []string{"é", "😀"}; !reflect.DeepEqual(p.pasted, want) {
+		t.Errorf(test.ErrWantFGotF, want, p.pasted)
+	}
+	if len(p.typed) != 0 {
+		t.Errorf(test.ErrWantFGotF, nil, p.typed)
+	}
+
+	want := []keybd.Strategy{keybd.StrategyLayout, keybd.StrategyPaste, keybd.StrategyPaste, keybd.StrategyLayout}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf(test.ErrWantFGotF, want, report)
+	}
+}
+
+func TestTyperDeadKey(t *testing.T) {
+	tName := "Strategy"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	typer := keybd.NewTyper(keybd.WithBackend(composer{rec}), keybd.WithKeyDelay(0))
+
+	if err := typer.Type(context.Background(), "é"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	want := []keybd.RecordedEvent{
+		{Code: keybd.KEY_RIGHTALT, Down: true},
+		{Code: keybd.KEY_APOSTROPHE, Down: true, Mods: keybd.ModAltGr},
+		{Code: keybd.KEY_APOSTROPHE, Down: false, Mods: keybd.ModAltGr},
+		{Code: keybd.KEY_RIGHTALT, Down: false},
+		{Code: keybd.KEY_E, Down: true},
+		{Code: keybd.KEY_E, Down: false},
+	}
+	if err := rec.EqualEvents(want); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStrategyString(t *testing.T) {
+	tName := "Strategy"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{Input: keybd.StrategyLayout, Output: "layout"},
+		{Input: keybd.StrategyDeadKey, Output: "dead key"},
+		{Input: keybd.StrategyUnicode, Output: "unicode"},
+		{Input: keybd.StrategyPaste, Output: "paste"},
+		{Input: keybd.Strategy(9), Output: "Strategy(9)"},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			if got, want := s.Input.(keybd.Strategy).String(), s.Output.(string); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
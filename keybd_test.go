@@ -31,3 +31,19 @@ function uuidgen
 }
 `,
 }
+
+var testGraphemes = map[string][]string{
+	"combiningAccents": {"e\u0301", "l", "e\u0300", "v", "e"},
+	"greek":            {"Κ", "α", "λ", "η", "μ", "έ", "ρ", "α"},
+	"japanese":         {"日", "本", "語", "で", "す"},
+	"hangulSyllables":  {"한", "국", "어"},
+	"hangulJamo":       {"\u1112\u1161\u11AB", "\u1100\u116E\u11A8"},
+	"arabicPrepend":    {"\u0600\u0661", "\u0662"},
+	"crlf":             {"a", "\r\n", "\n", "b"},
+	"flags":            {"🇯🇵", "🇫🇷", "🇫"},
+	"skinTone":         {"👍🏽", "!"},
+	"keycap":           {"1\uFE0F\u20E3", "2"},
+	"zwjSequence":      {"👩\u200D💻", " ", "👨\u200D👩\u200D👧\u200D👦"},
+	"tagSequence":      {"🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F"},
+	"brokenZWJ":        {"a\u200D", "💻"},
+}
@@ -0,0 +1,647 @@
+package keybd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Constants for the default [Typer] options.
+const (
+	defaultKeyDelay         = 2 * time.Millisecond
+	defaultKeyPressDuration = 2 * time.Millisecond
+	defaultModPressDuration = 2 * time.Millisecond
+	defaultMaxCharacters    = 5000
+	defaultTabSize          = 4
+	defaultTimeout          = 30 * time.Second
+	defaultHeldModsTimeout  = 5 * time.Second
+)
+
+// stopGrace is how long a call that is stopped waits for the key events in
+// progress to finish before it returns without them, such as when a backend
+// call hangs.
+const stopGrace = time.Second
+
+// A Typer types strings on a [Backend] using its own options. Unlike
+// [TypeStr], which reads the package-level [TypeString] options, a Typer is
+// safe for concurrent use: calls to [Typer.Type] are typed one after another.
+type Typer struct {
+	backend          Backend
+	keyDelay         time.Duration
+	keyPressDuration time.Duration
+	modPressDuration time.Duration
+	maxCharacters    int
+	tabsToSpaces     bool
+	tabSize          int
+	timeout          time.Duration
+	strategies       []Strategy
+	layout           *Layout
+	rhythm           Rhythm
+	typos            *TypoPlanner
+	report           func(i int, p RunePlan)
+	observer         func(e TypeEvent)
+	capsLock         CapsLockMode
+	heldMods         HeldModsMode
+	heldModsTimeout  time.Duration
+	pause            *pauser
+
+	// mu serializes the key events of concurrent calls to Type.
+	mu sync.Mutex
+
+	// open guards opening the default backend.
+	open sync.Mutex
+}
+
+// A TyperOption sets an option of a [Typer].
+type TyperOption func(*Typer)
+
+// WithBackend sets the backend the [Typer] types on. Without it, the first
+// backend that opens with [OpenBackend] is used.
+func WithBackend(b Backend) TyperOption { return func(t *Typer) { t.backend = b } }
+
+// WithKeyDelay sets how long to wait after releasing a key and before
+// proceeding with pressing the next key.
+//
+// Default: 2 ms
+func WithKeyDelay(d time.Duration) TyperOption { return func(t *Typer) { t.keyDelay = d } }
+
+// WithKeyPressDuration sets how long to wait after pressing a key before
+// releasing that same key.
+//
+// Default: 2 ms
+func WithKeyPressDuration(d time.Duration) TyperOption {
+	return func(t *Typer) { t.keyPressDuration = d }
+}
+
+// WithModPressDuration sets how long to wait after pressing a modifier key and
+// before pressing the key it modifies.
+//
+// Default: 2 ms
+func WithModPressDuration(d time.Duration) TyperOption {
+	return func(t *Typer) { t.modPressDuration = d }
+}
+
+// WithMaxCharacters sets the maximum amount of characters in a string that can
+// be processed, counted as grapheme clusters with [GraphemeCount].
+//
+// Default: 5000
+func WithMaxCharacters(n int) TyperOption { return func(t *Typer) { t.maxCharacters = n } }
+
+// WithTabsToSpaces enables the conversion of tabs to spaces as they are typed.
+//
+// Default: false
+func WithTabsToSpaces(on bool) TyperOption { return func(t *Typer) { t.tabsToSpaces = on } }
+
+// WithTabSize sets the number of spaces to use in place of tabs when tabs are
+// converted to spaces.
+//
+// Default: 4
+func WithTabSize(n int) TyperOption { return func(t *Typer) { t.tabSize = n } }
+
+// WithTimeout sets how long [Typer.Type] can run before aborting, not counting
+// the time it is paused. A call whose backend hangs returns at most a second
+// after the timeout. A zero duration disables the timeout.
+//
+// Default: 30 s
+func WithTimeout(d time.Duration) TyperOption { return func(t *Typer) { t.timeout = d } }
+
+// WithStrategies sets the strategies tried in order for every rune, see
+// [PlanRune]. Strategies the backend does not support are skipped.
+//
+// Default: StrategyLayout, StrategyDeadKey, StrategyUnicode, StrategyPaste
+func WithStrategies(s ...Strategy) TyperOption { return func(t *Typer) { t.strategies = s } }
+
+// WithStrategyReport sets a function that is called with the index and the
+// plan of every rune before it is typed, reporting the strategy chosen for it.
+//
+// Default: nil
+func WithStrategyReport(fn func(i int, p RunePlan)) TyperOption {
+	return func(t *Typer) { t.report = fn }
+}
+
+// WithObserver sets a function that is called with a [TypeEvent] when
+// [Typer.Type] starts, for every rune as it is typed, and when it finishes or
+// stops, such as to show the progress of typing. The runes of the text of
+// [Typer.Run] are reported as well. fn is called from the goroutine that types
+// and holds up typing until it returns; to receive the events on a channel,
+// send them from fn.
+//
+// Default: nil
+func WithObserver(fn func(e TypeEvent)) TyperOption { return func(t *Typer) { t.observer = fn } }
+
+// WithLayout sets the layout that runes are translated with instead of the
+// translation of the backend, such as a layout of [LayoutByName]. It types
+// text for a layout other than the one of the host, and the same keystrokes
+// on every platform.
+//
+// Default: nil, the layout of the backend
+func WithLayout(l *Layout) TyperOption { return func(t *Typer) { t.layout = l } }
+
+// WithRhythm sets the rhythm that times the keys, such as a [BigramRhythm],
+// instead of the key press duration and key delay.
+//
+// Default: nil
+func WithRhythm(r Rhythm) TyperOption { return func(t *Typer) { t.rhythm = r } }
+
+// WithTypos sets the planner of the typos to make and correct while typing,
+// see [TypoPlanner]. Typing that stops early can leave a typo uncorrected.
+//
+// Default: nil
+func WithTypos(p *TypoPlanner) TyperOption { return func(t *Typer) { t.typos = p } }
+
+// NewTyper creates a [Typer] with the default options overridden by opts.
+func NewTyper(opts ...TyperOption) *Typer {
+	t := &Typer{
+		keyDelay:         defaultKeyDelay,
+		keyPressDuration: defaultKeyPressDuration,
+		modPressDuration: defaultModPressDuration,
+		maxCharacters:    defaultMaxCharacters,
+		tabSize:          defaultTabSize,
+		timeout:          defaultTimeout,
+		heldModsTimeout:  defaultHeldModsTimeout,
+		pause:            &pauser{},
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// Type types str until it is done, the timeout of t is exceeded, or ctx is
+// done. When typing stops early, the held modifier keys are released and a
+// [StopError] reports how much of str was typed.
+// It returns an error if the call fails. A rune that cannot be typed does not
+// stop typing; instead, a [TypeError] for each one is joined into the error.
+func (t *Typer) Type(ctx context.Context, str string) error { return t.TypeFrom(ctx, str, 0) }
+
+// TypeFrom is like [Typer.Type] but skips the first offset runes of str, such
+// as the Offset of a [StopError] to resume typing where it stopped. The
+// indexes of errors count the runes of the whole str.
+// It returns an error if the call fails.
+func (t *Typer) TypeFrom(ctx context.Context, str string, offset int) error {
+	runes := []rune(str)
+	offset = min(max(offset, 0), len(runes))
+
+	if offset == len(runes) {
+		return nil
+	} else if rest := string(runes[offset:]); len(rest) > t.maxCharacters && GraphemeCount(rest) > t.maxCharacters {
+		return ErrMaxCharacter
+	}
+
+	// The typed offset is recorded as typing progresses, since a call that
+	// hangs is not waited for.
+	var typed atomic.Int64
+	typed.Store(int64(offset))
+	err := t.run(ctx, func(ctx context.Context, b Backend) (err error) {
+		t.observe(TypeEvent{Kind: TypeEventStarted, Index: offset, Total: len(runes), Time: time.Now()})
+
+		var n int
+		rest := string(runes[offset:])
+		if t.typos != nil {
+			n, err = t.typePlan(ctx, b, rest, offset, &typed)
+		} else {
+			n, err = t.typeStr(ctx, b, rest, offset, &typed)
+		}
+		typed.Store(int64(n))
+		return err
+	})
+
+	kind, index := TypeEventFinished, int(typed.Load())
+	if errors.Is(err, ErrAborted) || errors.Is(err, ErrTimeout) {
+		kind, err = TypeEventStopped, &StopError{Offset: index, Err: err}
+	}
+	t.observe(TypeEvent{Kind: kind, Index: index, Total: len(runes), Time: time.Now(), Err: err})
+
+	return err
+}
+
+// typePlan types str with the typos of t, tapping Backspace to erase them, and
+// counts the indexes of its runes from base. When typing stops early, the typo
+// being typed is erased, so that the runes up to the returned index are typed
+// correctly. The index of the correct runes typed so far is recorded in typed,
+// see [Typer.typeStr].
+func (t *Typer) typePlan(ctx context.Context, b Backend, str string, base int, typed *atomic.Int64) (int, error) {
+	var (
+		errs     []error
+		offset   = base
+		unerased int
+		prev     rune // rune typed last, or 0 before the first
+	)
+
+	// Caps Lock is turned off once rather than for every step.
+	_, restore := t.adjustCapsLock(b)
+	defer restore()
+
+	// Erasing is not cut short, so that a typo is never left behind.
+	erase := func(n int) {
+		for range n {
+			if prev != 0 {
+				time.Sleep(t.gap(prev, '\b'))
+			}
+			prev = '\b'
+
+			start := time.Now()
+			err := keyTap(context.Background(), b, KEY_BACKSPACE, t.hold('\b'))
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			t.observe(TypeEvent{
+				Kind:     TypeEventRune,
+				Index:    offset,
+				Rune:     '\b',
+				Plan:     RunePlan{Rune: '\b', Strategy: StrategyLayout, Keystrokes: []Keystroke{{Code: KEY_BACKSPACE}}},
+				Time:     start,
+				Duration: time.Since(start),
+				Err:      err,
+			})
+		}
+	}
+
+	for _, step := range t.typos.plan(str, t.layout) {
+		if err := sleepContext(ctx, step.Pause); err != nil {
+			erase(unerased)
+			return offset, errors.Join(append(errs, stopError(ctx))...)
+		}
+
+		if step.Text != "" {
+			runes := []rune(step.Text)
+			if prev != 0 {
+				if err := sleepContext(ctx, t.gap(prev, runes[0])); err != nil {
+					erase(unerased)
+					return offset, errors.Join(append(errs, stopError(ctx))...)
+				}
+			}
+
+			progress := typed
+			if step.Typo != 0 {
+				progress = nil
+			}
+
+			n, err := t.typeStr(ctx, b, step.Text, offset, progress)
+			if k := n - offset; k > 0 {
+				prev = runes[k-1]
+			}
+			if step.Typo != 0 {
+				// Only the runes of the typo that were typed are erased.
+				unerased = n - offset - unindexTypeErrors(err)
+			} else {
+				offset = n
+			}
+
+			if err != nil {
+				errs = append(errs, err)
+				if ctx.Err() != nil {
+					erase(unerased)
+					return offset, errors.Join(errs...)
+				}
+			}
+		}
+
+		if step.Backspace > 0 {
+			erase(min(step.Backspace, unerased))
+			unerased = 0
+		}
+	}
+
+	return offset, errors.Join(errs...)
+}
+
+// unindexTypeErrors sets the index of the [TypeError] values joined into err
+// to -1, since the runes of a typo are not in the string. It returns the number
+// of runes that failed.
+func unindexTypeErrors(err error) int {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	failed := make(map[int]bool)
+	for _, err := range errs {
+		var typeErr *TypeError
+		if errors.As(err, &typeErr) {
+			if typeErr.Index >= 0 {
+				failed[typeErr.Index] = true
+			}
+			typeErr.Index = -1
+		}
+	}
+
+	return len(failed)
+}
+
+// run calls fn with the backend of t once the backend is prepared, the
+// previous calls are done, and the modifier keys held by others are dealt with
+// as set by [WithHeldMods], until fn returns, the timeout of t is exceeded, or
+// ctx is done. When fn fails, stops early, or panics, the keys it left held
+// are released, and a panic is returned as an error matching [ErrUncaught].
+// When ctx is done, fn is waited for until it stops at the next grapheme
+// cluster, but for no longer than stopGrace, so that a backend call that hangs
+// does not hang run; fn is then left to return in the background.
+func (t *Typer) run(ctx context.Context, fn func(ctx context.Context, b Backend) error) error {
+	b, err := t.openBackend()
+	if err != nil {
+		return err
+	}
+
+	if t.timeout > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		clock := t.pause.startTimeout(t.timeout, func() { cancel(context.DeadlineExceeded) })
+		defer t.pause.stopTimeout(clock)
+	}
+
+	done := make(chan error, 1)
+	started := make(chan struct{})
+	go func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		close(started)
+		if ctx.Err() != nil {
+			done <- stopError(ctx)
+			return
+		}
+
+		// Keys held before the call belong to someone else.
+		held := heldOn(b)
+
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v", ErrUncaught, r)
+			}
+			if err != nil {
+				if releaseErr := releaseHeld(b, held); releaseErr != nil {
+					err = errors.Join(err, releaseErr)
+				}
+			}
+			done <- err
+		}()
+
+		if p, ok := b.(preparer); ok {
+			var cleanup func()
+			if cleanup, err = p.prepare(); err != nil {
+				return
+			}
+			defer cleanup()
+		}
+
+		restore, err := t.neutralizeMods(ctx, b, held)
+		if err != nil {
+			return
+		}
+		defer restore()
+
+		err = fn(ctx, b)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	// A call that has started stops at the next grapheme cluster, so wait for
+	// it to tell how far it got.
+	select {
+	case <-started:
+	default:
+		return stopError(ctx)
+	}
+
+	grace := time.NewTimer(stopGrace)
+	defer grace.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-grace.C:
+		return stopError(ctx)
+	}
+}
+
+// stopError returns the error that a call stops with when ctx is done,
+// matching [ErrTimeout] if the deadline of ctx is exceeded and [ErrAborted]
+// otherwise.
+func stopError(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrTimeout, cause)
+	}
+
+	return fmt.Errorf("%w: %w", ErrAborted, cause)
+}
+
+// openBackend returns the backend of t, opening the default backend the first
+// time it is needed.
+func (t *Typer) openBackend() (Backend, error) {
+	t.open.Lock()
+	defer t.open.Unlock()
+
+	if t.backend == nil {
+		b, err := OpenBackend("")
+		if err != nil {
+			return nil, err
+		}
+		t.backend = b
+	}
+
+	return t.backend, nil
+}
+
+// setMods sets the modifier key state for the current and next iteration of a
+// modifier key.
+func setMods(b Backend, down bool, mods Mods, modsNext Mods) bool {
+	var modsSetCount uint
+	for _, m := range modKeys {
+		if mods&m.mod != 0 {
+			if !down {
+				if modsNext&m.mod == 0 {
+					_ = releaseKey(b, m.code)
+					modsSetCount++
+				}
+			} else {
+				if !b.KeyIsDown(m.code) {
+					_ = pressKey(b, m.code)
+					modsSetCount++
+				}
+			}
+		}
+	}
+
+	return modsSetCount > 0
+}
+
+// typeStr is the base function for Type that primarily handles the rune
+// translation and the actual key presses, counting the indexes of the runes of
+// str from base. Every rune that fails is reported as a [TypeError]. Typing
+// only pauses and stops between grapheme clusters, so that a cluster such as a
+// letter and its combining accent is never typed partially. It returns the
+// index of the rune that typing stopped at, and records the index of every
+// grapheme cluster it starts in typed unless typed is nil.
+func (t *Typer) typeStr(ctx context.Context, b Backend, str string, base int, typed *atomic.Int64) (int, error) {
+	runes := []rune(str)
+	iLast := len(runes) - 1
+	if iLast < 0 {
+		return base, nil
+	}
+
+	starts := make([]bool, len(runes))
+	var i int
+	for _, g := range Graphemes(str) {
+		starts[i] = true
+		i += utf8.RuneCountInString(g)
+	}
+
+	var errs []error
+
+	caps, restore := t.adjustCapsLock(b)
+	defer restore()
+
+	fail := func(i int, err error) error {
+		err = &TypeError{Index: base + i, Rune: runes[i], Backend: b.Name(), Err: err}
+		errs = append(errs, err)
+		return err
+	}
+
+	plan := func(i int) (RunePlan, error) {
+		p, err := planRune(b, t.layout, runes[i], t.strategies)
+		if err != nil {
+			return p, fail(i, err)
+		}
+		if caps {
+			p = p.capsLocked()
+		}
+		if t.report != nil {
+			t.report(base+i, p)
+		}
+		return p, nil
+	}
+
+	p, pErr := plan(0)
+	for i := range runes {
+		if starts[i] && typed != nil {
+			typed.Store(int64(base + i))
+		}
+		if starts[i] && (ctx.Err() != nil || t.pause.paused()) {
+			_ = setMods(b, false, p.leadMods(), 0)
+			if err := t.pause.wait(ctx); err != nil {
+				return base + i, errors.Join(append(errs, stopError(ctx))...)
+			}
+		}
+
+		start := time.Now()
+		err := pErr
+		if typeErr := t.typeRune(b, p); typeErr != nil {
+			err = errors.Join(err, fail(i, typeErr))
+		}
+
+		t.observe(TypeEvent{
+			Kind:     TypeEventRune,
+			Index:    base + i,
+			Rune:     runes[i],
+			Plan:     p,
+			Time:     start,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+
+		var (
+			next    RunePlan
+			nextErr error
+		)
+		if i < iLast {
+			next, nextErr = plan(i + 1)
+		}
+
+		_ = setMods(b, false, p.tailMods(), next.leadMods())
+
+		if i < iLast {
+			time.Sleep(t.gap(p.Rune, next.Rune))
+			p, pErr = next, nextErr
+		}
+	}
+
+	if typed != nil {
+		typed.Store(int64(base + len(runes)))
+	}
+
+	return base + len(runes), errors.Join(errs...)
+}
+
+// typeRune types the rune of p with the strategy of p without being cut short,
+// since typeStr only stops between grapheme clusters. The modifiers of the
+// last keystroke are left held for the next rune.
+func (t *Typer) typeRune(b Backend, p RunePlan) error {
+	switch p.Strategy {
+	case StrategyUnicode:
+		return b.(UnicodeTyper).TypeRune(p.Rune)
+	case StrategyPaste:
+		return b.(Paster).Paste(string(p.Rune))
+	}
+
+	var errs []error
+	for i, ks := range p.Keystrokes {
+		if i > 0 {
+			_ = setMods(b, false, p.Keystrokes[i-1].Mods, ks.Mods)
+			time.Sleep(t.gap(p.Rune, p.Rune))
+		}
+
+		if modsSet := setMods(b, true, ks.Mods, 0); modsSet {
+			time.Sleep(t.modPressDuration)
+		}
+
+		r, numTaps := p.Rune, 1
+		if p.Rune == '\t' && p.Strategy == StrategyLayout && t.tabsToSpaces {
+			ks.Code = KEY_SPACE
+			r, numTaps = ' ', t.tabSize
+		}
+
+		if ks.Code != KEY_RESERVED {
+			for j := range numTaps {
+				if j > 0 {
+					time.Sleep(t.gap(r, r))
+				}
+				if err := keyTap(context.Background(), b, ks.Code, t.hold(r)); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// observe reports e to the observer of t.
+func (t *Typer) observe(e TypeEvent) {
+	if t.observer != nil {
+		t.observer(e)
+	}
+}
+
+// hold returns how long to hold the key that types r.
+func (t *Typer) hold(r rune) time.Duration {
+	if t.rhythm != nil {
+		return t.rhythm.Hold(r)
+	}
+
+	return t.keyPressDuration
+}
+
+// gap returns how long to wait between typing prev and typing next.
+func (t *Typer) gap(prev, next rune) time.Duration {
+	if t.rhythm != nil {
+		return t.rhythm.Gap(prev, next)
+	}
+
+	return t.keyDelay
+}
@@ -0,0 +1,133 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestTyperType(t *testing.T) {
+	tName := "Typer"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:  []keybd.TyperOption{},
+			Output: testStrings["multiLineStringWithTabs"],
+		},
+		{
+			Input:  []keybd.TyperOption{keybd.WithTabsToSpaces(true)},
+			Output: testStrings["multiLineStringWithSpaces"],
+		},
+		{
+			Input:  []keybd.TyperOption{keybd.WithTabsToSpaces(true), keybd.WithTabSize(2)},
+			Output: strings.ReplaceAll(testStrings["multiLineStringWithTabs"], "\t", "  "),
+		},
+	}
+
+	recs := make([]*keybd.Recorder, len(scenes))
+	errs := make([]error, len(scenes))
+
+	var wg sync.WaitGroup
+	for i, s := range scenes {
+		recs[i] = keybd.NewRecorder()
+		opts := append(s.Input.([]keybd.TyperOption), keybd.WithBackend(recs[i]), keybd.WithKeyDelay(0))
+		typer := keybd.NewTyper(opts...)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = typer.Type(context.Background(), testStrings["multiLineStringWithTabs"])
+		}()
+	}
+	wg.Wait()
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			if errs[i] != nil {
+				t.Fatalf(test.ErrUnexpectedF, errs[i])
+			}
+			if err := recs[i].EqualText(s.Output.(string)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTyperTypeConcurrent(t *testing.T) {
+	tName := "Typer"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithKeyDelay(0))
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := typer.Type(context.Background(), testStrings["complexWord"]); err != nil {
+				t.Errorf(test.ErrUnexpectedF, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := rec.EqualText(strings.Repeat(testStrings["complexWord"], 2)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTyperTypeCanceled(t *testing.T) {
+	tName := "Typer"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:  []time.Duration{10 * time.Millisecond, time.Minute},
+			Output: keybd.ErrTimeout,
+		},
+		{
+			Input:  []time.Duration{0, 10 * time.Millisecond},
+			Output: keybd.ErrAborted,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			timeout, cancelAfter := s.Input.([]time.Duration)[0], s.Input.([]time.Duration)[1]
+
+			rec := keybd.NewRecorder()
+			typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithKeyDelay(time.Millisecond), keybd.WithTimeout(timeout))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer time.AfterFunc(cancelAfter, cancel).Stop()
+
+			err := typer.Type(ctx, strings.ToUpper(testStrings["complexWord"]))
+			if !errors.Is(err, s.Output.(error)) {
+				t.Fatalf(test.ErrWantFGotF, s.Output, err)
+			}
+
+			// Typing stops at the next rune, which releases the held modifiers.
+			if err := typer.Type(context.Background(), "k"); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+			if rec.KeyIsDown(keybd.KEY_LEFTSHIFT) {
+				t.Errorf(test.ErrWantFGotF, false, true)
+			}
+		})
+	}
+}
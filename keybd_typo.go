@@ -0,0 +1,234 @@
+package keybd
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Constants for the default [TypoPlanner] options.
+const (
+	defaultTypoPause  = 300 * time.Millisecond
+	defaultTypoNotice = 2
+)
+
+// layoutRowOffsets are the horizontal positions of the first keys of
+// layoutRows in key widths, which stagger the rows of a keyboard.
+var layoutRowOffsets = [4]float64{0, 1.5, 1.75, 1.25}
+
+// adjacentKeys maps the key codes of layoutRows to the keys next to them.
+var adjacentKeys = map[KeyCode][]KeyCode{}
+
+// A TypoKind is a kind of typo that a [TypoPlanner] makes.
+type TypoKind int
+
+// Constants for kinds of typos.
+const (
+	TypoAdjacent   TypoKind = iota + 1 // a key next to the intended one, such as "sog" for "dog"
+	TypoTransposed                     // two letters swapped, such as "teh" for "the"
+	TypoDoubled                        // a letter typed twice, such as "thhe" for "the"
+)
+
+// A TypoStep is a struct that describes a step of a [TypoPlan]: a pause
+// followed by text to type or by Backspace taps that erase typed runes.
+type TypoStep struct {
+	Pause     time.Duration // pause before the step
+	Text      string        // text to type
+	Backspace int           // number of Backspace taps
+	Typo      TypoKind      // kind of typo that Text starts with, or 0
+}
+
+// A TypoPlan is a slice of [TypoStep] that types a text with typos and their
+// corrections.
+type TypoPlan []TypoStep
+
+// Text returns the text that p leaves behind, with every Backspace erasing the
+// last rune typed. It equals the text that p was planned for.
+func (p TypoPlan) Text() string {
+	var text []rune
+	for _, step := range p {
+		text = append(text, []rune(step.Text)...)
+		text = text[:max(len(text)-step.Backspace, 0)]
+	}
+
+	return string(text)
+}
+
+// A TypoPlanner is a struct that plans plausible typos in a text and their
+// correction with Backspace: letters typed with a key next to the intended
+// one, swapped, or doubled. A typo is noticed after up to Notice more letters
+// of the same word and, after a pause, erased and typed again, so that the
+// text is typed correctly in the end.
+type TypoPlanner struct {
+	// Rate is the probability that a letter starts a typo, such as 0.05.
+	Rate float64
+
+	// Kinds are the kinds of typos to make.
+	//
+	// Default: TypoAdjacent, TypoTransposed, TypoDoubled
+	Kinds []TypoKind
+
+	// Pause is the mean pause before a typo is corrected. The pauses vary
+	// between half and one and a half times Pause.
+	//
+	// Default: 300 ms
+	Pause time.Duration
+
+	// Notice is the maximum number of letters typed after a typo before it
+	// is noticed. A negative Notice corrects every typo right away.
+	//
+	// Default: 2
+	Notice int
+
+	// Layout is the layout whose geometry picks the keys next to a letter.
+	//
+	// Default: nil, the layout of the Typer or the "us" layout
+	Layout *Layout
+
+	// Seed seeds the random source, so that the same seed plans the same
+	// typos in the same text.
+	Seed uint64
+}
+
+// Plan plans the typos of p in text and their corrections. Only letters that
+// make up a grapheme cluster of their own get typos.
+func (p *TypoPlanner) Plan(text string) TypoPlan { return p.plan(text, nil) }
+
+// plan is the base function for Plan that falls back to l if p has no layout.
+func (p *TypoPlanner) plan(text string, l *Layout) TypoPlan {
+	if p.Layout != nil {
+		l = p.Layout
+	} else if l == nil {
+		l = layoutDB["us"]
+	}
+
+	kinds := p.Kinds
+	if len(kinds) == 0 {
+		kinds = []TypoKind{TypoAdjacent, TypoTransposed, TypoDoubled}
+	}
+
+	pause := p.Pause
+	if pause == 0 {
+		pause = defaultTypoPause
+	}
+
+	notice := p.Notice
+	if notice == 0 {
+		notice = defaultTypoNotice
+	}
+
+	rng := rand.New(rand.NewPCG(p.Seed, 0))
+	runes := []rune(text)
+
+	var (
+		plan    TypoPlan
+		pending strings.Builder
+	)
+
+	flush := func() {
+		if pending.Len() > 0 {
+			plan = append(plan, TypoStep{Text: pending.String()})
+			pending.Reset()
+		}
+	}
+
+	for i := 0; i < len(runes); {
+		if isTypoLetter(runes, i) && rng.Float64() < p.Rate {
+			kind := kinds[rng.IntN(len(kinds))]
+			if typo, n, ok := makeTypo(kind, runes, i, l, rng); ok {
+				limit, extra := 0, 0
+				if notice > 0 {
+					limit = rng.IntN(notice + 1)
+				}
+				for extra < limit && isTypoLetter(runes, i+n+extra) {
+					extra++
+				}
+				tail := string(runes[i+n : i+n+extra])
+
+				flush()
+				plan = append(plan,
+					TypoStep{Text: typo + tail, Typo: kind},
+					TypoStep{
+						Pause:     time.Duration(float64(pause) * (0.5 + rng.Float64())),
+						Backspace: utf8.RuneCountInString(typo + tail),
+					},
+				)
+				pending.WriteString(string(runes[i : i+n+extra]))
+
+				i += n + extra
+				continue
+			}
+		}
+
+		pending.WriteRune(runes[i])
+		i++
+	}
+	flush()
+
+	return plan
+}
+
+// makeTypo makes a typo of kind for the letters of runes at i, returning the
+// runes typed instead and the number of letters they stand for.
+func makeTypo(kind TypoKind, runes []rune, i int, l *Layout, rng *rand.Rand) (string, int, bool) {
+	r := runes[i]
+
+	switch kind {
+	case TypoAdjacent:
+		ks, err := l.RuneToKeystroke(r)
+		if err != nil {
+			return "", 0, false
+		}
+
+		var near []rune
+		for _, code := range adjacentKeys[ks.Code] {
+			if c, ok := l.Keys[Keystroke{Code: code, Mods: ks.Mods}]; ok && c != r && unicode.IsGraphic(c) && !unicode.IsSpace(c) {
+				near = append(near, c)
+			}
+		}
+		if len(near) == 0 {
+			return "", 0, false
+		}
+
+		return string(near[rng.IntN(len(near))]), 1, true
+	case TypoTransposed:
+		if !isTypoLetter(runes, i+1) || runes[i+1] == r {
+			return "", 0, false
+		}
+
+		return string([]rune{runes[i+1], r}), 2, true
+	case TypoDoubled:
+		return string([]rune{r, r}), 1, true
+	}
+
+	return "", 0, false
+}
+
+// isTypoLetter reports whether runes[i] is a letter that is not followed by a
+// combining mark.
+func isTypoLetter(runes []rune, i int) bool {
+	if i >= len(runes) || !unicode.IsLetter(runes[i]) {
+		return false
+	}
+
+	return i+1 == len(runes) || !unicode.Is(unicode.M, runes[i+1])
+}
+
+func init() {
+	for row, codes := range layoutRows {
+		for i, code := range codes {
+			x := layoutRowOffsets[row] + float64(i)
+			for other := max(row-1, 0); other <= min(row+1, len(layoutRows)-1); other++ {
+				for j, near := range layoutRows[other] {
+					dx := math.Abs(layoutRowOffsets[other] + float64(j) - x)
+					if near != code && (other == row && dx == 1 || other != row && dx < 1) {
+						adjacentKeys[code] = append(adjacentKeys[code], near)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+func TestTypoPlannerPlan(t *testing.T) {
+	tName := "Typo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	bs := func(n int) keybd.TypoStep { return keybd.TypoStep{Backspace: n} }
+
+	scenes := []test.Scene{
+		{
+			Input:  []any{keybd.TypoPlanner{Rate: 0}, "the cat"},
+			Output: keybd.TypoPlan{{Text: "the cat"}},
+		},
+		{
+			Input:  []any{keybd.TypoPlanner{Rate: 1, Kinds: []keybd.TypoKind{keybd.TypoDoubled}, Notice: -1}, "ab!"},
+			Output: keybd.TypoPlan{{Text: "aa", Typo: keybd.TypoDoubled}, bs(2), {Text: "a"}, {Text: "bb", Typo: keybd.TypoDoubled}, bs(2), {Text: "b!"}},
+		},
+		{
+			Input:  []any{keybd.TypoPlanner{Rate: 1, Kinds: []keybd.TypoKind{keybd.TypoTransposed}, Notice: -1}, "the"},
+			Output: keybd.TypoPlan{{Text: "ht", Typo: keybd.TypoTransposed}, bs(2), {Text: "the"}},
+		},
+		{
+			// A combining accent keeps its letter from getting a typo.
+			Input:  []any{keybd.TypoPlanner{Rate: 1, Kinds: []keybd.TypoKind{keybd.TypoDoubled}, Notice: -1}, "é"},
+			Output: keybd.TypoPlan{{Text: "é"}},
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.([]any)
+			p := in[0].(keybd.TypoPlanner)
+
+			got := p.Plan(in[1].(string))
+			for i := range got {
+				got[i].Pause = 0
+			}
+			if want := s.Output.(keybd.TypoPlan); !reflect.DeepEqual(got, want) {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestTypoPlannerAdjacent(t *testing.T) {
+	tName := "Typo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	de, err := keybd.LayoutByName("de")
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	scenes := []test.Scene{
+		{Input: []any{(*keybd.Layout)(nil), "g"}, Output: "fhtyvb"},
+		{Input: []any{(*keybd.Layout)(nil), "G"}, Output: "FHTYVB"},
+		{Input: []any{(*keybd.Layout)(nil), "q"}, Output: "wa12"},
+		{Input: []any{de, "y"}, Output: "<xas"},
+		{Input: []any{de, "z"}, Output: "tugh67"},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.([]any)
+
+			for seed := range uint64(20) {
+				p := keybd.TypoPlanner{Rate: 1, Kinds: []keybd.TypoKind{keybd.TypoAdjacent}, Layout: in[0].(*keybd.Layout), Seed: seed}
+
+				plan := p.Plan(in[1].(string))
+				if len(plan) != 3 {
+					t.Fatalf(test.ErrWantFGotF, 3, plan)
+				}
+				if typo := plan[0].Text; !strings.Contains(s.Output.(string), typo) {
+					t.Errorf(test.ErrWantFGotF, s.Output, typo)
+				}
+			}
+		})
+	}
+}
+
+func TestTypoPlannerText(t *testing.T) {
+	tName := "Typo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	text := testStrings["multiLineStringWithTabs"] + " Zoë naïve café"
+
+	for seed := range uint64(50) {
+		p := keybd.TypoPlanner{Rate: 0.3, Seed: seed}
+
+		plan := p.Plan(text)
+		if got := plan.Text(); got != text {
+			t.Fatalf(test.ErrWantFGotF, text, got)
+		}
+
+		// The same seed plans the same typos.
+		if again := p.Plan(text); !reflect.DeepEqual(plan, again) {
+			t.Errorf(test.ErrWantFGotF, plan, again)
+		}
+
+		for _, step := range plan {
+			if step.Backspace > 0 && (step.Pause < 150*time.Millisecond || step.Pause > 450*time.Millisecond) {
+				t.Errorf(test.ErrWantFGotF, "pause between 150 ms and 450 ms", step.Pause)
+			}
+		}
+	}
+}
+
+func TestTyperWithTypos(t *testing.T) {
+	tName := "Typo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	text := "The quick brown fox jumps over the lazy dog."
+	planner := &keybd.TypoPlanner{Rate: 0.3, Pause: time.Microsecond, Seed: 3}
+
+	rec := keybd.NewRecorder()
+	typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithTypos(planner), keybd.WithKeyDelay(0), keybd.WithKeyPressDuration(0))
+
+	if err := typer.Type(context.Background(), text); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if err := rec.EqualText(text); err != nil {
+		t.Error(err)
+	}
+
+	var backspaces int
+	for _, step := range planner.Plan(text) {
+		backspaces += step.Backspace
+	}
+	if backspaces == 0 {
+		t.Fatalf(test.ErrWantFGotF, "typos", "none")
+	}
+
+	// Every typo is erased with Backspace before the text goes on.
+	var got int
+	for _, e := range rec.Events() {
+		if e.Code == keybd.KEY_BACKSPACE && e.Down {
+			got++
+		}
+	}
+	if got != backspaces {
+		t.Errorf(test.ErrWantFGotF, backspaces, got)
+	}
+}
+
+func TestTyperTyposGaps(t *testing.T) {
+	tName := "Typo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	rec := keybd.NewRecorder()
+	rhythm := &loggingRhythm{}
+	planner := &keybd.TypoPlanner{Rate: 1, Kinds: []keybd.TypoKind{keybd.TypoDoubled}, Notice: -1, Pause: time.Microsecond}
+	typer := keybd.NewTyper(keybd.WithBackend(rec), keybd.WithTypos(planner), keybd.WithRhythm(rhythm))
+
+	if err := typer.Type(context.Background(), "ab!"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	// The steps "aa", 2 Backspaces, "a", "bb", 2 Backspaces, and "b!" are
+	// timed by the runes typed on either side of them.
+	want := [][2]rune{
+		{'a', 'a'}, {'a', '\b'}, {'\b', '\b'}, {'\b', 'a'},
+		{'a', 'b'}, {'b', 'b'}, {'b', '\b'}, {'\b', '\b'}, {'\b', 'b'},
+		{'b', '!'},
+	}
+	if got := rhythm.gaps; !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+// missingRune is a [keybd.Backend] that cannot translate its rune.
+type missingRune struct {
+	*keybd.Recorder
+	r rune
+}
+
+func (m missingRune) RuneToKeystroke(r rune) (keybd.Keystroke, error) {
+	if r == m.r {
+		return keybd.Keystroke{}, keybd.ErrNoKeystroke
+	}
+
+	return m.Recorder.RuneToKeystroke(r)
+}
+
+func TestTyperTyposErrors(t *testing.T) {
+	tName := "Typo"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	b := missingRune{Recorder: keybd.NewRecorder(), r: 'q'}
+	planner := &keybd.TypoPlanner{Rate: 1, Kinds: []keybd.TypoKind{keybd.TypoDoubled}, Notice: -1, Pause: time.Microsecond}
+	typer := keybd.NewTyper(keybd.WithBackend(b), keybd.WithTypos(planner), keybd.WithStrategies(keybd.StrategyLayout))
+
+	err := typer.Type(context.Background(), "xyq")
+	if err == nil {
+		t.Fatalf(test.ErrWantFGotF, "error", "none")
+	}
+
+	// The runes of the typo "qq" are not in the string, unlike the "q"
+	// typed after it.
+	var (
+		got  []int
+		walk func(err error)
+	)
+	walk = func(err error) {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, err := range joined.Unwrap() {
+				walk(err)
+			}
+		} else if typeErr := (*keybd.TypeError)(nil); errors.As(err, &typeErr) {
+			got = append(got, typeErr.Index)
+		}
+	}
+	walk(err)
+	if want := []int{-1, -1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	// The typo that failed erases nothing that was typed before it.
+	if err := b.Recorder.EqualText("xy"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,153 @@
+package keybd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultLayoutPollInterval is how often a [LayoutWatcher] polls its source
+// when no interval is given.
+const defaultLayoutPollInterval = 500 * time.Millisecond
+
+// A LayoutSource is an interface that reports the keyboard layout that is
+// active on the host. [SystemLayoutSource] returns the one of the platform,
+// and tests can provide their own.
+type LayoutSource interface {
+	// ActiveLayout returns the active layout. It returns the same *Layout for
+	// as long as the layout does not change, so that changes can be told
+	// apart by comparing pointers.
+	ActiveLayout() (*Layout, error)
+}
+
+// A LayoutSourceFunc is a function that implements [LayoutSource].
+type LayoutSourceFunc func() (*Layout, error)
+
+// ActiveLayout calls f.
+func (f LayoutSourceFunc) ActiveLayout() (*Layout, error) { return f() }
+
+// A LayoutChange is a struct that describes a change of the active layout
+// reported by a [LayoutWatcher].
+type LayoutChange struct {
+	Old *Layout // layout that was active before
+	New *Layout // layout that is active now
+}
+
+// A LayoutWatcher polls a [LayoutSource] for the active keyboard layout and
+// reports its changes on a channel. Polling the source of
+// [SystemLayoutSource] also refreshes the layouts that the backends of the
+// platform translate runes with, so that typing follows the layout the user
+// switches to.
+type LayoutWatcher struct {
+	source  LayoutSource
+	changes chan LayoutChange
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu     sync.Mutex
+	layout *Layout
+	closed bool
+}
+
+// WatchLayout starts a [LayoutWatcher] that asks source for the active layout
+// every interval, or every 500 ms if interval is not positive, until ctx is
+// done or the watcher is closed. A poll that fails keeps the last layout
+// active.
+// It returns nil with an error if source cannot report the active layout.
+func WatchLayout(ctx context.Context, source LayoutSource, interval time.Duration) (*LayoutWatcher, error) {
+	l, err := source.ActiveLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	if interval <= 0 {
+		interval = defaultLayoutPollInterval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &LayoutWatcher{
+		source:  source,
+		changes: make(chan LayoutChange, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		layout:  l,
+	}
+
+	go w.poll(ctx, interval)
+
+	return w, nil
+}
+
+// Layout returns the active layout as of the last poll.
+func (w *LayoutWatcher) Layout() *Layout {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.layout
+}
+
+// Changes returns the channel that changes of the active layout are sent on.
+// Changes that are not received before the next one are merged into it, so
+// the channel never holds more than the change from the layout last received
+// to the active one. The channel is closed when the watcher stops.
+func (w *LayoutWatcher) Changes() <-chan LayoutChange { return w.changes }
+
+// Refresh asks the source for the active layout now rather than at the next
+// poll, reporting a change if there is one.
+// It returns an error if the call fails.
+func (w *LayoutWatcher) Refresh() error {
+	l, err := w.source.ActiveLayout()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed || l == w.layout {
+		return nil
+	}
+
+	change := LayoutChange{Old: w.layout, New: l}
+	w.layout = l
+
+	select {
+	case pending := <-w.changes:
+		change.Old = pending.Old
+	default:
+	}
+	if change.Old != change.New {
+		w.changes <- change
+	}
+
+	return nil
+}
+
+// Close stops the watcher and closes the channel of [LayoutWatcher.Changes].
+func (w *LayoutWatcher) Close() error {
+	w.cancel()
+	<-w.done
+
+	return nil
+}
+
+// poll refreshes the active layout every interval until ctx is done.
+func (w *LayoutWatcher) poll(ctx context.Context, interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			w.mu.Lock()
+			w.closed = true
+			close(w.changes)
+			w.mu.Unlock()
+			return
+		case <-ticker.C:
+			_ = w.Refresh()
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+// fakeLayoutSource is a [keybd.LayoutSource] whose active layout is set by the
+// test.
+type fakeLayoutSource struct {
+	layout *keybd.Layout
+	err    error
+	mu     sync.Mutex
+}
+
+func (s *fakeLayoutSource) ActiveLayout() (*keybd.Layout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.layout, s.err
+}
+
+func (s *fakeLayoutSource) set(l *keybd.Layout, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.layout, s.err = l, err
+}
+
+// testLayouts returns the layouts of the embedded database called names.
+func testLayouts(t *testing.T, names ...string) []*keybd.Layout {
+	t.Helper()
+
+	layouts := make([]*keybd.Layout, len(names))
+	for i, name := range names {
+		l, err := keybd.LayoutByName(name)
+		if err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+		layouts[i] = l
+	}
+
+	return layouts
+}
+
+func TestWatchLayout(t *testing.T) {
+	tName := "Watcher"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	layouts := testLayouts(t, "us", "de", "fr")
+	us, de, fr := layouts[0], layouts[1], layouts[2]
+
+	source := &fakeLayoutSource{layout: us}
+
+	w, err := keybd.WatchLayout(context.Background(), source, time.Hour)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if got := w.Layout(); got != us {
+		t.Errorf(test.ErrWantFGotF, us.Name, got.Name)
+	}
+
+	// An unchanged layout reports nothing.
+	if err := w.Refresh(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	select {
+	case change := <-w.Changes():
+		t.Errorf(test.ErrWantFGotF, "no change", change)
+	default:
+	}
+
+	source.set(de, nil)
+	if err := w.Refresh(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if got, want := <-w.Changes(), (keybd.LayoutChange{Old: us, New: de}); got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	// Changes that are not received are merged.
+	for _, l := range []*keybd.Layout{fr, us} {
+		source.set(l, nil)
+		if err := w.Refresh(); err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+	}
+	if got, want := <-w.Changes(), (keybd.LayoutChange{Old: de, New: us}); got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	// Changes that cancel out are dropped.
+	for _, l := range []*keybd.Layout{fr, us} {
+		source.set(l, nil)
+		if err := w.Refresh(); err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+	}
+	select {
+	case change := <-w.Changes():
+		t.Errorf(test.ErrWantFGotF, "no change", change)
+	default:
+	}
+
+	// A failing source keeps the last layout.
+	errSource := errors.New("source failed")
+	source.set(nil, errSource)
+	if err := w.Refresh(); !errors.Is(err, errSource) {
+		t.Errorf(test.ErrWantFGotF, errSource, err)
+	}
+	if got := w.Layout(); got != us {
+		t.Errorf(test.ErrWantFGotF, us.Name, got.Name)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if change, ok := <-w.Changes(); ok {
+		t.Errorf(test.ErrWantFGotF, "closed channel", change)
+	}
+
+	if _, err := keybd.WatchLayout(context.Background(), source, time.Hour); !errors.Is(err, errSource) {
+		t.Errorf(test.ErrWantFGotF, errSource, err)
+	}
+}
+
+func TestWatchLayoutPolling(t *testing.T) {
+	tName := "Watcher"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	layouts := testLayouts(t, "us", "dvorak")
+	us, dvorak := layouts[0], layouts[1]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	source := &fakeLayoutSource{layout: us}
+
+	w, err := keybd.WatchLayout(ctx, keybd.LayoutSourceFunc(source.ActiveLayout), time.Millisecond)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	source.set(dvorak, nil)
+
+	select {
+	case got := <-w.Changes():
+		if want := (keybd.LayoutChange{Old: us, New: dvorak}); got != want {
+			t.Errorf(test.ErrWantFGotF, want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf(test.ErrWantFGotF, "change", "none")
+	}
+
+	// The watcher stops when ctx is done.
+	cancel()
+
+	select {
+	case _, ok := <-w.Changes():
+		if ok {
+			t.Errorf(test.ErrWantFGotF, "closed channel", "change")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf(test.ErrWantFGotF, "closed channel", "open channel")
+	}
+}
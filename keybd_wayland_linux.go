@@ -0,0 +1,609 @@
+//go:build linux
+
+package keybd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants for Wayland object ids and opcodes.
+//
+// See: https://wayland.app/protocols/virtual-keyboard-unstable-v1
+const (
+	wlDisplayID                  = 1
+	wlDisplaySync                = 0
+	wlDisplayGetRegistry         = 1
+	wlDisplayError               = 0
+	wlRegistryBind               = 0
+	wlRegistryGlobal             = 0
+	wlCallbackDone               = 0
+	zwpVirtualKeyboardCreate     = 0
+	zwpVirtualKeyboardKeymap     = 0
+	zwpVirtualKeyboardKey        = 1
+	zwpVirtualKeyboardModifiers  = 2
+	zwpVirtualKeyboardDestroy    = 3
+	wlKeyboardKeymapFormatXKBV1  = 1
+	zwpVirtualKeyboardManagerIfc = "zwp_virtual_keyboard_manager_v1"
+	wlSeatIfc                    = "wl_seat"
+)
+
+// Constants for XKB real modifier masks.
+const (
+	xkbShiftMask   = 1 << 0
+	xkbControlMask = 1 << 2
+	xkbMod1Mask    = 1 << 3
+	xkbMod4Mask    = 1 << 6
+)
+
+// waylandModMasks maps the modifier keys of the keymap onto the XKB real
+// modifier masks they set. The keymap has no third level, so the right Alt key
+// is a plain Alt key.
+var waylandModMasks = map[KeyCode]uint32{
+	KEY_LEFTSHIFT:  xkbShiftMask,
+	KEY_LEFTCTRL:   xkbControlMask,
+	KEY_LEFTALT:    xkbMod1Mask,
+	KEY_LEFTMETA:   xkbMod4Mask,
+	KEY_RIGHTSHIFT: xkbShiftMask,
+	KEY_RIGHTCTRL:  xkbControlMask,
+	KEY_RIGHTALT:   xkbMod1Mask,
+	KEY_RIGHTMETA:  xkbMod4Mask,
+}
+
+// waylandSpareCodes is the range of key codes handed out to runes that are not
+// part of the base keymap. The upper bound keeps the XKB key codes within the
+// 8-255 range that Xwayland clients can see.
+var waylandSpareCodes = [2]KeyCode{0xB7, 0xF7}
+
+// A Wayland is a virtual keyboard created through the zwp_virtual_keyboard_v1
+// protocol. It implements [Backend] and uploads its own XKB keymap, so the key
+// codes used by its methods are Linux key codes. Runes that are missing from
+// the keymap are bound to a spare key code on demand.
+type Wayland struct {
+	conn     *net.UnixConn
+	nextID   uint32
+	keyboard uint32
+	start    time.Time
+	base     map[KeyCode][]uint32
+	spare    map[KeyCode]uint32
+	lru      []KeyCode
+	keymap   map[rune]Keystroke
+	down     map[KeyCode]bool
+	mods     uint32
+	mu       sync.Mutex
+}
+
+var (
+	_ Backend      = (*Wayland)(nil)
+	_ LockReporter = (*Wayland)(nil)
+)
+
+// OpenWayland connects to the Wayland compositor identified by display and
+// creates a virtual keyboard on its first seat. An empty display uses the
+// WAYLAND_DISPLAY environment variable, falling back to wayland-0.
+// It returns nil with an error if the call fails.
+func OpenWayland(display string) (*Wayland, error) {
+	if display == "" {
+		display = os.Getenv("WAYLAND_DISPLAY")
+	}
+	if display == "" {
+		display = "wayland-0"
+	}
+	if !filepath.IsAbs(display) {
+		display = filepath.Join(os.Getenv("XDG_RUNTIME_DIR"), display)
+	}
+
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: display, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := NewWayland(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// NewWayland creates a virtual keyboard over an already established conn to a
+// Wayland compositor.
+// It returns nil with an error if the call fails.
+func NewWayland(conn *net.UnixConn) (*Wayland, error) {
+	w := &Wayland{
+		conn:   conn,
+		nextID: wlDisplayID + 1,
+		start:  time.Now(),
+		base:   make(map[KeyCode][]uint32),
+		spare:  make(map[KeyCode]uint32),
+		keymap: make(map[rune]Keystroke),
+		down:   make(map[KeyCode]bool),
+	}
+
+	registry := w.newID()
+	if err := w.send(wlDisplayID, wlDisplayGetRegistry, nil, registry); err != nil {
+		return nil, err
+	}
+
+	globals := make(map[string][2]uint32)
+	if err := w.roundTrip(func(id uint32, opcode uint16, args []byte) {
+		if id != registry || opcode != wlRegistryGlobal {
+			return
+		}
+		name := binary.NativeEndian.Uint32(args)
+		ifc, rest := wlString(args[4:])
+		if _, ok := globals[ifc]; !ok && len(rest) >= 4 {
+			globals[ifc] = [2]uint32{name, binary.NativeEndian.Uint32(rest)}
+		}
+	}); err != nil {
+		return nil, err
+	}
+
+	seatGlobal, ok := globals[wlSeatIfc]
+	if !ok {
+		return nil, errors.New("Wayland compositor has no seat")
+	}
+	managerGlobal, ok := globals[zwpVirtualKeyboardManagerIfc]
+	if !ok {
+		return nil, errors.New("Wayland compositor does not support " + zwpVirtualKeyboardManagerIfc)
+	}
+
+	seat, manager := w.newID(), w.newID()
+	if err := w.send(registry, wlRegistryBind, nil, seatGlobal[0], wlSeatIfc, uint32(1), seat); err != nil {
+		return nil, err
+	}
+	if err := w.send(registry, wlRegistryBind, nil, managerGlobal[0], zwpVirtualKeyboardManagerIfc, uint32(1), manager); err != nil {
+		return nil, err
+	}
+
+	w.keyboard = w.newID()
+	if err := w.send(manager, zwpVirtualKeyboardCreate, nil, seat, w.keyboard); err != nil {
+		return nil, err
+	}
+
+	for r, ks := range keymapUS {
+		syms := w.base[ks.Code]
+		if syms == nil {
+			syms = make([]uint32, 2)
+		}
+		syms[ks.Mods&ModShift] = runeToKeysym(r)
+		w.base[ks.Code] = syms
+	}
+	for code, ks := range map[KeyCode]uint32{
+		KEY_ESC:        XK_Escape,
+		KEY_BACKSPACE:  XK_BackSpace,
+		KEY_TAB:        XK_Tab,
+		KEY_ENTER:      XK_Return,
+		KEY_SPACE:      ' ',
+		KEY_LEFTSHIFT:  XK_Shift_L,
+		KEY_LEFTCTRL:   XK_Control_L,
+		KEY_LEFTALT:    XK_Alt_L,
+		KEY_LEFTMETA:   XK_Super_L,
+		KEY_RIGHTSHIFT: XK_Shift_R,
+		KEY_RIGHTCTRL:  XK_Control_R,
+		KEY_RIGHTALT:   XK_Alt_R,
+		KEY_RIGHTMETA:  XK_Super_R,
+	} {
+		w.base[code] = []uint32{ks}
+	}
+
+	w.buildKeymap()
+
+	if err := w.uploadKeymap(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Close destroys the virtual keyboard and closes the connection to the
+// compositor.
+// It returns an error if the call fails.
+func (w *Wayland) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.send(w.keyboard, zwpVirtualKeyboardDestroy, nil)
+
+	return errors.Join(err, w.conn.Close())
+}
+
+// Name returns the name the backend is registered under.
+func (w *Wayland) Name() string { return "wayland" }
+
+// Capabilities returns the capability flags of the backend.
+func (w *Wayland) Capabilities() Capabilities { return CapAnyRune }
+
+// RuneToKeystroke translates r to a keystroke. Runes that are missing from the
+// keymap are bound to a spare key code, uploading a new keymap to the
+// compositor before returning.
+// It returns a zero [Keystroke] with an error if the translation fails,
+// otherwise it returns the keystroke and a nil error.
+func (w *Wayland) RuneToKeystroke(r rune) (Keystroke, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if r == '\r' {
+		return Keystroke{}, nil
+	}
+
+	if ks, ok := w.keymap[r]; ok {
+		if _, isSpare := w.spare[ks.Code]; isSpare {
+			w.touch(ks.Code)
+		}
+		return ks, nil
+	}
+
+	code, err := w.bindSpare(r)
+	if err != nil {
+		return Keystroke{}, err
+	}
+
+	return Keystroke{Code: code}, nil
+}
+
+// LockState reports no lock keys, since the virtual keyboard sends a modifier
+// state of its own, which locks none.
+// It always returns a nil error.
+func (w *Wayland) LockState() (Locks, error) { return 0, nil }
+
+// KeyIsDown detects the down state of code as it was last sent through the
+// virtual keyboard.
+// It returns true if the key is currently depressed and false if it is not.
+func (w *Wayland) KeyIsDown(code KeyCode) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.down[code]
+}
+
+// KeyPress sends a key-down event and is intended to be used before a call to
+// [Wayland.KeyRelease].
+// It returns an error if the call fails.
+func (w *Wayland) KeyPress(code KeyCode) error { return w.sendKey(code, true) }
+
+// KeyRelease sends a key-up event and is intended to be used after a call to
+// [Wayland.KeyPress].
+// It returns an error if the call fails.
+func (w *Wayland) KeyRelease(code KeyCode) error { return w.sendKey(code, false) }
+
+// KeyTap sends a key-down event and a key-up event with a brief pause in
+// between to help simulate an actual keystroke. The duration of the pause is
+// defined by [KeyPressDuration].
+// It returns an error if the call fails.
+func (w *Wayland) KeyTap(code KeyCode) error { return KeyTapOn(w, code) }
+
+// KeyTapContext is like [Wayland.KeyTap] but sends nothing if ctx is already done
+// and cuts the pause short when ctx is done, still releasing the key.
+// It returns an error if the call fails or ctx is done.
+func (w *Wayland) KeyTapContext(ctx context.Context, code KeyCode) error {
+	return KeyTapOnContext(ctx, w, code)
+}
+
+// SendCombo parses combo with [ParseCombo] and sends it.
+// It returns an error if the call fails.
+func (w *Wayland) SendCombo(combo string) error { return SendComboOn(w, combo) }
+
+// RunScript runs s using [TypeString] options.
+// It returns an error if the call fails.
+func (w *Wayland) RunScript(s *Script) error { return RunScriptOn(w, s) }
+
+// TypeStr types str using [TypeString] options. A timeout prevents the function
+// call from hanging indefinitely while an abort channel allows aborting the
+// operation.
+// It returns an error if the call fails.
+func (w *Wayland) TypeStr(str string) error { return TypeStrOn(w, str) }
+
+// TypeStrContext types str using [TypeString] options until it is done or ctx
+// is done. Unlike [Wayland.TypeStr], it is not aborted by [AbortTypeStr].
+// It returns an error if the call fails.
+func (w *Wayland) TypeStrContext(ctx context.Context, str string) error {
+	return TypeStrOnContext(ctx, w, str)
+}
+
+// bindSpare binds r to a free spare key code, recycling the least recently
+// used one when every spare key code is taken, and uploads the new keymap.
+func (w *Wayland) bindSpare(r rune) (KeyCode, error) {
+	var code KeyCode
+	for c := waylandSpareCodes[0]; c <= waylandSpareCodes[1]; c++ {
+		if _, taken := w.spare[c]; !taken && w.base[c] == nil {
+			code = c
+			break
+		}
+	}
+
+	if code == 0 {
+		for i, c := range w.lru {
+			if !w.down[c] {
+				code = c
+				w.lru = slices.Delete(w.lru, i, i+1)
+				break
+			}
+		}
+		if code == 0 {
+			return 0, fmt.Errorf("%w: no spare key code for %q", ErrNoKeystroke, r)
+		}
+	}
+
+	w.spare[code] = runeToKeysym(r)
+	w.lru = append(w.lru, code)
+	w.buildKeymap()
+
+	if err := w.uploadKeymap(); err != nil {
+		return 0, err
+	}
+
+	return code, nil
+}
+
+// touch marks the spare key code as most recently used.
+func (w *Wayland) touch(code KeyCode) {
+	if i := slices.Index(w.lru, code); i >= 0 {
+		w.lru = append(slices.Delete(w.lru, i, i+1), code)
+	}
+}
+
+// buildKeymap rebuilds the rune translation table from the base keymap and the
+// spare key codes.
+func (w *Wayland) buildKeymap() {
+	clear(w.keymap)
+
+	for code, syms := range w.base {
+		for level, ks := range syms {
+			if r, ok := keysymToRune(ks); ok {
+				w.keymap[r] = Keystroke{Code: code, Mods: Mods(level) * ModShift}
+			}
+		}
+	}
+	for code, ks := range w.spare {
+		if r, ok := keysymToRune(ks); ok {
+			w.keymap[r] = Keystroke{Code: code}
+		}
+	}
+}
+
+// keymapText renders the base keymap and the spare key codes as an XKB text
+// keymap.
+func (w *Wayland) keymapText() string {
+	var sb strings.Builder
+
+	sb.WriteString("xkb_keymap {\nxkb_keycodes \"keybd\" {\n\tminimum = 8;\n\tmaximum = 255;\n")
+	for code := range uint16(248) {
+		fmt.Fprintf(&sb, "\t<K%d> = %d;\n", code+8, code+8)
+	}
+	sb.WriteString("};\n")
+
+	sb.WriteString(`xkb_types "keybd" {
+	virtual_modifiers NumLock;
+	type "ONE_LEVEL" {
+		modifiers = none;
+		level_name[Level1] = "Any";
+	};
+	type "TWO_LEVEL" {
+		modifiers = Shift;
+		map[Shift] = Level2;
+		level_name[Level1] = "Base";
+		level_name[Level2] = "Shift";
+	};
+	type "ALPHABETIC" {
+		modifiers = Shift+Lock;
+		map[Shift] = Level2;
+		map[Lock] = Level2;
+		level_name[Level1] = "Base";
+		level_name[Level2] = "Caps";
+	};
+};
+xkb_compatibility "keybd" {
+	interpret Any+AnyOf(all) {
+		action = SetMods(modifiers=modMapMods,clearLocks);
+	};
+};
+`)
+
+	sb.WriteString("xkb_symbols \"keybd\" {\n")
+
+	codes := make([]KeyCode, 0, len(w.base)+len(w.spare))
+	for code := range w.base {
+		codes = append(codes, code)
+	}
+	for code := range w.spare {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+
+	for _, code := range codes {
+		syms := w.base[code]
+		if syms == nil {
+			syms = []uint32{w.spare[code]}
+		}
+
+		names := make([]string, len(syms))
+		for i, ks := range syms {
+			names[i] = fmt.Sprintf("0x%x", ks)
+		}
+		fmt.Fprintf(&sb, "\tkey <K%d> { [ %s ] };\n", code+8, strings.Join(names, ", "))
+	}
+
+	for mod, codes := range map[string][2]KeyCode{
+		"Shift":   {KEY_LEFTSHIFT, KEY_RIGHTSHIFT},
+		"Control": {KEY_LEFTCTRL, KEY_RIGHTCTRL},
+		"Mod1":    {KEY_LEFTALT, KEY_RIGHTALT},
+		"Mod4":    {KEY_LEFTMETA, KEY_RIGHTMETA},
+	} {
+		fmt.Fprintf(&sb, "\tmodifier_map %s { <K%d>, <K%d> };\n", mod, codes[0]+8, codes[1]+8)
+	}
+
+	sb.WriteString("};\n};\n")
+
+	return sb.String()
+}
+
+// uploadKeymap sends the current keymap to the compositor through a memfd and
+// waits for the compositor to process it.
+func (w *Wayland) uploadKeymap() error {
+	text := w.keymapText() + "\x00"
+
+	fd, err := unix.MemfdCreate("keybd-keymap", unix.MFD_CLOEXEC)
+	if err != nil {
+		return err
+	}
+
+	f := os.NewFile(uintptr(fd), "keybd-keymap")
+	defer f.Close()
+
+	if _, err = io.WriteString(f, text); err != nil {
+		return err
+	}
+
+	if err = w.send(w.keyboard, zwpVirtualKeyboardKeymap, []int{fd}, uint32(wlKeyboardKeymapFormatXKBV1), uint32(len(text))); err != nil {
+		return err
+	}
+
+	return w.roundTrip(nil)
+}
+
+// sendKey sends a key event followed by the modifier state when code is a
+// modifier key.
+func (w *Wayland) sendKey(code KeyCode, down bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var state uint32
+	if down {
+		state = 1
+	}
+
+	ms := uint32(time.Since(w.start).Milliseconds())
+	if err := w.send(w.keyboard, zwpVirtualKeyboardKey, nil, ms, uint32(code), state); err != nil {
+		return err
+	}
+
+	w.down[code] = down
+
+	if _, ok := waylandModMasks[code]; !ok {
+		return nil
+	}
+
+	// Both keys of a modifier set its mask, which stays set while either is
+	// held.
+	w.mods = 0
+	for c, mask := range waylandModMasks {
+		if w.down[c] {
+			w.mods |= mask
+		}
+	}
+
+	return w.send(w.keyboard, zwpVirtualKeyboardModifiers, nil, w.mods, uint32(0), uint32(0), uint32(0))
+}
+
+// newID allocates a new client object id.
+func (w *Wayland) newID() uint32 {
+	id := w.nextID
+	w.nextID++
+
+	return id
+}
+
+// send marshals a request for object id with opcode and args, passing fds as
+// ancillary data.
+func (w *Wayland) send(id uint32, opcode uint16, fds []int, args ...any) error {
+	body := make([]byte, 0, 32)
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			body = binary.NativeEndian.AppendUint32(body, v)
+		case string:
+			body = binary.NativeEndian.AppendUint32(body, uint32(len(v)+1))
+			body = append(body, v...)
+			body = pad(append(body, 0))
+		}
+	}
+
+	msg := binary.NativeEndian.AppendUint32(nil, id)
+	msg = binary.NativeEndian.AppendUint32(msg, uint32(8+len(body))<<16|uint32(opcode))
+	msg = append(msg, body...)
+
+	var oob []byte
+	if len(fds) > 0 {
+		oob = unix.UnixRights(fds...)
+	}
+
+	_, _, err := w.conn.WriteMsgUnix(msg, oob, nil)
+
+	return err
+}
+
+// roundTrip sends a wl_display.sync request and dispatches every event to fn
+// until the compositor signals that all prior requests have been processed.
+func (w *Wayland) roundTrip(fn func(id uint32, opcode uint16, args []byte)) error {
+	callback := w.newID()
+	if err := w.send(wlDisplayID, wlDisplaySync, nil, callback); err != nil {
+		return err
+	}
+
+	head := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(w.conn, head); err != nil {
+			return err
+		}
+
+		id := binary.NativeEndian.Uint32(head)
+		sizeOpcode := binary.NativeEndian.Uint32(head[4:])
+		opcode := uint16(sizeOpcode)
+
+		args := make([]byte, int(sizeOpcode>>16)-len(head))
+		if _, err := io.ReadFull(w.conn, args); err != nil {
+			return err
+		}
+
+		switch {
+		case id == wlDisplayID && opcode == wlDisplayError:
+			msg, _ := wlString(args[8:])
+			return fmt.Errorf("Wayland error %d on object %d: %s",
+				binary.NativeEndian.Uint32(args[4:]), binary.NativeEndian.Uint32(args), msg)
+		case id == callback && opcode == wlCallbackDone:
+			return nil
+		case fn != nil:
+			fn(id, opcode, args)
+		}
+	}
+}
+
+// wlString decodes a Wayland string argument at the start of b and returns it
+// along with the remaining bytes.
+func wlString(b []byte) (string, []byte) {
+	if len(b) < 4 {
+		return "", nil
+	}
+
+	n := int(binary.NativeEndian.Uint32(b))
+	padded := (n + 3) &^ 3
+	if 4+padded > len(b) || n == 0 {
+		return "", b[min(4+padded, len(b)):]
+	}
+
+	return string(b[4 : 4+n-1]), b[4+padded:]
+}
+
+func init() {
+	RegisterBackend("wayland", func() (Backend, error) {
+		w, err := OpenWayland("")
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	})
+}
@@ -0,0 +1,349 @@
+//go:build linux
+
+package keybd_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+	"golang.org/x/sys/unix"
+)
+
+// fakeWayland is an in-process Wayland compositor that implements just enough
+// of wl_display, wl_registry and zwp_virtual_keyboard_v1 to drive a
+// [keybd.Wayland] and decode the text it types.
+type fakeWayland struct {
+	conn     *net.UnixConn
+	manager  bool
+	ids      map[uint32]string
+	keymap   map[uint32][]uint32
+	keymaps  int
+	mods     uint32
+	text     []rune
+	mu       sync.Mutex
+	fds      []int
+	keyboard uint32
+	done     chan struct{}
+}
+
+// keymapKey matches the symbols of a key in an XKB text keymap.
+var keymapKey = regexp.MustCompile(`key <K(\d+)> \{ \[ ([^\]]+) \] \};`)
+
+// newFakeWayland starts a fake compositor and returns the client side of the
+// connection to it.
+func newFakeWayland(t *testing.T, manager bool) (*fakeWayland, *net.UnixConn) {
+	t.Helper()
+
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "wayland")
+		c, err := net.FileConn(f)
+		_ = f.Close()
+		if err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+		conns[i] = c.(*net.UnixConn)
+	}
+
+	f := &fakeWayland{
+		conn:    conns[1],
+		manager: manager,
+		ids:     map[uint32]string{1: "wl_display"},
+		keymap:  map[uint32][]uint32{},
+		done:    make(chan struct{}),
+	}
+
+	t.Cleanup(func() {
+		_ = conns[0].Close()
+		_ = conns[1].Close()
+	})
+
+	go f.serve()
+
+	return f, conns[0]
+}
+
+// typed waits for the virtual keyboard to be destroyed and returns the text
+// decoded from the key events it received.
+func (f *fakeWayland) typed() string {
+	<-f.done
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return string(f.text)
+}
+
+func (f *fakeWayland) serve() {
+	head := make([]byte, 8)
+	oob := make([]byte, unix.CmsgSpace(4*4))
+
+	for {
+		n := 0
+		for n < len(head) {
+			nn, oobn, _, _, err := f.conn.ReadMsgUnix(head[n:], oob)
+			if err != nil {
+				return
+			}
+			if oobn > 0 {
+				msgs, _ := unix.ParseSocketControlMessage(oob[:oobn])
+				for _, m := range msgs {
+					fds, _ := unix.ParseUnixRights(&m)
+					f.fds = append(f.fds, fds...)
+				}
+			}
+			n += nn
+		}
+
+		id := binary.NativeEndian.Uint32(head)
+		opcode := uint16(binary.NativeEndian.Uint32(head[4:]))
+		args := make([]byte, int(binary.NativeEndian.Uint32(head[4:])>>16)-8)
+		if _, err := io.ReadFull(f.conn, args); err != nil {
+			return
+		}
+
+		arg := func(i int) uint32 { return binary.NativeEndian.Uint32(args[4*i:]) }
+
+		switch ifc := f.ids[id]; {
+		case ifc == "wl_display" && opcode == 1: // get_registry
+			f.ids[arg(0)] = "wl_registry"
+			f.event(arg(0), 0, uint32(1), "wl_seat", uint32(7))
+			if f.manager {
+				f.event(arg(0), 0, uint32(2), "zwp_virtual_keyboard_manager_v1", uint32(1))
+			}
+		case ifc == "wl_display" && opcode == 0: // sync
+			f.event(arg(0), 0, uint32(0))
+		case ifc == "wl_registry" && opcode == 0: // bind
+			n := int(arg(1))
+			name := string(args[8 : 8+n-1])
+			f.ids[binary.NativeEndian.Uint32(args[8+(n+3)&^3+4:])] = name
+		case ifc == "zwp_virtual_keyboard_manager_v1" && opcode == 0: // create_virtual_keyboard
+			f.keyboard = arg(1)
+			f.ids[arg(1)] = "zwp_virtual_keyboard_v1"
+		case ifc == "zwp_virtual_keyboard_v1" && opcode == 0: // keymap
+			f.loadKeymap(int(arg(1)))
+		case ifc == "zwp_virtual_keyboard_v1" && opcode == 1: // key
+			f.key(arg(1), arg(2) == 1)
+		case ifc == "zwp_virtual_keyboard_v1" && opcode == 2: // modifiers
+			f.mods = arg(0)
+		case ifc == "zwp_virtual_keyboard_v1" && opcode == 3: // destroy
+			close(f.done)
+		}
+	}
+}
+
+// event writes an event for object id with opcode and args.
+func (f *fakeWayland) event(id uint32, opcode uint16, args ...any) {
+	var body []byte
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case uint32:
+			body = binary.NativeEndian.AppendUint32(body, v)
+		case string:
+			body = binary.NativeEndian.AppendUint32(body, uint32(len(v)+1))
+			body = append(body, v...)
+			body = append(body, make([]byte, 4-len(v)%4)...)
+		}
+	}
+
+	msg := binary.NativeEndian.AppendUint32(nil, id)
+	msg = binary.NativeEndian.AppendUint32(msg, uint32(8+len(body))<<16|uint32(opcode))
+	_, _ = f.conn.Write(append(msg, body...))
+}
+
+// loadKeymap reads the keymap from the first pending file descriptor.
+func (f *fakeWayland) loadKeymap(size int) {
+	if len(f.fds) == 0 {
+		return
+	}
+
+	file := os.NewFile(uintptr(f.fds[0]), "keymap")
+	f.fds = f.fds[1:]
+	defer file.Close()
+
+	b := make([]byte, size)
+	if _, err := file.ReadAt(b, 0); err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.keymaps++
+	clear(f.keymap)
+	for _, m := range keymapKey.FindAllStringSubmatch(string(b), -1) {
+		kc, _ := strconv.Atoi(m[1])
+		var syms []uint32
+		for name := range strings.SplitSeq(m[2], ", ") {
+			ks, _ := strconv.ParseUint(name, 0, 32)
+			syms = append(syms, uint32(ks))
+		}
+		f.keymap[uint32(kc)] = syms
+	}
+}
+
+// key decodes a key event using the current keymap and modifier state.
+func (f *fakeWayland) key(code uint32, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	syms := f.keymap[code+8]
+	if !down || len(syms) == 0 {
+		return
+	}
+
+	ks := syms[0]
+	if f.mods&1 != 0 && len(syms) > 1 {
+		ks = syms[1]
+	}
+
+	switch {
+	case ks == keybd.XK_Return:
+		f.text = append(f.text, '\n')
+	case ks == keybd.XK_Tab:
+		f.text = append(f.text, '\t')
+	case ks < 0x100:
+		f.text = append(f.text, rune(ks))
+	case ks >= 0x01000000:
+		f.text = append(f.text, rune(ks-0x01000000))
+	}
+}
+
+func TestNewWayland(t *testing.T) {
+	tName := "Wayland"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:   true,
+			Passing: true,
+		},
+		{
+			Input:   false,
+			Passing: false,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			_, conn := newFakeWayland(t, s.Input.(bool))
+
+			_, err := keybd.NewWayland(conn)
+			if s.Passing {
+				if err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+			} else {
+				if err == nil {
+					t.Errorf(test.ErrWantFGotF, "error", "none")
+				}
+			}
+		})
+	}
+}
+
+func TestWaylandRuneToKeystroke(t *testing.T) {
+	tName := "Wayland"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	f, conn := newFakeWayland(t, true)
+	w, err := keybd.NewWayland(conn)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if ks, err := w.RuneToKeystroke(testRunes["upper"]); err != nil {
+		t.Errorf(test.ErrUnexpectedF, err)
+	} else if want := (keybd.Keystroke{Code: keybd.KEY_K, Mods: keybd.ModShift}); ks != want {
+		t.Errorf(test.ErrWantFGotF, want, ks)
+	}
+
+	ks, err := w.RuneToKeystroke(testRunes["emoji"])
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if again, _ := w.RuneToKeystroke(testRunes["emoji"]); again != ks {
+		t.Errorf(test.ErrWantFGotF, ks, again)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	kc := uint32(ks.Code) + 8
+	if want := uint32(0x01000000 + testRunes["emoji"]); len(f.keymap[kc]) != 1 || f.keymap[kc][0] != want {
+		t.Errorf(test.ErrWantFGotF, want, f.keymap[kc])
+	}
+	if f.keymaps != 2 {
+		t.Errorf(test.ErrWantFGotF, 2, f.keymaps)
+	}
+}
+
+func TestWaylandTypeStr(t *testing.T) {
+	tName := "Wayland"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	var cyrillic []rune
+	for r := 'А'; r <= 'я'; r++ {
+		cyrillic = append(cyrillic, r)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:  testStrings["shortSentence"] + "\r\n",
+			Output: testStrings["shortSentence"] + "\n",
+		},
+		{
+			Input:  testStrings["multiLineStringWithTabs"],
+			Output: testStrings["multiLineStringWithTabs"],
+		},
+		{
+			Input:  "Good morning " + string(testRunes["emoji"]) + "!",
+			Output: "Good morning " + string(testRunes["emoji"]) + "!",
+		},
+		{
+			Input:  string(cyrillic) + string(cyrillic[:8]),
+			Output: string(cyrillic) + string(cyrillic[:8]),
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			f, conn := newFakeWayland(t, true)
+			w, err := keybd.NewWayland(conn)
+			if err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+
+			if err := w.TypeStr(s.Input.(string)); err != nil {
+				t.Fatalf(test.ErrWantFGotF, nil, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+			if got, want := f.typed(), s.Output.(string); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"time"
+	"unicode/utf16"
 
 	"github.com/kamaranl/winapi"
 	"golang.org/x/sys/windows"
@@ -20,6 +20,11 @@ const (
 	VSC_LSHIFT     = 0x02A
 	VSC_LCTRL      = 0x01D
 	VSC_LMENU      = 0x038
+	VSC_LWIN       = 0xE05B
+	VSC_RSHIFT     = 0x036
+	VSC_RCTRL      = 0xE01D
+	VSC_RMENU      = 0xE038
+	VSC_RWIN       = 0xE05C
 	VSC_UNASSIGNED = 0x200
 )
 
@@ -30,30 +35,87 @@ const (
 	MOD_LALT
 )
 
-// abortFlag is checked in typeStr so that the function can safely abort typing.
-var abortFlag bool
-
-// StandardMods is a [Modifier] slice of the standard modifier keys.
+// StandardMods is a [Modifier] slice of the standard modifier keys, the left
+// keys before the right ones. The shift state of VkKeyScanEx has no bits for
+// the Windows keys and the right keys, whose masks are 0.
 var StandardMods = []Modifier{
-	{Mask: MOD_LSHIFT, VK: windows.VK_LSHIFT, VSC: VSC_LSHIFT},
-	{Mask: MOD_LCTRL, VK: windows.VK_LCONTROL, VSC: VSC_LCTRL},
-	{Mask: MOD_LALT, VK: windows.VK_LMENU, VSC: VSC_LMENU},
+	{Mask: MOD_LSHIFT, VK: windows.VK_LSHIFT, VSC: VSC_LSHIFT, Mods: ModShift},
+	{Mask: MOD_LCTRL, VK: windows.VK_LCONTROL, VSC: VSC_LCTRL, Mods: ModCtrl},
+	{Mask: MOD_LALT, VK: windows.VK_LMENU, VSC: VSC_LMENU, Mods: ModAlt},
+	{VK: windows.VK_LWIN, VSC: VSC_LWIN, Mods: ModMeta},
+	{VK: windows.VK_RMENU, VSC: VSC_RMENU, Mods: ModAltGr},
+	{VK: windows.VK_RSHIFT, VSC: VSC_RSHIFT, Mods: ModRightShift},
+	{VK: windows.VK_RCONTROL, VSC: VSC_RCTRL, Mods: ModRightCtrl},
+	{VK: windows.VK_RWIN, VSC: VSC_RWIN, Mods: ModRightMeta},
+}
+
+// scanCodes maps key codes onto scan codes. Extended keys carry 0xE0 in the
+// high-order byte.
+var scanCodes = map[KeyCode]uint16{
+	KEY_KPENTER:   0xE01C,
+	KEY_RIGHTCTRL: 0xE01D,
+	KEY_SYSRQ:     0xE037,
+	KEY_RIGHTALT:  0xE038,
+	KEY_HOME:      0xE047,
+	KEY_UP:        0xE048,
+	KEY_PAGEUP:    0xE049,
+	KEY_LEFT:      0xE04B,
+	KEY_RIGHT:     0xE04D,
+	KEY_END:       0xE04F,
+	KEY_DOWN:      0xE050,
+	KEY_PAGEDOWN:  0xE051,
+	KEY_INSERT:    0xE052,
+	KEY_DELETE:    0xE053,
+	KEY_LEFTMETA:  0xE05B,
+	KEY_RIGHTMETA: 0xE05C,
+	KEY_COMPOSE:   0xE05D,
+	KEY_RO:        0x73,
+	KEY_YEN:       0x7D,
+}
+
+// keyCodes maps scan codes back onto key codes.
+var keyCodes = map[uint16]KeyCode{}
+
+// keymapMods lists the modifiers that keys are translated with: none, Shift,
+// AltGr, and Shift+AltGr.
+var keymapMods = []Mods{0, ModShift, ModAltGr, ModAltGr | ModShift}
+
+// lockVKs maps the lock flags onto the virtual key codes of their keys.
+var lockVKs = map[Locks]byte{
+	LockCaps:   windows.VK_CAPITAL,
+	LockNum:    windows.VK_NUMLOCK,
+	LockScroll: windows.VK_SCROLL,
 }
 
-// A Modifier is a struct that contains the mask, the virtual key code, and the
-// virtual scan code for a modifier key.
+// keymaps caches the reverse keymap of the current keyboard layout.
+var keymaps = keymapCache[winapi.Handle]{build: describeKeymap}
+
+// procGetAsyncKeyState reads the state of a key as the keyboard reports it,
+// which the winapi package does not wrap.
+var procGetAsyncKeyState = windows.NewLazySystemDLL("user32.dll").NewProc("GetAsyncKeyState")
+
+// A Modifier is a struct that contains the mask, the virtual key code, the
+// virtual scan code, and the modifier flag for a modifier key.
 type Modifier struct {
 	Mask byte   // high-order bitmask of the modifier key
 	VK   byte   // virtual key code of the modifier key
 	VSC  uint16 // virtual scan code of the modifier key
+	Mods Mods   // modifier flag of the modifier key
 }
 
 // RuneToVK translates r to a virtual key code and its shift state. It's
 // recommended to provide hkl by using [windows.GetKeyboardLayout], however, a 0
 // can be provided for hkl to skip detecting a keyboard layout.
-// It returns a pair of 0's with an error if the translation fails, otherwise it
+// It returns a pair of 0's with an error if the translation fails, wrapping
+// [ErrNoKeystroke] for runes outside the Basic Multilingual Plane, otherwise it
 // returns the key code, shift state, and a nil error.
 func RuneToVK(r rune, hkl winapi.Handle) (code byte, shift byte, err error) {
+	// VkKeyScanExW takes a single UTF-16 code unit, so runes outside the Basic
+	// Multilingual Plane have no key.
+	if r > 0xFFFF {
+		return 0, 0, fmt.Errorf("%w: rune %q is outside the Basic Multilingual Plane", ErrNoKeystroke, r)
+	}
+
 	switch r {
 	case '\r':
 		return winapi.VK_UNASSIGNED, 0, nil
@@ -71,9 +133,16 @@ func RuneToVK(r rune, hkl winapi.Handle) (code byte, shift byte, err error) {
 // RuneToVSC translates r to a virtual scan code and its shift state. It's
 // recommended to provide hkl by using [windows.GetKeyboardLayout], however, a 0
 // can be provided for hkl to skip detecting a keyboard layout.
-// It returns a pair of 0's with an error if the translation fails, otherwise it
+// It returns a pair of 0's with an error if the translation fails, wrapping
+// [ErrNoKeystroke] for runes outside the Basic Multilingual Plane, otherwise it
 // returns the scan code, shift state, and a nil error.
 func RuneToVSC(r rune, hkl winapi.Handle) (code uint16, shift byte, err error) {
+	// VkKeyScanExW takes a single UTF-16 code unit, so runes outside the Basic
+	// Multilingual Plane have no key.
+	if r > 0xFFFF {
+		return 0, 0, fmt.Errorf("%w: rune %q is outside the Basic Multilingual Plane", ErrNoKeystroke, r)
+	}
+
 	switch r {
 	case '\r':
 		return VSC_UNASSIGNED, 0, nil
@@ -98,6 +167,23 @@ func RuneToVSC(r rune, hkl winapi.Handle) (code uint16, shift byte, err error) {
 	return uint16(vsc), shift, nil
 }
 
+// Keymap returns the [Layout] of the keyboard layout hkl, whose
+// [Layout.ReverseKeymap] is the table that runes are translated with. It is
+// built once with ToUnicodeEx and reused until a different keyboard layout is
+// asked for, such as after the foreground window switches layouts.
+func Keymap(hkl winapi.Handle) *Layout { return keymaps.get(hkl) }
+
+// SystemLayoutSource returns the [LayoutSource] of the keyboard layout of the
+// foreground window, which reports its [Keymap].
+func SystemLayoutSource() LayoutSource {
+	return LayoutSourceFunc(func() (*Layout, error) {
+		var pid uint32
+		tid, _ := windows.GetWindowThreadProcessId(windows.GetForegroundWindow(), &pid)
+
+		return Keymap(windows.GetKeyboardLayout(tid)), nil
+	})
+}
+
 // KeyIsDown detects the down state of virtKey.
 // It returns true if the key is currently depressed and false if it is not.
 func KeyIsDown(virtKey byte) bool {
@@ -124,13 +210,26 @@ func KeyRelease(key uint16, flags winapi.KiFlags) error {
 // defined by [KeyPressDuration].
 // It returns an error if the call fails.
 func KeyTap(key uint16, flags winapi.KiFlags) error {
+	return KeyTapContext(context.Background(), key, flags)
+}
+
+// KeyTapContext is like [KeyTap] but sends nothing if ctx is already done and
+// cuts the pause short when ctx is done, still releasing the key.
+// It returns an error if the call fails or ctx is done.
+func KeyTapContext(ctx context.Context, key uint16, flags winapi.KiFlags) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	var errs []error
 
 	if err := KeyPress(key, flags); err != nil {
 		errs = append(errs, err)
 	}
 
-	time.Sleep(KeyPressDuration)
+	if err := sleepContext(ctx, KeyPressDuration); err != nil {
+		errs = append(errs, err)
+	}
 
 	if err := KeyRelease(key, flags); err != nil {
 		errs = append(errs, err)
@@ -139,6 +238,15 @@ func KeyTap(key uint16, flags winapi.KiFlags) error {
 	return errors.Join(errs...)
 }
 
+// SendCombo parses combo with [ParseCombo] and sends it with scan codes.
+// It returns an error if the call fails.
+func SendCombo(combo string) error { return SendComboOn(&windowsBackend{}, combo) }
+
+// RunScript runs s using [TypeString] options, preparing the foreground window
+// the same way [TypeStr] does.
+// It returns an error if the call fails.
+func RunScript(s *Script) error { return RunScriptOn(&windowsBackend{}, s) }
+
 // TypeStr types str using [TypeString] options and ensures accuracy by
 // attaching the current thread to the thread of the foreground window and
 // temporary blocking input while attached. A timeout prevents the function call
@@ -146,180 +254,274 @@ func KeyTap(key uint16, flags winapi.KiFlags) error {
 // operation.
 // It returns an error if the call fails.
 func TypeStr(str string) (err error) {
-	if len(str) == 0 {
-		return nil
-	} else if len(str) > TypeString.MaxCharacters {
-		return fmt.Errorf("%s", ErrMaxCharacter)
-	}
+	return TypeStrOn(&windowsBackend{}, str)
+}
 
-	hwnd := windows.GetForegroundWindow()
+// TypeStrContext is like [TypeStr] but types until it is done or ctx is done.
+// Unlike [TypeStr], it is not aborted by [AbortTypeStr].
+// It returns an error if the call fails.
+func TypeStrContext(ctx context.Context, str string) (err error) {
+	return TypeStrOnContext(ctx, &windowsBackend{}, str)
+}
 
-	var (
-		pid         uint32
-		tidAttachTo uint32
-	)
+// TypeStrFrom is like [TypeStr] but skips the first offset runes of str, such
+// as the Offset of a [StopError] to resume typing where it stopped.
+// It returns an error if the call fails.
+func TypeStrFrom(str string, offset int) (err error) {
+	return TypeStrOnFrom(&windowsBackend{}, str, offset)
+}
 
-	if hwnd != 0 {
-		tidAttachTo, _ = windows.GetWindowThreadProcessId(hwnd, &pid)
+// LockState detects the lock keys that are on.
+// It always returns a nil error.
+func LockState() (Locks, error) { return (&windowsBackend{}).LockState() }
+
+// SetLockState turns the lock keys of locks on or off by tapping them, see
+// [SetLockStateOn].
+// It returns an error if the call fails.
+func SetLockState(locks Locks, on bool) error {
+	return SetLockStateOn(&windowsBackend{}, locks, on)
+}
+
+// newKeyEvent creates an input that can be processed by [winapi.SendInput].
+func newKeyEvent(key uint16, flags winapi.KiFlags) []winapi.INPUT_Ki {
+	ki := winapi.KEYBDINPUT{Vk: 0, Scan: 0, Flags: flags}
+
+	if flags&(winapi.KEYEVENTF_SCANCODE|winapi.KEYEVENTF_UNICODE) != 0 {
+		ki.Scan = key
+	} else {
+		ki.Vk = key
 	}
 
-	tidAttach := windows.GetCurrentThreadId()
-	attached := false
-	if tidAttachTo != 0 && tidAttach != tidAttachTo {
-		if err = winapi.AttachThreadInput(tidAttach, tidAttachTo, true); err == nil {
-			attached = true
-			defer func() { _ = winapi.AttachThreadInput(tidAttach, tidAttachTo, false) }()
+	return []winapi.INPUT_Ki{winapi.NewKeybdInput(ki)}
+}
+
+// windowsBackend is the [Backend] that sends key events with SendInput.
+type windowsBackend struct {
+	hkl winapi.Handle
+}
+
+var (
+	_ Backend             = (*windowsBackend)(nil)
+	_ Composer            = (*windowsBackend)(nil)
+	_ UnicodeTyper        = (*windowsBackend)(nil)
+	_ LockReporter        = (*windowsBackend)(nil)
+	_ PhysicalKeyReporter = (*windowsBackend)(nil)
+)
+
+func (*windowsBackend) Name() string               { return "windows" }
+func (*windowsBackend) Capabilities() Capabilities { return CapKeyState }
+func (*windowsBackend) Close() error               { return nil }
+
+func (b *windowsBackend) KeyPress(code KeyCode) error {
+	scan, flags := b.scanCode(code)
+	return KeyPress(scan, flags)
+}
+
+func (b *windowsBackend) KeyRelease(code KeyCode) error {
+	scan, flags := b.scanCode(code)
+	return KeyRelease(scan, flags)
+}
+
+func (*windowsBackend) LockState() (Locks, error) {
+	var locks Locks
+	for lock, vk := range lockVKs {
+		if _, toggled := winapi.GetKeyState(vk); toggled {
+			locks |= lock
 		}
 	}
 
-	_ = winapi.BringWindowToTop(hwnd)
-	_ = winapi.SetForegroundWindow(hwnd)
-	_, _ = winapi.SetFocus(hwnd)
+	return locks, nil
+}
 
-	blocked := false
-	if err = winapi.BlockInput(true); err == nil {
-		blocked = true
-		defer func() { _ = winapi.BlockInput(false) }()
+func (b *windowsBackend) KeyIsDown(code KeyCode) bool {
+	vk, ok := b.virtualKey(code)
+	return ok && KeyIsDown(vk)
+}
+
+// PhysicalKeyIsDown reports whether code is down with GetAsyncKeyState, which
+// reads the state of the keyboard rather than the one of the input queue.
+func (b *windowsBackend) PhysicalKeyIsDown(code KeyCode) bool {
+	vk, ok := b.virtualKey(code)
+	if !ok {
+		return false
 	}
 
-	TypeString.mu.Lock()
-	TypeString.abort = make(chan struct{})
-	abort := TypeString.abort
-	TypeString.mu.Unlock()
+	r1, _, _ := procGetAsyncKeyState.Call(uintptr(vk))
+	return int16(r1) < 0
+}
+
+// virtualKey maps code onto its virtual key code with the layout of b.
+func (b *windowsBackend) virtualKey(code KeyCode) (byte, bool) {
+	scan, ok := scanCodes[code]
+	if !ok {
+		scan = uint16(code)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), TypeString.Timeout)
-	defer cancel()
+	vk, err := winapi.MapVirtualKeyExW(uint32(scan), winapi.MAPVK_VSC_TO_VK_EX, b.hkl)
+	if err != nil {
+		return 0, false
+	}
 
-	done := make(chan error, 1)
-	go func() {
-		hkl := windows.GetKeyboardLayout(tidAttachTo)
-		done <- typeStr(str, hkl)
-	}()
+	return byte(vk), true
+}
 
-	cleanup := func() {
-		if blocked {
-			_ = winapi.BlockInput(false)
+func (b *windowsBackend) RuneToKeystroke(r rune) (Keystroke, error) {
+	return Keymap(b.hkl).RuneToKeystroke(r)
+}
+
+// ComposeKeystrokes plans the dead key sequence that types r, see
+// [Layout.ComposeKeystrokes].
+func (b *windowsBackend) ComposeKeystrokes(r rune) ([]Keystroke, error) {
+	return Keymap(b.hkl).ComposeKeystrokes(r)
+}
+
+// describeKeymap describes the keyboard layout hkl by translating every key
+// with ToUnicodeEx for each modifier state of [keymapMods], which also reports
+// the spacing accents of its dead keys.
+func describeKeymap(hkl winapi.Handle) *Layout {
+	l := &Layout{
+		Name: "windows",
+		Keys: map[Keystroke]rune{
+			{Code: KEY_ENTER}: '\n',
+			{Code: KEY_TAB}:   '\t',
+			{Code: KEY_SPACE}: ' ',
+		},
+		DeadKeys: make(map[Keystroke]rune),
+	}
+
+	for vk := uint32(windows.VK_SPACE); vk <= 0xFE; vk++ {
+		// The keys of the numeric keypad depend on Num Lock.
+		if vk >= windows.VK_NUMPAD0 && vk <= windows.VK_DIVIDE {
+			continue
 		}
-		if attached {
-			_ = winapi.AttachThreadInput(tidAttach, tidAttachTo, false)
+
+		vsc, err := winapi.MapVirtualKeyExW(vk, winapi.MAPVK_VK_TO_VSC_EX, hkl)
+		if err != nil || vsc == 0 {
+			continue
 		}
-	}
 
-	select {
-	case typeStrErr := <-done:
-		if typeStrErr != nil {
-			return fmt.Errorf("%s: %v", ErrUncaught, typeStrErr)
+		code, ok := keyCodes[uint16(vsc)]
+		if !ok {
+			code = KeyCode(vsc)
+		}
+
+		for _, mods := range keymapMods {
+			var state [256]byte
+			for _, m := range StandardMods {
+				if mods&m.Mods != 0 {
+					state[m.VK] = 0x80
+				}
+			}
+			// Windows reports AltGr as the left Control key held along
+			// with the right Alt key.
+			if mods&ModAltGr != 0 {
+				state[windows.VK_LCONTROL] = 0x80
+			}
+			state[windows.VK_SHIFT] = state[windows.VK_LSHIFT] | state[windows.VK_RSHIFT]
+			state[windows.VK_CONTROL] = state[windows.VK_LCONTROL] | state[windows.VK_RCONTROL]
+			state[windows.VK_MENU] = state[windows.VK_LMENU] | state[windows.VK_RMENU]
+
+			// The 0x4 flag leaves the dead key state of the keyboard
+			// untouched.
+			var buf [4]uint16
+			n := windows.ToUnicodeEx(vk, vsc, &state[0], &buf[0], int32(len(buf)), 0x4, hkl)
+
+			ks := Keystroke{Code: code, Mods: mods}
+			switch {
+			case n == -1:
+				l.DeadKeys[ks] = rune(buf[0])
+			case n == 1 && buf[0] >= ' ' && buf[0] != 0x7F:
+				l.Keys[ks] = rune(buf[0])
+			case n == 2 && utf16.IsSurrogate(rune(buf[0])):
+				l.Keys[ks] = utf16.DecodeRune(rune(buf[0]), rune(buf[1]))
+			}
 		}
-		return nil
-	case <-ctx.Done():
-		abortFlag = true
-		cleanup()
-		return fmt.Errorf("%s", ErrTimeout)
-	case <-abort:
-		abortFlag = true
-		cleanup()
-		return fmt.Errorf("%s", ErrAborted)
 	}
+
+	return l
 }
 
-// newKeyEvent creates an input that can be processed by [winapi.SendInput].
-func newKeyEvent(key uint16, flags winapi.KiFlags) []winapi.INPUT_Ki {
-	ki := winapi.KEYBDINPUT{Vk: 0, Scan: 0, Flags: flags}
+// TypeRune types r with KEYEVENTF_UNICODE input, sending a surrogate pair
+// for runes outside the Basic Multilingual Plane.
+func (*windowsBackend) TypeRune(r rune) error {
+	units := utf16.Encode([]rune{r})
 
-	if flags&(winapi.KEYEVENTF_SCANCODE|winapi.KEYEVENTF_UNICODE) != 0 {
-		ki.Scan = key
-	} else {
-		ki.Vk = key
+	inputs := make([]winapi.INPUT_Ki, 0, 2*len(units))
+	for _, u := range units {
+		inputs = append(inputs, newKeyEvent(u, winapi.KEYEVENTF_UNICODE)...)
+	}
+	for _, u := range units {
+		inputs = append(inputs, newKeyEvent(u, winapi.KEYEVENTF_UNICODE|winapi.KEYEVENTF_KEYUP)...)
 	}
 
-	return []winapi.INPUT_Ki{winapi.NewKeybdInput(ki)}
+	return winapi.SendInput(inputs)
 }
 
-// setMods sets the modifier key state for the current and next iteration of a
-// modifier key.
-func setMods(flags winapi.KiFlags, mods byte, modsNext byte) bool {
-	var modsSetCount uint
-	for _, m := range StandardMods {
-		if mods&m.Mask != 0 {
-			if flags&winapi.KEYEVENTF_KEYUP != 0 {
-				if modsNext&m.Mask == 0 {
-					_ = KeyRelease(m.VSC, flags)
-					modsSetCount++
-				}
-			} else {
-				if !KeyIsDown(m.VK) {
-					_ = KeyPress(m.VSC, flags)
-					modsSetCount++
-				}
-			}
-		}
+// scanCode translates code to a scan code without the extended prefix and the
+// flags needed to send it.
+func (b *windowsBackend) scanCode(code KeyCode) (uint16, winapi.KiFlags) {
+	scan, ok := scanCodes[code]
+	if !ok {
+		scan = uint16(code)
+	}
+
+	flags := winapi.KEYEVENTF_SCANCODE
+	if scan&0xFF00 == 0xE000 {
+		flags |= winapi.KEYEVENTF_EXTENDEDKEY
 	}
 
-	return modsSetCount > 0
+	return scan & 0xFF, flags
 }
 
-// typeStr is the base function for TypeStr that primarily handles the rune
-// translation and the actual key presses.
-func typeStr(str string, hkl winapi.Handle) (err error) {
-	runes := []rune(str)
-	iLast := len(runes) - 1
+// prepare attaches the current thread to the thread of the foreground window,
+// focuses it, and blocks input until the returned function is called.
+func (b *windowsBackend) prepare() (cleanup func(), err error) {
+	hwnd := windows.GetForegroundWindow()
 
 	var (
-		errCount int
-		vscNext  uint16
-		modsNext byte
+		pid         uint32
+		tidAttachTo uint32
 	)
 
-	vsc, mods, err := RuneToVSC(runes[0], hkl)
-	if err != nil {
-		errCount++
+	if hwnd != 0 {
+		tidAttachTo, _ = windows.GetWindowThreadProcessId(hwnd, &pid)
 	}
 
-	for i, r := range runes {
-		if abortFlag {
-			abortFlag = false
-			return fmt.Errorf("%s", ErrAborted)
+	tidAttach := windows.GetCurrentThreadId()
+	attached := false
+	if tidAttachTo != 0 && tidAttach != tidAttachTo {
+		if err = winapi.AttachThreadInput(tidAttach, tidAttachTo, true); err == nil {
+			attached = true
 		}
+	}
 
-		modFlags := winapi.KEYEVENTF_SCANCODE
-		if modsSet := setMods(modFlags, mods, 0); modsSet {
-			time.Sleep(TypeString.ModPressDuration)
-		}
+	_ = winapi.BringWindowToTop(hwnd)
+	_ = winapi.SetForegroundWindow(hwnd)
+	_, _ = winapi.SetFocus(hwnd)
 
-		numTaps := 1
-		if r == '\t' && TypeString.TabsToSpaces {
-			vsc = VSC_SPACE
-			numTaps = TypeString.TabSize
-		}
+	blocked := false
+	if err = winapi.BlockInput(true); err == nil {
+		blocked = true
+	}
 
-		for range numTaps {
-			if err = KeyTap(vsc, modFlags); err != nil {
-				errCount++
-			}
-		}
+	b.hkl = windows.GetKeyboardLayout(tidAttachTo)
 
-		if i < iLast {
-			vscNext, modsNext, err = RuneToVSC(runes[i+1], hkl)
-			if err != nil {
-				errCount++
-			}
-		} else if i == iLast {
-			modsNext = 0
+	return func() {
+		if blocked {
+			_ = winapi.BlockInput(false)
 		}
-
-		modFlags |= winapi.KEYEVENTF_KEYUP
-		_ = setMods(modFlags, mods, modsNext)
-
-		if i < iLast {
-			vsc = vscNext
-			mods = modsNext
-			time.Sleep(TypeString.KeyDelay)
+		if attached {
+			_ = winapi.AttachThreadInput(tidAttach, tidAttachTo, false)
 		}
-	}
+	}, nil
+}
 
-	if errCount == 0 {
-		return nil
+func init() {
+	for code, scan := range scanCodes {
+		keyCodes[scan] = code
 	}
 
-	return err
+	RegisterBackend("windows", func() (Backend, error) {
+		return &windowsBackend{hkl: windows.GetKeyboardLayout(0)}, nil
+	})
 }
@@ -3,6 +3,7 @@
 package keybd_test
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -14,6 +15,24 @@ import (
 )
 
 var enabled = map[string]bool{
+	"Backend":             true,
+	"Recorder":            true,
+	"Typer":               true,
+	"Combo":               true,
+	"Script":              true,
+	"Strategy":            true,
+	"Grapheme":            true,
+	"Layout":              true,
+	"XKB":                 true,
+	"Watcher":             true,
+	"Rhythm":              true,
+	"Typo":                true,
+	"Pause":               true,
+	"Observer":            true,
+	"Release":             true,
+	"Mods":                true,
+	"Lock":                true,
+	"Preflight":           true,
 	"RuneToVK":            true,
 	"RuneToVSC":           true,
 	"KeyIsDown":           true,
@@ -62,8 +81,8 @@ func TestRuneToVK(t *testing.T) {
 					t.Errorf(test.ErrWantFGotF, want, got)
 				}
 			} else {
-				if err == nil {
-					t.Errorf(test.ErrWantFGotF, "error", "none")
+				if !errors.Is(err, keybd.ErrNoKeystroke) {
+					t.Errorf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
 				}
 			}
 		})
@@ -104,14 +123,33 @@ func TestRuneToVSC(t *testing.T) {
 					t.Errorf(test.ErrWantFGotF, want, got)
 				}
 			} else {
-				if err == nil {
-					t.Errorf(test.ErrWantFGotF, "error", "none")
+				if !errors.Is(err, keybd.ErrNoKeystroke) {
+					t.Errorf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
 				}
 			}
 		})
 	}
 }
 
+func TestKeymap(t *testing.T) {
+	tName := "Layout"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	l := keybd.Keymap(hkl)
+	if got := keybd.Keymap(hkl); got != l {
+		t.Errorf(test.ErrWantFGotF, "cached keymap", "rebuilt keymap")
+	}
+
+	keymap := l.ReverseKeymap()
+	for _, r := range []rune{testRunes["lower"], testRunes["upper"], ' ', '\n', '\t'} {
+		if _, ok := keymap[r]; !ok {
+			t.Errorf(test.ErrWantFGotF, r, "no keystroke")
+		}
+	}
+}
+
 func TestRealKeyPress_KeyRelease(t *testing.T) {
 	tName := "KeyPress|KeyRelease"
 	if !enabled[tName] {
@@ -0,0 +1,876 @@
+//go:build linux
+
+package keybd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Constants for X11 core protocol opcodes.
+//
+// See: https://www.x.org/releases/X11R7.7/doc/xproto/x11protocol.html
+const (
+	x11InternAtom            = 16
+	x11GetProperty           = 20
+	x11QueryKeymap           = 44
+	x11GetInputFocus         = 43
+	x11QueryExtension        = 98
+	x11ChangeKeyboardMapping = 100
+	x11GetKeyboardMapping    = 101
+	x11GetKeyboardControl    = 103
+	x11GetModifierMapping    = 119
+)
+
+// Constants for the XTEST extension.
+//
+// See: https://www.x.org/releases/X11R7.7/doc/xextproto/xtest.html
+const (
+	xtestFakeInput  = 2
+	xtestKeyPress   = 2
+	xtestKeyRelease = 3
+)
+
+// Constants for the XKEYBOARD extension.
+//
+// See: https://www.x.org/releases/X11R7.7/doc/kbproto/xkbproto.html
+const (
+	xkbUseExtension = 0
+	xkbGetState     = 4
+	xkbUseCoreKbd   = 0x100
+)
+
+// Constants for X11 keysyms that do not map directly onto a rune.
+const (
+	XK_BackSpace        = 0xFF08
+	XK_Tab              = 0xFF09
+	XK_Return           = 0xFF0D
+	XK_Escape           = 0xFF1B
+	XK_Multi_key        = 0xFF20
+	XK_Mode_switch      = 0xFF7E
+	XK_Shift_L          = 0xFFE1
+	XK_Shift_R          = 0xFFE2
+	XK_Control_L        = 0xFFE3
+	XK_Control_R        = 0xFFE4
+	XK_Alt_L            = 0xFFE9
+	XK_Alt_R            = 0xFFEA
+	XK_Super_L          = 0xFFEB
+	XK_Super_R          = 0xFFEC
+	XK_ISO_Level3_Shift = 0xFE03
+)
+
+// rightModKeysyms maps the keysyms of the right modifier keys onto their key
+// codes, which are bound to the X11 key codes that the modifier mapping lists
+// them at.
+var rightModKeysyms = map[uint32]KeyCode{
+	XK_Shift_R:   KEY_RIGHTSHIFT,
+	XK_Control_R: KEY_RIGHTCTRL,
+	XK_Super_R:   KEY_RIGHTMETA,
+}
+
+// deadKeysyms maps the X11 dead keysyms to the spacing accents that their dead
+// keys type when followed by a space.
+var deadKeysyms = map[uint32]rune{
+	0xFE50: '`', // dead_grave
+	0xFE51: '´', // dead_acute
+	0xFE52: '^', // dead_circumflex
+	0xFE53: '~', // dead_tilde
+	0xFE54: '¯', // dead_macron
+	0xFE55: '˘', // dead_breve
+	0xFE56: '˙', // dead_abovedot
+	0xFE57: '¨', // dead_diaeresis
+	0xFE58: '˚', // dead_abovering
+	0xFE59: '˝', // dead_doubleacute
+	0xFE5A: 'ˇ', // dead_caron
+	0xFE5B: '¸', // dead_cedilla
+	0xFE5C: '˛', // dead_ogonek
+}
+
+// x11MappingNotify is the event code sent to every client when the keyboard
+// mapping changes.
+const x11MappingNotify = 34
+
+// An X11 is a connection to an X server that synthesizes key events through
+// the XTEST extension. It implements [Backend], so key codes used by its
+// methods are Linux key codes, which are offset by 8 to get the X11 key codes
+// the way the evdev driver of the X server does. Modifier keys are mapped onto
+// whichever X11 key codes the modifier mapping of the X server binds them to.
+type X11 struct {
+	conn       net.Conn
+	rw         *bufio.ReadWriter
+	seq        uint16
+	minKeycode byte
+	maxKeycode byte
+	xtest      byte
+	xkb        byte
+	root       uint32
+	stale      bool
+	spare      byte
+	layout     *Layout
+	compose    *ComposeTable
+	composeSet bool
+	modCodes   map[KeyCode]byte
+	mu         sync.Mutex
+}
+
+var (
+	_ Backend             = (*X11)(nil)
+	_ Composer            = (*X11)(nil)
+	_ UnicodeTyper        = (*X11)(nil)
+	_ LockReporter        = (*X11)(nil)
+	_ PhysicalKeyReporter = (*X11)(nil)
+)
+
+// x11LEDs lists the lock flags in the order of the keyboard LEDs that show
+// them, which are the first three by convention.
+var x11LEDs = []Locks{LockCaps, LockNum, LockScroll}
+
+// An X11Error is an error reported by the X server in response to a request.
+type X11Error struct {
+	Code   byte   // error code
+	Opcode byte   // major opcode of the failed request
+	Seq    uint16 // sequence number of the failed request
+}
+
+func (e *X11Error) Error() string {
+	return fmt.Sprintf("X11 error %d for request %d (seq %d)", e.Code, e.Opcode, e.Seq)
+}
+
+// OpenX11 connects to the X server identified by display, authenticating with
+// the matching MIT-MAGIC-COOKIE-1 entry of the Xauthority file when one
+// exists. An empty display uses the DISPLAY environment variable.
+// It returns nil with an error if the call fails.
+func OpenX11(display string) (*X11, error) {
+	if display == "" {
+		display = os.Getenv("DISPLAY")
+	}
+
+	host, number, err := parseDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if host == "" || host == "unix" {
+		conn, err = net.Dial("unix", "/tmp/.X11-unix/X"+number)
+	} else {
+		n, _ := strconv.Atoi(number)
+		conn, err = net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(6000+n)))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	authName, authData := readXauthority(host, number)
+
+	x, err := newX11(conn, authName, authData)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return x, nil
+}
+
+// NewX11 performs the X11 connection setup without authentication over an
+// already established conn.
+// It returns nil with an error if the call fails.
+func NewX11(conn net.Conn) (*X11, error) { return newX11(conn, "", nil) }
+
+// Close closes the connection to the X server.
+// It returns an error if the call fails.
+func (x *X11) Close() error { return x.conn.Close() }
+
+// Name returns the name the backend is registered under.
+func (x *X11) Name() string { return "x11" }
+
+// Capabilities returns the capability flags of the backend.
+func (x *X11) Capabilities() Capabilities { return CapKeyState }
+
+// RuneToKeystroke translates r to a keystroke using the keyboard mapping of the
+// X server.
+// It returns a zero [Keystroke] with an error if the translation fails,
+// otherwise it returns the keystroke and a nil error.
+func (x *X11) RuneToKeystroke(r rune) (Keystroke, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if r == '\r' {
+		return Keystroke{}, nil
+	}
+
+	if x.stale {
+		if err := x.loadMapping(); err != nil {
+			return Keystroke{}, err
+		}
+	}
+
+	return x.layout.RuneToKeystroke(r)
+}
+
+// ComposeKeystrokes plans the dead key or Compose sequence that types r using
+// the keyboard mapping of the X server, see [Layout.ComposeKeystrokes]. When
+// the mapping binds a Compose key, the Compose sequences are read with
+// [LoadCompose] the first time.
+// It returns nil with an error if r cannot be planned.
+func (x *X11) ComposeKeystrokes(r rune) ([]Keystroke, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.stale {
+		if err := x.loadMapping(); err != nil {
+			return nil, err
+		}
+	}
+
+	return x.layout.ComposeKeystrokes(r)
+}
+
+// Layout returns the description of the keyboard mapping of the X server.
+func (x *X11) Layout() *Layout {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.layout
+}
+
+// XKBNames reads the XKB names of the active keyboard layout from the
+// _XKB_RULES_NAMES property of the root window, which the X server sets when
+// it compiles its keymap and setxkbmap updates when it switches layouts.
+// It returns a zero [RMLVO] with an error if the call fails.
+func (x *X11) XKBNames() (RMLVO, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	name := "_XKB_RULES_NAMES"
+	reply, err := x.roundTrip(x11Request(x11InternAtom, 1, u16(uint16(len(name))), []byte{0, 0}, pad([]byte(name))))
+	if err != nil {
+		return RMLVO{}, err
+	}
+
+	atom := binary.LittleEndian.Uint32(reply[8:])
+	if atom == 0 {
+		return RMLVO{}, errors.New("X server has no _XKB_RULES_NAMES property")
+	}
+
+	req := make([]byte, 20)
+	binary.LittleEndian.PutUint32(req[0:], x.root)
+	binary.LittleEndian.PutUint32(req[4:], atom)
+	binary.LittleEndian.PutUint32(req[16:], 1024)
+	if reply, err = x.roundTrip(x11Request(x11GetProperty, 0, req)); err != nil {
+		return RMLVO{}, err
+	}
+
+	n := int(binary.LittleEndian.Uint32(reply[16:]))
+	if reply[1] != 8 || 32+n > len(reply) {
+		return RMLVO{}, errors.New("X server has no _XKB_RULES_NAMES property")
+	}
+
+	fields := strings.Split(string(reply[32:32+n]), "\x00")
+	fields = append(fields, make([]string, 5)...)
+
+	return RMLVO{
+		Rules:   fields[0],
+		Model:   fields[1],
+		Layout:  fields[2],
+		Variant: fields[3],
+		Options: fields[4],
+	}, nil
+}
+
+// XKBGroup reads the index of the active group of the keyboard from the
+// XKEYBOARD extension, which is the index of the layout of [X11.XKBNames] that
+// the user switched to, starting at 0.
+// It returns an error if the call fails.
+func (x *X11) XKBGroup() (int, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.xkb == 0 {
+		return 0, errors.New("X server does not support the XKEYBOARD extension")
+	}
+
+	reply, err := x.roundTrip(x11Request(x.xkb, xkbGetState, u16(xkbUseCoreKbd), []byte{0, 0}))
+	if err != nil {
+		return 0, err
+	}
+
+	return int(reply[12]), nil
+}
+
+// TypeRune types r by binding its keysym to a spare key code, one that the
+// keyboard mapping of the X server leaves unbound, and tapping that key code.
+// The duration of the tap is defined by [KeyPressDuration].
+// It returns an error if the call fails.
+func (x *X11) TypeRune(r rune) error {
+	x.mu.Lock()
+
+	if x.spare == 0 {
+		x.mu.Unlock()
+		return fmt.Errorf("%w: %q: no spare X11 key code", ErrNoKeystroke, r)
+	}
+
+	ks := binary.LittleEndian.AppendUint32(nil, runeToKeysym(r))
+	req := x11Request(x11ChangeKeyboardMapping, 1, []byte{x.spare, 2, 0, 0}, ks, ks)
+	_, err := x.send(req)
+	if err == nil {
+		_, err = x.roundTrip(x11Request(x11GetInputFocus, 0))
+	}
+	code := KeyCode(x.spare) - 8
+
+	x.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return keyTap(context.Background(), x, code, KeyPressDuration)
+}
+
+// LockState detects the lock keys that are on from the LEDs of the keyboard of
+// the X server.
+// It returns an error if the call fails.
+func (x *X11) LockState() (Locks, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	reply, err := x.roundTrip(x11Request(x11GetKeyboardControl, 0))
+	if err != nil {
+		return 0, err
+	}
+
+	mask := binary.LittleEndian.Uint32(reply[8:])
+
+	var locks Locks
+	for i, lock := range x11LEDs {
+		if mask&(1<<i) != 0 {
+			locks |= lock
+		}
+	}
+
+	return locks, nil
+}
+
+// KeyIsDown detects the down state of code as reported by the X server.
+// It returns true if the key is currently depressed and false if it is not.
+func (x *X11) KeyIsDown(code KeyCode) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	reply, err := x.roundTrip(x11Request(x11QueryKeymap, 0))
+	if err != nil {
+		return false
+	}
+
+	kc := x.keycode(code)
+
+	return reply[8+kc/8]&(1<<(kc%8)) != 0
+}
+
+// PhysicalKeyIsDown detects the down state of code with QueryKeymap, like
+// [X11.KeyIsDown]. The X server keeps a key down while any keyboard holds it,
+// so a key released by the XTest device is still down while held physically.
+func (x *X11) PhysicalKeyIsDown(code KeyCode) bool { return x.KeyIsDown(code) }
+
+// KeyPress sends a key-down event and is intended to be used before a call to
+// [X11.KeyRelease].
+// It returns an error if the call fails.
+func (x *X11) KeyPress(code KeyCode) error { return x.fakeInput(xtestKeyPress, code) }
+
+// KeyRelease sends a key-up event and is intended to be used after a call to
+// [X11.KeyPress].
+// It returns an error if the call fails.
+func (x *X11) KeyRelease(code KeyCode) error { return x.fakeInput(xtestKeyRelease, code) }
+
+// KeyTap sends a key-down event and a key-up event with a brief pause in
+// between to help simulate an actual keystroke. The duration of the pause is
+// defined by [KeyPressDuration].
+// It returns an error if the call fails.
+func (x *X11) KeyTap(code KeyCode) error { return KeyTapOn(x, code) }
+
+// KeyTapContext is like [X11.KeyTap] but sends nothing if ctx is already done
+// and cuts the pause short when ctx is done, still releasing the key.
+// It returns an error if the call fails or ctx is done.
+func (x *X11) KeyTapContext(ctx context.Context, code KeyCode) error {
+	return KeyTapOnContext(ctx, x, code)
+}
+
+// SendCombo parses combo with [ParseCombo] and sends it.
+// It returns an error if the call fails.
+func (x *X11) SendCombo(combo string) error { return SendComboOn(x, combo) }
+
+// RunScript runs s using [TypeString] options.
+// It returns an error if the call fails.
+func (x *X11) RunScript(s *Script) error { return RunScriptOn(x, s) }
+
+// TypeStr types str using [TypeString] options. A timeout prevents the function
+// call from hanging indefinitely while an abort channel allows aborting the
+// operation.
+// It returns an error if the call fails.
+func (x *X11) TypeStr(str string) error { return TypeStrOn(x, str) }
+
+// TypeStrContext types str using [TypeString] options until it is done or ctx
+// is done. Unlike [X11.TypeStr], it is not aborted by [AbortTypeStr].
+// It returns an error if the call fails.
+func (x *X11) TypeStrContext(ctx context.Context, str string) error {
+	return TypeStrOnContext(ctx, x, str)
+}
+
+// newX11 is the base function for OpenX11 and NewX11 that performs the
+// connection setup and loads the keyboard mapping.
+func newX11(conn net.Conn, authName string, authData []byte) (*X11, error) {
+	x := &X11{
+		conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}
+
+	if err := x.setup(authName, authData); err != nil {
+		return nil, err
+	}
+
+	reply, err := x.roundTrip(x11Request(x11QueryExtension, 0, u16(5), []byte{0, 0}, pad([]byte("XTEST"))))
+	if err != nil {
+		return nil, err
+	}
+	if reply[8] == 0 {
+		return nil, errors.New("X server does not support the XTEST extension")
+	}
+	x.xtest = reply[9]
+
+	// The XKEYBOARD extension is optional, since only the active group of
+	// the keyboard is read from it.
+	reply, err = x.roundTrip(x11Request(x11QueryExtension, 0, u16(9), []byte{0, 0}, pad([]byte("XKEYBOARD"))))
+	if err != nil {
+		return nil, err
+	}
+	if reply[8] != 0 {
+		opcode := reply[9]
+		reply, err = x.roundTrip(x11Request(opcode, xkbUseExtension, u16(1), u16(0)))
+		if err != nil {
+			return nil, err
+		}
+		if reply[1] != 0 {
+			x.xkb = opcode
+		}
+	}
+
+	if err = x.loadMapping(); err != nil {
+		return nil, err
+	}
+
+	return x, nil
+}
+
+// setup sends the connection setup request and parses the parts of the reply
+// that are needed for keyboard synthesization.
+func (x *X11) setup(authName string, authData []byte) error {
+	req := []byte{'l', 0}
+	req = append(req, u16(11)...)
+	req = append(req, u16(0)...)
+	req = append(req, u16(uint16(len(authName)))...)
+	req = append(req, u16(uint16(len(authData)))...)
+	req = append(req, 0, 0)
+	req = append(req, pad([]byte(authName))...)
+	req = append(req, pad(authData)...)
+
+	if _, err := x.rw.Write(req); err != nil {
+		return err
+	}
+	if err := x.rw.Flush(); err != nil {
+		return err
+	}
+
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(x.rw, head); err != nil {
+		return err
+	}
+
+	data := make([]byte, 4*int(binary.LittleEndian.Uint16(head[6:])))
+	if _, err := io.ReadFull(x.rw, data); err != nil {
+		return err
+	}
+
+	if head[0] != 1 {
+		reason := data
+		if head[0] == 0 {
+			reason = data[:min(int(head[1]), len(data))]
+		}
+		return fmt.Errorf("X11 connection refused: %s", strings.TrimRight(string(reason), "\x00"))
+	}
+
+	if len(data) < 32 {
+		return errors.New("X11 connection setup reply is truncated")
+	}
+
+	x.minKeycode = data[26]
+	x.maxKeycode = data[27]
+
+	// The root window of the first screen follows the vendor string and the
+	// pixmap formats.
+	if data[20] > 0 {
+		vendorLen := int(binary.LittleEndian.Uint16(data[16:]))
+		off := 32 + len(pad(make([]byte, vendorLen))) + 8*int(data[21])
+		if off+4 <= len(data) {
+			x.root = binary.LittleEndian.Uint32(data[off:])
+		}
+	}
+
+	return nil
+}
+
+// loadMapping reads the keyboard and modifier mappings of the X server and
+// builds the rune translation table from them.
+func (x *X11) loadMapping() error {
+	count := x.maxKeycode - x.minKeycode + 1
+	reply, err := x.roundTrip(x11Request(x11GetKeyboardMapping, 0, []byte{x.minKeycode, count, 0, 0}))
+	if err != nil {
+		return err
+	}
+
+	perKeycode := int(reply[1])
+	keysyms := make([][]uint32, count)
+	for i := range keysyms {
+		keysyms[i] = make([]uint32, perKeycode)
+		for j := range perKeycode {
+			keysyms[i][j] = binary.LittleEndian.Uint32(reply[32+4*(i*perKeycode+j):])
+		}
+	}
+
+	reply, err = x.roundTrip(x11Request(x11GetModifierMapping, 0))
+	if err != nil {
+		return err
+	}
+
+	perModifier := int(reply[1])
+	x.modCodes = make(map[KeyCode]byte)
+
+	// The modifier mapping lists the key codes bound to Shift, Lock, Control
+	// and Mod1 through Mod5, of which Mod1 is Alt and Mod4 is Super by
+	// convention. The right keys are told apart by their keysyms.
+	mapped := []KeyCode{KEY_LEFTSHIFT, KEY_CAPSLOCK, KEY_LEFTCTRL, KEY_LEFTALT, KEY_NUMLOCK, 0, KEY_LEFTMETA, 0}
+
+	var level3 bool
+	for i := range 8 {
+		for j := range perModifier {
+			kc := reply[32+i*perModifier+j]
+			if kc == 0 || kc < x.minKeycode {
+				continue
+			}
+
+			var right bool
+			for _, ks := range keysyms[kc-x.minKeycode] {
+				if code, ok := rightModKeysyms[ks]; ok {
+					right = true
+					if _, ok := x.modCodes[code]; !ok {
+						x.modCodes[code] = kc
+					}
+				}
+				if ks == XK_ISO_Level3_Shift || ks == XK_Mode_switch {
+					level3 = true
+					if _, ok := x.modCodes[KEY_RIGHTALT]; !ok {
+						x.modCodes[KEY_RIGHTALT] = kc
+					}
+				}
+			}
+
+			if _, ok := x.modCodes[mapped[i]]; !ok && mapped[i] != 0 && !right {
+				x.modCodes[mapped[i]] = kc
+			}
+		}
+	}
+
+	// Core keyboard mappings list the levels of the first group at 0 and 1,
+	// and XKB appends the third and fourth levels at 4 and 5.
+	levels := []Mods{0, ModShift}
+	if level3 {
+		levels = append(levels, 0, 0, ModAltGr, ModAltGr|ModShift)
+	}
+
+	// The spare key code is chosen once, since binding a rune to it with
+	// TypeRune fills it in.
+	if x.spare == 0 {
+		for i := len(keysyms) - 1; i >= 0; i-- {
+			if !slices.ContainsFunc(keysyms[i], func(ks uint32) bool { return ks != 0 }) {
+				x.spare = x.minKeycode + byte(i)
+				break
+			}
+		}
+	}
+
+	layout := &Layout{
+		Name:     "x11",
+		Keys:     make(map[Keystroke]rune),
+		DeadKeys: make(map[Keystroke]rune),
+	}
+	for i, syms := range keysyms {
+		if x.minKeycode+byte(i) == x.spare {
+			continue
+		}
+
+		for j, ks := range syms {
+			if j >= len(levels) {
+				break
+			} else if j == 2 || j == 3 {
+				continue
+			}
+
+			key := Keystroke{Code: KeyCode(int(x.minKeycode) + i - 8), Mods: levels[j]}
+			if r, ok := keysymToRune(ks); ok {
+				layout.Keys[key] = r
+			} else if accent, ok := deadKeysyms[ks]; ok {
+				layout.DeadKeys[key] = accent
+			} else if ks == XK_Multi_key && (layout.ComposeKey == Keystroke{} || betterKeystroke(key, layout.ComposeKey)) {
+				layout.ComposeKey = key
+			}
+		}
+	}
+
+	if layout.ComposeKey != (Keystroke{}) && !x.composeSet {
+		x.compose, _ = LoadCompose("")
+		x.composeSet = true
+	}
+	layout.Compose = x.compose
+
+	x.layout = layout
+	x.stale = false
+
+	return nil
+}
+
+// keycode maps code onto the X11 key code that the X server binds it to.
+func (x *X11) keycode(code KeyCode) byte {
+	if kc, ok := x.modCodes[code]; ok {
+		return kc
+	}
+
+	return byte(code + 8)
+}
+
+// fakeInput sends an XTEST FakeInput request for code and waits for the X
+// server to process it.
+func (x *X11) fakeInput(eventType byte, code KeyCode) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	req := x11Request(x.xtest, xtestFakeInput, []byte{eventType, x.keycode(code), 0, 0}, make([]byte, 28))
+	if _, err := x.send(req); err != nil {
+		return err
+	}
+
+	_, err := x.roundTrip(x11Request(x11GetInputFocus, 0))
+
+	return err
+}
+
+// send writes req to the X server and returns its sequence number.
+func (x *X11) send(req []byte) (uint16, error) {
+	if _, err := x.rw.Write(req); err != nil {
+		return 0, err
+	}
+	if err := x.rw.Flush(); err != nil {
+		return 0, err
+	}
+
+	x.seq++
+
+	return x.seq, nil
+}
+
+// roundTrip sends req and reads packets until the reply to it arrives. Errors
+// reported for req or any earlier request are returned.
+func (x *X11) roundTrip(req []byte) ([]byte, error) {
+	seq, err := x.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		packet := make([]byte, 32)
+		if _, err = io.ReadFull(x.rw, packet); err != nil {
+			return nil, err
+		}
+
+		switch packet[0] {
+		case 0:
+			return nil, &X11Error{
+				Code:   packet[1],
+				Opcode: packet[10],
+				Seq:    binary.LittleEndian.Uint16(packet[2:]),
+			}
+		case 1:
+			if n := binary.LittleEndian.Uint32(packet[4:]); n > 0 {
+				extra := make([]byte, 4*int(n))
+				if _, err = io.ReadFull(x.rw, extra); err != nil {
+					return nil, err
+				}
+				packet = append(packet, extra...)
+			}
+			if binary.LittleEndian.Uint16(packet[2:]) == seq {
+				return packet, nil
+			}
+		default:
+			if packet[0]&0x7F == x11MappingNotify {
+				x.stale = true
+			}
+		}
+	}
+}
+
+// x11Request builds a request with opcode and data (the second header byte)
+// followed by body, filling in the length field.
+func x11Request(opcode, data byte, body ...[]byte) []byte {
+	req := []byte{opcode, data, 0, 0}
+	for _, b := range body {
+		req = append(req, b...)
+	}
+	req = pad(req)
+	binary.LittleEndian.PutUint16(req[2:], uint16(len(req)/4))
+
+	return req
+}
+
+// pad pads b with zeros to a multiple of four bytes.
+func pad(b []byte) []byte {
+	if n := len(b) % 4; n != 0 {
+		b = append(b, make([]byte, 4-n)...)
+	}
+
+	return b
+}
+
+// u16 encodes v as two little-endian bytes.
+func u16(v uint16) []byte { return binary.LittleEndian.AppendUint16(nil, v) }
+
+// parseDisplay splits display into its host and display number.
+func parseDisplay(display string) (host, number string, err error) {
+	i := strings.LastIndex(display, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid X11 display %q", display)
+	}
+
+	host, number = display[:i], display[i+1:]
+	if j := strings.Index(number, "."); j >= 0 {
+		number = number[:j]
+	}
+	if _, err = strconv.Atoi(number); err != nil {
+		return "", "", fmt.Errorf("invalid X11 display %q", display)
+	}
+
+	return host, number, nil
+}
+
+// readXauthority looks up the MIT-MAGIC-COOKIE-1 entry for host and number in
+// the Xauthority file. It returns an empty name when no entry matches.
+func readXauthority(host, number string) (name string, data []byte) {
+	path := os.Getenv("XAUTHORITY")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".Xauthority")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil
+	}
+	defer f.Close()
+
+	if host == "" || host == "unix" {
+		host, _ = os.Hostname()
+	}
+
+	r := bufio.NewReader(f)
+	readField := func() ([]byte, error) {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+
+	for {
+		var family uint16
+		if err := binary.Read(r, binary.BigEndian, &family); err != nil {
+			return "", nil
+		}
+
+		fields := make([][]byte, 4)
+		for i := range fields {
+			if fields[i], err = readField(); err != nil {
+				return "", nil
+			}
+		}
+
+		addr, num, authName, authData := string(fields[0]), string(fields[1]), string(fields[2]), fields[3]
+		if authName != "MIT-MAGIC-COOKIE-1" || (num != "" && num != number) {
+			continue
+		}
+
+		// FamilyLocal (256) and FamilyWild (65535) entries match any host.
+		if family == 256 || family == 65535 || addr == host {
+			return authName, authData
+		}
+	}
+}
+
+// keysymToRune translates an X11 keysym to the rune it produces.
+// It returns false if the keysym does not produce a rune.
+func keysymToRune(ks uint32) (rune, bool) {
+	switch {
+	case ks == XK_Return:
+		return '\n', true
+	case ks == XK_Tab:
+		return '\t', true
+	case ks == XK_BackSpace:
+		return '\b', true
+	case ks >= 0x20 && ks <= 0x7E, ks >= 0xA0 && ks <= 0xFF:
+		return rune(ks), true
+	case ks == 0x20AC:
+		return '€', true
+	case ks >= 0x01000100 && ks <= 0x0110FFFF:
+		return rune(ks - 0x01000000), true
+	}
+
+	return 0, false
+}
+
+// runeToKeysym translates r to the X11 keysym that produces it.
+func runeToKeysym(r rune) uint32 {
+	switch {
+	case r == '\n':
+		return XK_Return
+	case r == '\t':
+		return XK_Tab
+	case r == '\b':
+		return XK_BackSpace
+	case r >= 0x20 && r <= 0x7E, r >= 0xA0 && r <= 0xFF:
+		return uint32(r)
+	}
+
+	return uint32(r) + 0x01000000
+}
+
+func init() {
+	RegisterBackend("x11", func() (Backend, error) {
+		x, err := OpenX11("")
+		if err != nil {
+			return nil, err
+		}
+		return x, nil
+	})
+}
@@ -0,0 +1,583 @@
+//go:build linux
+
+package keybd_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+const (
+	fakeMinKeycode = 8
+	fakeMaxKeycode = 255
+	fakeXTEST      = 132
+	fakeXKB        = 133
+	fakeRoot       = 0x2A
+	fakeXKBAtom    = 0x100
+)
+
+// fakeX11 is an in-process X server that implements just enough of the core
+// protocol and the XTEST and XKEYBOARD extensions to drive an [keybd.X11].
+type fakeX11 struct {
+	conn   net.Conn
+	xtest  bool
+	seq    uint16
+	down   [32]byte
+	events []keyEvent
+	remaps map[byte]uint32
+	names  string
+	leds   uint32
+	group  byte
+	queued []byte
+	mu     sync.Mutex
+}
+
+// newFakeX11 starts a fake X server with a US QWERTY keyboard mapping whose key
+// codes are the Linux key codes offset by 8, the way Xorg's evdev driver does.
+func newFakeX11(t *testing.T, xtest bool) (*fakeX11, net.Conn) {
+	t.Helper()
+
+	client, server := net.Pipe()
+	f := &fakeX11{conn: server, xtest: xtest}
+
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+	})
+
+	go f.serve()
+
+	return f, client
+}
+
+// keyEvents returns the key events received so far with the key codes
+// translated back to Linux key codes.
+func (f *fakeX11) keyEvents() []keyEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]keyEvent(nil), f.events...)
+}
+
+func (f *fakeX11) serve() {
+	setup := make([]byte, 12)
+	if _, err := io.ReadFull(f.conn, setup); err != nil {
+		return
+	}
+
+	// One screen without pixmap formats, whose root window comes first.
+	data := make([]byte, 32+40)
+	data[20] = 1
+	data[26], data[27] = fakeMinKeycode, fakeMaxKeycode
+	binary.LittleEndian.PutUint32(data[32:], fakeRoot)
+	head := []byte{1, 0, 11, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(head[6:], uint16(len(data)/4))
+	if _, err := f.conn.Write(append(head, data...)); err != nil {
+		return
+	}
+
+	for {
+		head := make([]byte, 4)
+		if _, err := io.ReadFull(f.conn, head); err != nil {
+			return
+		}
+
+		body := make([]byte, 4*int(binary.LittleEndian.Uint16(head[2:]))-4)
+		if _, err := io.ReadFull(f.conn, body); err != nil {
+			return
+		}
+
+		f.seq++
+
+		var reply []byte
+		switch head[0] {
+		case 16: // InternAtom
+			reply = f.reply(0, nil)
+			n := binary.LittleEndian.Uint16(body)
+			if string(body[4:4+n]) == "_XKB_RULES_NAMES" && f.xkbNames() != "" {
+				binary.LittleEndian.PutUint32(reply[8:], fakeXKBAtom)
+			}
+		case 20: // GetProperty
+			reply = f.reply(0, nil)
+			names := f.xkbNames()
+			if binary.LittleEndian.Uint32(body) == fakeRoot && binary.LittleEndian.Uint32(body[4:]) == fakeXKBAtom && names != "" {
+				reply = f.reply(8, []byte(names))
+				binary.LittleEndian.PutUint32(reply[8:], 31) // STRING
+				binary.LittleEndian.PutUint32(reply[16:], uint32(len(names)))
+			}
+		case 43: // GetInputFocus
+			reply = f.reply(0, nil)
+		case 44: // QueryKeymap
+			f.mu.Lock()
+			reply = f.reply(0, make([]byte, 8))
+			copy(reply[8:], f.down[:])
+			f.mu.Unlock()
+		case 98: // QueryExtension
+			reply = f.reply(0, nil)
+			n := binary.LittleEndian.Uint16(body)
+			switch string(body[4 : 4+n]) {
+			case "XTEST":
+				if f.xtest {
+					reply[8], reply[9] = 1, fakeXTEST
+				}
+			case "XKEYBOARD":
+				reply[8], reply[9] = 1, fakeXKB
+			}
+		case 100: // ChangeKeyboardMapping
+			f.mu.Lock()
+			if f.remaps == nil {
+				f.remaps = make(map[byte]uint32)
+			}
+			for i := range int(head[1]) {
+				f.remaps[body[0]+byte(i)] = binary.LittleEndian.Uint32(body[4+4*i*int(body[1]):])
+			}
+			f.mu.Unlock()
+
+			// The MappingNotify event is queued before the next reply, since
+			// the pipe to the client is unbuffered.
+			event := make([]byte, 32)
+			event[0] = 34
+			binary.LittleEndian.PutUint16(event[2:], f.seq)
+			event[4], event[5], event[6] = 1, body[0], head[1]
+			f.queued = append(f.queued, event...)
+		case 103: // GetKeyboardControl
+			f.mu.Lock()
+			reply = f.reply(0, make([]byte, 20))
+			binary.LittleEndian.PutUint32(reply[8:], f.leds)
+			f.mu.Unlock()
+		case 101: // GetKeyboardMapping
+			reply = f.reply(2, f.keyboardMapping(body[0], body[1]))
+		case 119: // GetModifierMapping
+			reply = f.reply(1, []byte{
+				keybd.KEY_LEFTSHIFT + 8, 0, keybd.KEY_LEFTCTRL + 8, keybd.KEY_LEFTALT + 8, 0, 0, 0, 0,
+			})
+		case fakeXKB:
+			switch head[1] {
+			case 0: // UseExtension
+				reply = f.reply(1, nil)
+			case 4: // GetState
+				f.mu.Lock()
+				reply = f.reply(0, nil)
+				reply[12] = f.group
+				f.mu.Unlock()
+			}
+		case fakeXTEST:
+			if head[1] == 2 { // FakeInput
+				f.mu.Lock()
+				kc, down := body[1], body[0] == 2
+				if down {
+					// The LEDs of Caps Lock, Num Lock, and Scroll Lock toggle
+					// when their keys are pressed.
+					for i, code := range []byte{keybd.KEY_CAPSLOCK, keybd.KEY_NUMLOCK, keybd.KEY_SCROLLLOCK} {
+						if kc == code+8 && f.down[kc/8]&(1<<(kc%8)) == 0 {
+							f.leds ^= 1 << i
+						}
+					}
+					f.down[kc/8] |= 1 << (kc % 8)
+				} else {
+					f.down[kc/8] &^= 1 << (kc % 8)
+				}
+				f.events = append(f.events, keyEvent{Code: uint16(kc) - 8, Down: down})
+				f.mu.Unlock()
+			}
+		default:
+			reply = make([]byte, 32)
+			reply[1] = 1 // BadRequest
+			binary.LittleEndian.PutUint16(reply[2:], f.seq)
+			reply[10] = head[0]
+		}
+
+		if reply != nil {
+			reply = append(f.queued, reply...)
+			f.queued = nil
+			if _, err := f.conn.Write(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// setXKBNames sets the _XKB_RULES_NAMES property of the root window to the
+// NUL-separated names.
+func (f *fakeX11) setXKBNames(names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.names = strings.Join(names, "\x00") + "\x00"
+}
+
+// setGroup switches the keyboard to the group at index group, the way the
+// layout switching shortcuts of a desktop do.
+func (f *fakeX11) setGroup(group byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.group = group
+}
+
+// xkbNames returns the _XKB_RULES_NAMES property, or "" if it is not set.
+func (f *fakeX11) xkbNames() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.names
+}
+
+// reply builds a reply packet with the data byte set to data and extra appended
+// after the 32 byte header.
+func (f *fakeX11) reply(data byte, extra []byte) []byte {
+	if n := len(extra) % 4; n != 0 {
+		extra = append(extra, make([]byte, 4-n)...)
+	}
+
+	reply := make([]byte, 32, 32+len(extra))
+	reply[0], reply[1] = 1, data
+	binary.LittleEndian.PutUint16(reply[2:], f.seq)
+	binary.LittleEndian.PutUint32(reply[4:], uint32(len(extra)/4))
+
+	return append(reply, extra...)
+}
+
+// keyboardMapping returns two keysyms per key code for count key codes
+// starting at first.
+func (f *fakeX11) keyboardMapping(first, count byte) []byte {
+	keysyms := make([]uint32, 2*int(count))
+	set := func(code uint16, level int, ks uint32) {
+		if i := int(code) + 8 - int(first); i >= 0 && i < int(count) {
+			keysyms[2*i+level] = ks
+		}
+	}
+
+	for _, r := range "`1234567890-=qwertyuiop[]\\asdfghjkl;'zxcvbnm,./~!@#$%^&*()_+QWERTYUIOP{}|ASDFGHJKL:\"ZXCVBNM<>? " {
+		code, shift, _ := keybd.RuneToKeyCode(r)
+		set(code, int(shift&keybd.MOD_SHIFT), uint32(r))
+	}
+	set(keybd.KEY_ENTER, 0, keybd.XK_Return)
+	set(keybd.KEY_TAB, 0, keybd.XK_Tab)
+	set(keybd.KEY_LEFTSHIFT, 0, 0xFFE1)
+	set(keybd.KEY_LEFTCTRL, 0, 0xFFE3)
+	set(keybd.KEY_LEFTALT, 0, 0xFFE9)
+
+	f.mu.Lock()
+	for kc, ks := range f.remaps {
+		set(uint16(kc)-8, 0, ks)
+		set(uint16(kc)-8, 1, ks)
+	}
+	f.mu.Unlock()
+
+	b := make([]byte, 0, 4*len(keysyms))
+	for _, ks := range keysyms {
+		b = binary.LittleEndian.AppendUint32(b, ks)
+	}
+
+	return b
+}
+
+func TestNewX11(t *testing.T) {
+	tName := "X11"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:   true,
+			Passing: true,
+		},
+		{
+			Input:   false,
+			Passing: false,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			_, conn := newFakeX11(t, s.Input.(bool))
+
+			_, err := keybd.NewX11(conn)
+			if s.Passing {
+				if err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+			} else {
+				if err == nil {
+					t.Errorf(test.ErrWantFGotF, "error", "none")
+				}
+			}
+		})
+	}
+}
+
+func TestX11RuneToKeystroke(t *testing.T) {
+	tName := "X11"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	_, conn := newFakeX11(t, true)
+	x, err := keybd.NewX11(conn)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:   testRunes["lower"],
+			Output:  keybd.Keystroke{Code: keybd.KEY_K},
+			Passing: true,
+		},
+		{
+			Input:   testRunes["upper"],
+			Output:  keybd.Keystroke{Code: keybd.KEY_K, Mods: keybd.ModShift},
+			Passing: true,
+		},
+		{
+			Input:   testRunes["emoji"],
+			Output:  keybd.Keystroke{},
+			Passing: false,
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			got, err := x.RuneToKeystroke(s.Input.(rune))
+			want := s.Output.(keybd.Keystroke)
+
+			if s.Passing {
+				if err != nil {
+					t.Fatalf(test.ErrUnexpectedF, err)
+				}
+				if got != want {
+					t.Errorf(test.ErrWantFGotF, want, got)
+				}
+			} else {
+				if err == nil {
+					t.Errorf(test.ErrWantFGotF, "error", "none")
+				}
+			}
+		})
+	}
+}
+
+func TestX11KeyIsDown(t *testing.T) {
+	tName := "X11"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	f, conn := newFakeX11(t, true)
+	x, err := keybd.NewX11(conn)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	ks, _ := x.RuneToKeystroke(testRunes["lower"])
+	code := ks.Code
+
+	if err := x.KeyPress(code); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if !x.KeyIsDown(code) {
+		t.Errorf(test.ErrWantFGotF, true, false)
+	}
+	if err := x.KeyRelease(code); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if x.KeyIsDown(code) {
+		t.Errorf(test.ErrWantFGotF, false, true)
+	}
+
+	want := []keyEvent{{keybd.KEY_K, true}, {keybd.KEY_K, false}}
+	if got := f.keyEvents(); !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestX11TypeStr(t *testing.T) {
+	tName := "X11"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{
+			Input:  testStrings["shortWord"] + "\r\n",
+			Output: testStrings["shortWord"] + "\n",
+		},
+		{
+			Input:  testStrings["shortSentence"] + "\r\n",
+			Output: testStrings["shortSentence"] + "\n",
+		},
+		{
+			Input:  testStrings["multiLineStringWithTabs"] + "\r\n",
+			Output: testStrings["multiLineStringWithTabs"] + "\n",
+		},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			f, conn := newFakeX11(t, true)
+			x, err := keybd.NewX11(conn)
+			if err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+
+			if err := x.TypeStr(s.Input.(string)); err != nil {
+				t.Fatalf(test.ErrWantFGotF, nil, err)
+			}
+			if got, want := decode(f.keyEvents()), s.Output.(string); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestX11TypeRune(t *testing.T) {
+	tName := "X11"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	f, conn := newFakeX11(t, true)
+	x, err := keybd.NewX11(conn)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	var strategies []keybd.Strategy
+	typer := keybd.NewTyper(
+		keybd.WithBackend(x),
+		keybd.WithStrategyReport(func(i int, p keybd.RunePlan) { strategies = append(strategies, p.Strategy) }),
+	)
+
+	if err := typer.Type(context.Background(), "a😀b😀"); err != nil {
+		t.Fatalf(test.ErrWantFGotF, nil, err)
+	}
+
+	spare := uint16(fakeMaxKeycode - 8)
+	want := []keyEvent{
+		{Code: keybd.KEY_A, Down: true}, {Code: keybd.KEY_A},
+		{Code: spare, Down: true}, {Code: spare},
+		{Code: keybd.KEY_B, Down: true}, {Code: keybd.KEY_B},
+		{Code: spare, Down: true}, {Code: spare},
+	}
+	if got := f.keyEvents(); !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	wantStrategies := []keybd.Strategy{keybd.StrategyLayout, keybd.StrategyUnicode, keybd.StrategyLayout, keybd.StrategyUnicode}
+	if !reflect.DeepEqual(strategies, wantStrategies) {
+		t.Errorf(test.ErrWantFGotF, wantStrategies, strategies)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got, want := f.remaps[fakeMaxKeycode], uint32(0x0101F600); got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestX11ComposeKeystrokes(t *testing.T) {
+	tName := "X11"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	path := filepath.Join(t.TempDir(), "Compose")
+	if err := os.WriteFile(path, []byte(`<Multi_key> <o> <c> : "©" copyright`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XCOMPOSEFILE", path)
+
+	f, conn := newFakeX11(t, true)
+	f.remaps = map[byte]uint32{
+		keybd.KEY_102ND + 8:   0xFE51, // dead_acute
+		keybd.KEY_COMPOSE + 8: keybd.XK_Multi_key,
+	}
+
+	x, err := keybd.NewX11(conn)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	l := x.Layout()
+	if got, want := l.DeadKeys[keybd.Keystroke{Code: keybd.KEY_102ND}], '´'; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := l.ComposeKey, (keybd.Keystroke{Code: keybd.KEY_COMPOSE}); got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	if err := x.TypeStr("é©"); err != nil {
+		t.Fatalf(test.ErrWantFGotF, nil, err)
+	}
+
+	want := []keyEvent{
+		{Code: keybd.KEY_102ND, Down: true}, {Code: keybd.KEY_102ND},
+		{Code: keybd.KEY_E, Down: true}, {Code: keybd.KEY_E},
+		{Code: keybd.KEY_COMPOSE, Down: true}, {Code: keybd.KEY_COMPOSE},
+		{Code: keybd.KEY_O, Down: true}, {Code: keybd.KEY_O},
+		{Code: keybd.KEY_C, Down: true}, {Code: keybd.KEY_C},
+	}
+	if got := f.keyEvents(); !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestX11LockState(t *testing.T) {
+	tName := "X11"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	f, conn := newFakeX11(t, true)
+	x, err := keybd.NewX11(conn)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if got, err := x.LockState(); err != nil || got != 0 {
+		t.Errorf(test.ErrWantFGotF, keybd.Locks(0), got)
+	}
+
+	if err := keybd.SetLockStateOn(x, keybd.LockCaps|keybd.LockScroll, true); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if got, err := x.LockState(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	} else if want := keybd.LockCaps | keybd.LockScroll; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	if err := x.TypeStr("Hi"); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	want := []keyEvent{
+		{Code: keybd.KEY_CAPSLOCK, Down: true},
+		{Code: keybd.KEY_CAPSLOCK, Down: false},
+		{Code: keybd.KEY_SCROLLLOCK, Down: true},
+		{Code: keybd.KEY_SCROLLLOCK, Down: false},
+		{Code: keybd.KEY_H, Down: true},
+		{Code: keybd.KEY_H, Down: false},
+		{Code: keybd.KEY_LEFTSHIFT, Down: true},
+		{Code: keybd.KEY_I, Down: true},
+		{Code: keybd.KEY_I, Down: false},
+		{Code: keybd.KEY_LEFTSHIFT, Down: false},
+	}
+	if got := f.keyEvents(); !reflect.DeepEqual(got, want) {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
@@ -0,0 +1,795 @@
+package keybd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// xkbDeadKeysyms maps the names of the XKB dead keysyms to the spacing accents
+// that their dead keys type when followed by a space.
+var xkbDeadKeysyms = map[string]rune{
+	"dead_grave":       '`',
+	"dead_acute":       '´',
+	"dead_circumflex":  '^',
+	"dead_tilde":       '~',
+	"dead_macron":      '¯',
+	"dead_breve":       '˘',
+	"dead_abovedot":    '˙',
+	"dead_diaeresis":   '¨',
+	"dead_abovering":   '˚',
+	"dead_doubleacute": '˝',
+	"dead_caron":       'ˇ',
+	"dead_cedilla":     '¸',
+	"dead_ogonek":      '˛',
+}
+
+// xkbModNames maps the names of the real and virtual XKB modifiers to the
+// modifiers they stand for. Modifiers missing from the map, such as Lock or
+// NumLock, are never pressed to select a level.
+var xkbModNames = map[string]Mods{
+	"none":       0,
+	"shift":      ModShift,
+	"control":    ModCtrl,
+	"mod1":       ModAlt,
+	"alt":        ModAlt,
+	"meta":       ModAlt,
+	"mod4":       ModMeta,
+	"super":      ModMeta,
+	"mod5":       ModAltGr,
+	"levelthree": ModAltGr,
+	"altgr":      ModAltGr,
+}
+
+// xkbIncludes holds the keywords that start an include statement when they are
+// followed by a string.
+var xkbIncludes = map[string]bool{"include": true, "augment": true, "override": true, "replace": true}
+
+// An xkbMerge is the mode an XKB statement merges its definitions with. The
+// default mode overrides, unless the statement is included with another mode.
+type xkbMerge int
+
+const (
+	xkbDefault xkbMerge = iota
+	xkbOverride
+	xkbAugment
+	xkbReplace
+)
+
+// An xkbToken is a token of an XKB file: an identifier or number, a quoted
+// string, a key name in angle brackets, or a punctuation character.
+type xkbToken struct {
+	kind byte // 'i', 's', 'k', or the punctuation character
+	text string
+	line int
+}
+
+// An xkbStmt is a statement of an XKB file: its tokens up to the semicolon and
+// the statements of the block in braces it contains, if any.
+type xkbStmt struct {
+	toks []xkbToken
+	body []xkbStmt
+}
+
+// An xkbKey is the first group of the symbols of a key.
+type xkbKey struct {
+	typ   string
+	syms  []string // keysym names per level, empty for NoSymbol
+	merge xkbMerge // mode of the statement that defined the key
+}
+
+// An xkbKeymap accumulates the keycodes, types, and symbols of an XKB keymap.
+type xkbKeymap struct {
+	name     string                  // name of the first group
+	keycodes map[string]uint32       // XKB keycodes by key name
+	aliases  map[string]string       // key names by alias
+	types    map[string]map[int]Mods // modifiers per level by type name
+	keys     map[string]*xkbKey      // symbols by key name
+
+	// include compiles a map of a file of the component kind. A nil include
+	// ignores include statements.
+	include func(kind, file, name string) (*xkbKeymap, error)
+}
+
+// ParseXKBKeymap reads a complete XKB keymap in the text format that xkbcomp
+// prints and Wayland compositors send to their clients, such as
+//
+//	xkb_keymap {
+//		xkb_keycodes "evdev" { <AE01> = 10; ... };
+//		xkb_types "complete" { ... };
+//		xkb_symbols "pc+de+inet(evdev)" { key <AE01> { [ 1, exclam ] }; ... };
+//	};
+//
+// and translates the first group of its symbols to a [Layout]. Keysyms that
+// type no rune, or whose names are unknown and not written as Unicode keysyms
+// such as U20AC, are skipped. Include statements are ignored.
+// It returns nil with an error wrapping [ErrInvalidKeymap] if the keymap is
+// malformed.
+func ParseXKBKeymap(r io.Reader) (*Layout, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	stmts, err := parseXKB(string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	m := newXKBKeymap(nil)
+	for _, stmt := range stmts {
+		if kind, _, _ := xkbSection(stmt); kind == "keymap" {
+			stmts = stmt.body
+			break
+		}
+	}
+	for _, stmt := range stmts {
+		kind, name, _ := xkbSection(stmt)
+		if err := m.apply(kind, stmt.body); err != nil {
+			return nil, err
+		}
+		if kind == "symbols" && m.name == "" {
+			m.name = name
+		}
+	}
+
+	return m.layout(), nil
+}
+
+// newXKBKeymap returns an empty keymap that resolves includes with include.
+func newXKBKeymap(include func(kind, file, name string) (*xkbKeymap, error)) *xkbKeymap {
+	return &xkbKeymap{
+		keycodes: make(map[string]uint32),
+		aliases:  make(map[string]string),
+		types:    make(map[string]map[int]Mods),
+		keys:     make(map[string]*xkbKey),
+		include:  include,
+	}
+}
+
+// apply adds the statements of a section of the component kind to m. Only
+// keycodes, types, and symbols are kept.
+func (m *xkbKeymap) apply(kind string, stmts []xkbStmt) error {
+	if kind != "keycodes" && kind != "types" && kind != "symbols" {
+		return nil
+	}
+
+	var defaultType string
+
+	for _, stmt := range stmts {
+		toks := stmt.toks
+		if len(toks) == 0 {
+			continue
+		}
+
+		merge := xkbDefault
+		switch toks[0].text {
+		case "augment":
+			merge = xkbAugment
+			toks = toks[1:]
+		case "override":
+			merge = xkbOverride
+			toks = toks[1:]
+		case "replace":
+			merge = xkbReplace
+			toks = toks[1:]
+		case "include":
+			toks = toks[1:]
+		}
+		if len(toks) == 0 {
+			continue
+		}
+
+		if toks[0].kind == 's' {
+			if err := m.includeSpec(kind, toks[0].text, merge); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch kind {
+		case "keycodes":
+			switch {
+			case len(toks) >= 3 && toks[0].kind == 'k' && toks[1].kind == '=':
+				code, err := strconv.ParseUint(toks[2].text, 0, 32)
+				if err != nil {
+					return fmt.Errorf("%w: line %d: invalid keycode %q", ErrInvalidKeymap, toks[2].line, toks[2].text)
+				}
+				if _, ok := m.keycodes[toks[0].text]; !ok || merge != xkbAugment {
+					m.keycodes[toks[0].text] = uint32(code)
+				}
+			case len(toks) >= 4 && toks[0].text == "alias" && toks[1].kind == 'k' && toks[3].kind == 'k':
+				if _, ok := m.aliases[toks[1].text]; !ok || merge != xkbAugment {
+					m.aliases[toks[1].text] = toks[3].text
+				}
+			}
+		case "types":
+			if len(toks) >= 2 && toks[0].text == "type" && toks[1].kind == 's' {
+				if _, ok := m.types[toks[1].text]; !ok || merge != xkbAugment {
+					m.types[toks[1].text] = xkbTypeLevels(stmt.body)
+				}
+			}
+		case "symbols":
+			switch {
+			case toks[0].text == "name":
+				if group, value, ok := xkbGroupValue(toks[1:]); ok && group == 1 && value.kind == 's' {
+					if m.name == "" || merge != xkbAugment {
+						m.name = value.text
+					}
+				}
+			case toks[0].text == "key" && len(toks) >= 3 && toks[1].kind == '.' && toks[2].text == "type":
+				if _, value, ok := xkbGroupValue(toks[3:]); ok && value.kind == 's' {
+					defaultType = value.text
+				}
+			case toks[0].text == "key" && len(toks) >= 2 && toks[1].kind == 'k':
+				key := xkbParseKey(stmt.body)
+				if key.typ == "" {
+					key.typ = defaultType
+				}
+				key.merge = merge
+				m.mergeKey(toks[1].text, key, merge)
+			}
+		}
+	}
+
+	return nil
+}
+
+// includeSpec merges the maps named by an include specification such as
+// "pc+de(nodeadkeys)|inet(evdev)" into m. Maps joined with '+' override the
+// maps before them, maps joined with '|' augment them, and maps of other
+// groups than the first, such as "us:2", are skipped.
+func (m *xkbKeymap) includeSpec(kind, spec string, merge xkbMerge) error {
+	if m.include == nil {
+		return nil
+	}
+
+	sub := newXKBKeymap(m.include)
+	for len(spec) > 0 {
+		i := strings.IndexAny(spec[1:], "+|") + 1
+		if i == 0 {
+			i = len(spec)
+		}
+		part := spec[:i]
+		spec = spec[i:]
+
+		mode := xkbDefault
+		switch part[0] {
+		case '+':
+			mode, part = xkbOverride, part[1:]
+		case '|':
+			mode, part = xkbAugment, part[1:]
+		}
+
+		part, group, _ := strings.Cut(part, ":")
+		if group != "" && group != "1" && kind == "symbols" {
+			continue
+		}
+
+		file, name, _ := strings.Cut(strings.TrimSuffix(part, ")"), "(")
+		if file == "" {
+			continue
+		}
+
+		included, err := m.include(kind, file, name)
+		if err != nil {
+			return err
+		}
+		sub.merge(included, mode)
+	}
+
+	m.merge(sub, merge)
+
+	return nil
+}
+
+// merge merges the definitions of from into m. Keys defined with an explicit
+// mode keep it.
+func (m *xkbKeymap) merge(from *xkbKeymap, merge xkbMerge) {
+	if from.name != "" && (m.name == "" || merge != xkbAugment) {
+		m.name = from.name
+	}
+	for name, code := range from.keycodes {
+		if _, ok := m.keycodes[name]; !ok || merge != xkbAugment {
+			m.keycodes[name] = code
+		}
+	}
+	for alias, name := range from.aliases {
+		if _, ok := m.aliases[alias]; !ok || merge != xkbAugment {
+			m.aliases[alias] = name
+		}
+	}
+	for name, levels := range from.types {
+		if _, ok := m.types[name]; !ok || merge != xkbAugment {
+			m.types[name] = levels
+		}
+	}
+	for name, key := range from.keys {
+		mode := merge
+		if key.merge != xkbDefault {
+			mode = key.merge
+		}
+		m.mergeKey(name, &xkbKey{typ: key.typ, syms: key.syms, merge: key.merge}, mode)
+	}
+}
+
+// mergeKey merges the symbols of key into the key named name level by level.
+func (m *xkbKeymap) mergeKey(name string, key *xkbKey, merge xkbMerge) {
+	old, ok := m.keys[name]
+	if !ok || merge == xkbReplace {
+		m.keys[name] = key
+		return
+	}
+
+	syms := append([]string(nil), old.syms...)
+	for i, sym := range key.syms {
+		if i == len(syms) {
+			syms = append(syms, "")
+		}
+		if sym != "" && (syms[i] == "" || merge != xkbAugment) {
+			syms[i] = sym
+		}
+	}
+
+	typ := old.typ
+	if key.typ != "" && (typ == "" || merge != xkbAugment) {
+		typ = key.typ
+	}
+
+	if key.merge == xkbDefault {
+		key.merge = old.merge
+	}
+
+	m.keys[name] = &xkbKey{typ: typ, syms: syms, merge: key.merge}
+}
+
+// layout translates the keys of m to a [Layout].
+func (m *xkbKeymap) layout() *Layout {
+	l := &Layout{
+		Name:     m.name,
+		Keys:     make(map[Keystroke]rune),
+		DeadKeys: make(map[Keystroke]rune),
+	}
+
+	for name, key := range m.keys {
+		code, ok := m.keycodes[name]
+		if !ok {
+			code, ok = m.keycodes[m.aliases[name]]
+		}
+		if !ok || code < 8 {
+			continue
+		}
+
+		levels, ok := m.types[key.typ]
+		if !ok {
+			levels = xkbDefaultLevels
+		}
+
+		for i, sym := range key.syms {
+			mods, ok := levels[i+1]
+			if !ok || sym == "" {
+				continue
+			}
+
+			ks := Keystroke{Code: KeyCode(code - 8), Mods: mods}
+			if accent, ok := xkbDeadKeysyms[sym]; ok {
+				l.DeadKeys[ks] = accent
+			} else if sym == "Multi_key" {
+				if l.ComposeKey == (Keystroke{}) || betterKeystroke(ks, l.ComposeKey) {
+					l.ComposeKey = ks
+				}
+			} else if r, ok := xkbKeysymRune(sym); ok {
+				l.Keys[ks] = r
+			}
+		}
+	}
+
+	return l
+}
+
+// xkbDefaultLevels are the modifiers of the levels of keys without a known
+// type, those of the types that xkbcomp picks for keys of up to four levels.
+var xkbDefaultLevels = map[int]Mods{1: 0, 2: ModShift, 3: ModAltGr, 4: ModAltGr | ModShift}
+
+// xkbTypeLevels returns the modifiers of the levels of a type from the
+// statements of its definition, preferring the fewest modifiers per level.
+func xkbTypeLevels(stmts []xkbStmt) map[int]Mods {
+	levels := map[int]Mods{1: 0}
+
+	for _, stmt := range stmts {
+		toks := stmt.toks
+		if len(toks) < 5 || toks[0].text != "map" || toks[1].kind != '[' {
+			continue
+		}
+
+		end := xkbIndex(toks, ']')
+		if end < 0 || end+2 >= len(toks) || toks[end+1].kind != '=' {
+			continue
+		}
+
+		level, ok := xkbLevel(toks[end+2].text)
+		if !ok {
+			continue
+		}
+
+		var (
+			mods      Mods
+			supported = true
+		)
+		for _, tok := range toks[2:end] {
+			if tok.kind != 'i' {
+				continue
+			}
+			mod, ok := xkbModNames[strings.ToLower(tok.text)]
+			if !ok {
+				supported = false
+				break
+			}
+			mods |= mod
+		}
+		if !supported {
+			continue
+		}
+
+		if best, ok := levels[level]; !ok || betterKeystroke(Keystroke{Mods: mods}, Keystroke{Mods: best}) {
+			levels[level] = mods
+		}
+	}
+
+	return levels
+}
+
+// xkbParseKey parses the first group of the body of a key statement, such as
+// { type= "TWO_LEVEL", symbols[Group1]= [ a, A ], [ b, B ] }.
+func xkbParseKey(stmts []xkbStmt) *xkbKey {
+	var toks []xkbToken
+	for _, stmt := range stmts {
+		toks = append(toks, stmt.toks...)
+	}
+
+	key := &xkbKey{}
+	group := 0
+	for _, elem := range xkbSplit(toks, ',') {
+		if len(elem) == 0 {
+			continue
+		}
+
+		switch {
+		case elem[0].kind == '[':
+			group++
+			if group == 1 {
+				key.syms = xkbSymbols(elem)
+			}
+		case elem[0].text == "symbols":
+			if g, _, ok := xkbGroupValue(elem[1:]); ok && g == 1 {
+				key.syms = xkbSymbols(elem[xkbIndex(elem, '=')+1:])
+			}
+		case elem[0].text == "type":
+			if g, value, ok := xkbGroupValue(elem[1:]); ok && g <= 1 && value.kind == 's' {
+				key.typ = value.text
+			}
+		}
+	}
+
+	return key
+}
+
+// xkbSymbols returns the keysym names of a bracketed list of levels.
+func xkbSymbols(toks []xkbToken) []string {
+	if len(toks) < 2 || toks[0].kind != '[' {
+		return nil
+	}
+
+	end := xkbIndex(toks, ']')
+	if end < 0 {
+		end = len(toks)
+	}
+
+	var syms []string
+	for _, level := range xkbSplit(toks[1:end], ',') {
+		sym := ""
+		if len(level) == 1 && level[0].kind == 'i' && level[0].text != "NoSymbol" && level[0].text != "VoidSymbol" {
+			sym = level[0].text
+		}
+		syms = append(syms, sym)
+	}
+
+	return syms
+}
+
+// xkbGroupValue parses the optional group index and the value of an
+// assignment such as [Group1]= "German" or = "FOUR_LEVEL". A missing group
+// index is returned as 0.
+func xkbGroupValue(toks []xkbToken) (group int, value xkbToken, ok bool) {
+	if len(toks) > 0 && toks[0].kind == '[' {
+		end := xkbIndex(toks, ']')
+		if end != 2 {
+			return 0, xkbToken{}, false
+		}
+		if group, ok = xkbLevel(strings.TrimPrefix(toks[1].text, "Group")); !ok {
+			return 0, xkbToken{}, false
+		}
+		toks = toks[end+1:]
+	}
+
+	if len(toks) < 2 || toks[0].kind != '=' {
+		return 0, xkbToken{}, false
+	}
+
+	return group, toks[1], true
+}
+
+// xkbLevel parses a level or group such as Level3 or 3.
+func xkbLevel(s string) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimPrefix(s, "Level"))
+	if err != nil || n < 1 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// xkbKeysymRune translates an XKB keysym name to the rune it types, like
+// [keysymRune] but also accepting numeric keysyms and the names of the
+// whitespace keys. Keypad keysyms are skipped since they depend on NumLock.
+func xkbKeysymRune(name string) (rune, bool) {
+	switch {
+	case name == "Return":
+		return '\n', true
+	case name == "Tab":
+		return '\t', true
+	case strings.HasPrefix(name, "KP_"):
+		return 0, false
+	case strings.HasPrefix(name, "0x"):
+		ks, err := strconv.ParseUint(name[2:], 16, 32)
+		switch {
+		case err != nil:
+			return 0, false
+		case ks >= 0x20 && ks <= 0x7E, ks >= 0xA0 && ks <= 0xFF:
+			return rune(ks), true
+		case ks >= 0x01000100 && ks <= 0x0110FFFF:
+			return rune(ks - 0x01000000), true
+		}
+		return 0, false
+	}
+
+	return keysymRune(name)
+}
+
+// xkbSection returns the component kind of a section statement, such as
+// "symbols" for xkb_symbols, along with its name and whether it is the
+// default map of its file. It returns an empty kind for other statements.
+func xkbSection(stmt xkbStmt) (kind, name string, isDefault bool) {
+	for i, tok := range stmt.toks {
+		switch tok.text {
+		case "default":
+			isDefault = true
+			continue
+		case "xkb_keymap", "xkb_semantics", "xkb_layout":
+			kind = "keymap"
+		case "xkb_keycodes":
+			kind = "keycodes"
+		case "xkb_types":
+			kind = "types"
+		case "xkb_compatibility", "xkb_compatibility_map", "xkb_compat", "xkb_compat_map":
+			kind = "compat"
+		case "xkb_symbols":
+			kind = "symbols"
+		case "xkb_geometry":
+			kind = "geometry"
+		default:
+			continue
+		}
+
+		if i+1 < len(stmt.toks) && stmt.toks[i+1].kind == 's' {
+			name = stmt.toks[i+1].text
+		}
+		return kind, name, isDefault
+	}
+
+	return "", "", false
+}
+
+// xkbIndex returns the index of the first token of toks of kind, or -1.
+func xkbIndex(toks []xkbToken, kind byte) int {
+	for i, tok := range toks {
+		if tok.kind == kind {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// xkbSplit splits toks at the separators sep that are not nested in brackets
+// or parentheses.
+func xkbSplit(toks []xkbToken, sep byte) [][]xkbToken {
+	var (
+		parts [][]xkbToken
+		depth int
+		start int
+	)
+	for i, tok := range toks {
+		switch tok.kind {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, toks[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, toks[start:])
+}
+
+// parseXKB parses the statements of an XKB file.
+func parseXKB(src string) ([]xkbStmt, error) {
+	toks, err := tokenizeXKB(src)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := 0
+	stmts, err := parseXKBBlock(toks, &pos, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmts, nil
+}
+
+// parseXKBBlock parses statements from toks at pos until the closing brace of
+// a nested block or the end of toks.
+func parseXKBBlock(toks []xkbToken, pos *int, nested bool) ([]xkbStmt, error) {
+	var (
+		stmts []xkbStmt
+		stmt  xkbStmt
+	)
+	flush := func() {
+		if len(stmt.toks) > 0 || stmt.body != nil {
+			stmts = append(stmts, stmt)
+		}
+		stmt = xkbStmt{}
+	}
+
+	for *pos < len(toks) {
+		tok := toks[*pos]
+		*pos++
+
+		switch tok.kind {
+		case ';':
+			flush()
+		case '{':
+			body, err := parseXKBBlock(toks, pos, true)
+			if err != nil {
+				return nil, err
+			}
+			stmt.body = append(stmt.body, body...)
+			if stmt.body == nil {
+				stmt.body = []xkbStmt{}
+			}
+		case '}':
+			if !nested {
+				return nil, fmt.Errorf("%w: line %d: unexpected '}'", ErrInvalidKeymap, tok.line)
+			}
+			flush()
+			return stmts, nil
+		default:
+			// Include statements need no semicolon, so one starts a new
+			// statement and ends after the string naming the maps.
+			if xkbIncludes[tok.text] && *pos < len(toks) && toks[*pos].kind == 's' {
+				flush()
+				stmt.toks = append(stmt.toks, tok, toks[*pos])
+				*pos++
+				flush()
+				continue
+			}
+			stmt.toks = append(stmt.toks, tok)
+		}
+	}
+
+	if nested {
+		return nil, fmt.Errorf("%w: missing '}'", ErrInvalidKeymap)
+	}
+	flush()
+
+	return stmts, nil
+}
+
+// tokenizeXKB splits src into tokens, skipping whitespace and the comments
+// that start with // or #.
+func tokenizeXKB(src string) ([]xkbToken, error) {
+	var toks []xkbToken
+
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#' || c == '/' && strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '"':
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, fmt.Errorf("%w: line %d: unterminated string", ErrInvalidKeymap, line)
+			}
+			toks = append(toks, xkbToken{kind: 's', text: xkbUnescape(src[i+1 : j]), line: line})
+			i = j + 1
+		case c == '<':
+			j := strings.IndexAny(src[i:], ">\n")
+			if j < 0 || src[i+j] != '>' {
+				return nil, fmt.Errorf("%w: line %d: unterminated key name", ErrInvalidKeymap, line)
+			}
+			toks = append(toks, xkbToken{kind: 'k', text: src[i+1 : i+j], line: line})
+			i += j + 1
+		case c == '_' || c >= '0' && c <= '9' || c|0x20 >= 'a' && c|0x20 <= 'z':
+			j := i + 1
+			for j < len(src) && (src[j] == '_' || src[j] >= '0' && src[j] <= '9' || src[j]|0x20 >= 'a' && src[j]|0x20 <= 'z') {
+				j++
+			}
+			toks = append(toks, xkbToken{kind: 'i', text: src[i:j], line: line})
+			i = j
+		case strings.IndexByte("{}[]();,=+-!.~", c) >= 0:
+			toks = append(toks, xkbToken{kind: c, text: string(c), line: line})
+			i++
+		default:
+			return nil, fmt.Errorf("%w: line %d: unexpected %q", ErrInvalidKeymap, line, c)
+		}
+	}
+
+	return toks, nil
+}
+
+// xkbUnescape replaces the backslash escapes of an XKB string.
+func xkbUnescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'e':
+			b.WriteByte(0x1B)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			n := 0
+			for j := 0; j < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; j++ {
+				n = n*8 + int(s[i]-'0')
+				i++
+			}
+			i--
+			b.WriteByte(byte(n))
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,499 @@
+//go:build linux
+
+package keybd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// defaultXKBConfigRoot is the directory of the XKB data files when
+// XKB_CONFIG_ROOT is not set.
+const defaultXKBConfigRoot = "/usr/share/X11/xkb"
+
+// An RMLVO is a struct that names an XKB keymap by the rules, model, layout,
+// variant, and options that setxkbmap and Wayland compositors are configured
+// with. The layout and variant may list one layout per group separated by
+// commas, such as "us,de", of which [LoadXKBKeymap] compiles the first, see
+// [RMLVO.Group].
+type RMLVO struct {
+	Rules   string // rules file, such as "evdev"
+	Model   string // keyboard model, such as "pc105"
+	Layout  string // layout, such as "de"
+	Variant string // variant of the layout, such as "nodeadkeys"
+	Options string // comma-separated options, such as "compose:ralt"
+}
+
+// Group returns n with the layout and variant of the group at index group
+// alone, such as "de" for the group 1 of "us,de". Indexes past the last layout
+// wrap around the way XKB does.
+func (n RMLVO) Group(group int) RMLVO {
+	layouts := strings.Split(n.Layout, ",")
+	variants := strings.Split(n.Variant, ",")
+
+	i := max(group, 0) % len(layouts)
+	n.Layout, n.Variant = layouts[i], ""
+	if i < len(variants) {
+		n.Variant = variants[i]
+	}
+
+	return n
+}
+
+// A KeyboardLayoutInfo is a struct that contains the XKB names of the keyboard
+// layout of the current machine and the layout they compile to.
+type KeyboardLayoutInfo struct {
+	Names  RMLVO
+	Layout *Layout
+}
+
+// GetKeyboardLayoutInfo retrieves the layout of the local machine from the
+// XKB_DEFAULT_RULES, XKB_DEFAULT_MODEL, XKB_DEFAULT_LAYOUT,
+// XKB_DEFAULT_VARIANT, and XKB_DEFAULT_OPTIONS environment variables and
+// /etc/default/keyboard, compiled with [LoadXKBKeymap]. It falls back to the
+// "us" layout of [LayoutByName] if the layout cannot be compiled.
+// It always returns a [KeyboardLayoutInfo].
+func GetKeyboardLayoutInfo() KeyboardLayoutInfo {
+	names := systemRMLVO()
+
+	return KeyboardLayoutInfo{Names: names, Layout: xkbLayout(names)}
+}
+
+// An XKBLayoutSource is a [LayoutSource] that reports the XKB layout of the
+// desktop, compiled with [LoadXKBKeymap] whenever its names or the active
+// group change. If X11 is set, the names are read from the _XKB_RULES_NAMES
+// property that X servers and setxkbmap set on the root window, and the group
+// that the user switched to from the XKEYBOARD extension. Otherwise they are
+// read like [GetKeyboardLayoutInfo] does and the first group is active.
+// The uinput backend types with the layout it reports last unless
+// [Uinput].Layout is set.
+type XKBLayoutSource struct {
+	X11 *X11 // X server to read the names and the group from, or nil
+}
+
+// ActiveLayout returns the layout compiled from the active XKB names and
+// group, or the "us" layout of [LayoutByName] if they cannot be compiled.
+// It returns nil with an error if the names or the group cannot be read from
+// X11.
+func (s XKBLayoutSource) ActiveLayout() (*Layout, error) {
+	names := systemRMLVO()
+	if s.X11 != nil {
+		var err error
+		if names, err = s.X11.XKBNames(); err != nil {
+			return nil, err
+		}
+
+		group, err := s.X11.XKBGroup()
+		if err != nil {
+			return nil, err
+		}
+		names = names.Group(group)
+	}
+
+	return xkbLayout(names), nil
+}
+
+// displayX11 is the connection to the X server of DISPLAY that the source of
+// [SystemLayoutSource] reads the XKB layout from.
+var displayX11 struct {
+	display string
+	x       *X11
+	mu      sync.Mutex
+}
+
+// SystemLayoutSource returns the [LayoutSource] of the active XKB layout. While
+// DISPLAY names an X server that can be connected to, it reports the layout
+// the way an [XKBLayoutSource] with that X server does, following the layout
+// switches of the user, and it reports the configured layout otherwise. The
+// connection is opened on first use and kept open, and it is opened again
+// after a failed read or when DISPLAY changes.
+func SystemLayoutSource() LayoutSource {
+	return LayoutSourceFunc(func() (*Layout, error) {
+		x := systemX11()
+		if x == nil {
+			return XKBLayoutSource{}.ActiveLayout()
+		}
+
+		l, err := XKBLayoutSource{X11: x}.ActiveLayout()
+		if err != nil {
+			displayX11.mu.Lock()
+			if displayX11.x == x {
+				displayX11.x = nil
+				_ = x.Close()
+			}
+			displayX11.mu.Unlock()
+		}
+
+		return l, err
+	})
+}
+
+// systemX11 returns the connection to the X server of DISPLAY, connecting to it
+// unless it is open, or nil if DISPLAY is not set or the server cannot be
+// connected to.
+func systemX11() *X11 {
+	displayX11.mu.Lock()
+	defer displayX11.mu.Unlock()
+
+	display := os.Getenv("DISPLAY")
+	if displayX11.x != nil && displayX11.display != display {
+		_ = displayX11.x.Close()
+		displayX11.x = nil
+	}
+	if displayX11.x == nil && display != "" {
+		displayX11.x, _ = OpenX11(display)
+		displayX11.display = display
+	}
+
+	return displayX11.x
+}
+
+// xkbNames is a struct that identifies the layout compiled from names with
+// the XKB data files below root.
+type xkbNames struct {
+	root  string
+	names RMLVO
+}
+
+// xkbLayouts caches the layout compiled for the active XKB names.
+var xkbLayouts = keymapCache[xkbNames]{build: compileXKBLayout}
+
+// xkbLayout returns the layout compiled for names, compiling it unless it is
+// cached.
+func xkbLayout(names RMLVO) *Layout {
+	return xkbLayouts.get(xkbNames{root: xkbConfigRoot(), names: names})
+}
+
+// compileXKBLayout compiles the layout identified by k, falling back to the
+// "us" layout of [LayoutByName].
+func compileXKBLayout(k xkbNames) *Layout {
+	l, err := loadXKBKeymap(k.root, k.names)
+	if err != nil {
+		l, _ = LayoutByName("us")
+	}
+
+	return l
+}
+
+// LoadXKBKeymap compiles the keymap named by names from the XKB data files in
+// XKB_CONFIG_ROOT or /usr/share/X11/xkb, the way xkbcomp does: the rules
+// translate names to keycodes, types, and symbols, whose files are read with
+// their includes and translated to a [Layout] like [ParseXKBKeymap] does.
+// Empty rules, model, and layout default to "evdev", "pc105", and "us".
+// It returns nil with an error if the call fails.
+func LoadXKBKeymap(names RMLVO) (*Layout, error) { return loadXKBKeymap(xkbConfigRoot(), names) }
+
+// loadXKBKeymap is the base function for LoadXKBKeymap that reads the XKB data
+// files below root.
+func loadXKBKeymap(root string, names RMLVO) (*Layout, error) {
+	if names.Rules == "" {
+		names.Rules = "evdev"
+	}
+	if names.Model == "" {
+		names.Model = "pc105"
+	}
+	if names.Layout == "" {
+		names.Layout = "us"
+	}
+	names.Layout, _, _ = strings.Cut(names.Layout, ",")
+	names.Variant, _, _ = strings.Cut(names.Variant, ",")
+
+	components, err := xkbRules(filepath.Join(root, "rules", names.Rules), names)
+	if err != nil {
+		return nil, err
+	}
+
+	loader := &xkbLoader{root: root, files: make(map[string][]xkbStmt)}
+	m := newXKBKeymap(loader.include)
+	for _, kind := range []string{"keycodes", "types", "symbols"} {
+		if err := m.includeSpec(kind, components[kind], xkbDefault); err != nil {
+			return nil, err
+		}
+	}
+
+	l := m.layout()
+	l.Name = names.Layout
+	if names.Variant != "" {
+		l.Name += "(" + names.Variant + ")"
+	}
+
+	return l, nil
+}
+
+// An xkbLoader compiles the maps of the XKB data files below root, caching
+// the files it parses.
+type xkbLoader struct {
+	root  string
+	files map[string][]xkbStmt
+	depth int
+}
+
+// include compiles the map called name of the file of the component kind, or
+// its default map if name is empty.
+func (x *xkbLoader) include(kind, file, name string) (*xkbKeymap, error) {
+	if x.depth > 16 {
+		return nil, fmt.Errorf("%w: %s/%s: includes nested too deeply", ErrInvalidKeymap, kind, file)
+	}
+
+	path := filepath.Join(x.root, kind, filepath.Clean("/"+file))
+	stmts, ok := x.files[path]
+	if !ok {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if stmts, err = parseXKB(string(src)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		x.files[path] = stmts
+	}
+
+	var body []xkbStmt
+	found := false
+	for _, stmt := range stmts {
+		k, n, isDefault := xkbSection(stmt)
+		if k != kind {
+			continue
+		}
+		if name != "" && n == name || name == "" && (isDefault || !found) {
+			body, found = stmt.body, true
+			if name != "" || isDefault {
+				break
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s/%s: no map %q", ErrInvalidKeymap, kind, file, name)
+	}
+
+	x.depth++
+	defer func() { x.depth-- }()
+
+	m := newXKBKeymap(x.include)
+	if err := m.apply(kind, body); err != nil {
+		return nil, fmt.Errorf("%s(%s): %w", file, name, err)
+	}
+
+	return m, nil
+}
+
+// xkbRules translates names to the include specifications of the keycodes,
+// types, and symbols of a keymap with the rules file at path. Sections for
+// other layouts than the first are skipped.
+func xkbRules(path string, names RMLVO) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		groups     = make(map[string][]string)
+		components = make(map[string]string)
+		fields     []string
+		targets    []string
+		skip       bool
+		matched    bool
+		options    = strings.Split(names.Options, ",")
+	)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for strings.HasSuffix(line, "\\") && scanner.Scan() {
+			line = strings.TrimSuffix(line, "\\") + " " + scanner.Text()
+		}
+		line, _, _ = strings.Cut(line, "//")
+
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		if words[0] == "!" {
+			words = words[1:]
+			eq := slices.Index(words, "=")
+			switch {
+			case eq == 1 && strings.HasPrefix(words[0], "$"):
+				groups[words[0]] = words[2:]
+			case eq > 0:
+				fields, targets, matched = words[:eq], words[eq+1:], false
+				skip = slices.ContainsFunc(fields, func(f string) bool { return strings.Contains(f, "[") })
+			}
+			continue
+		}
+
+		eq := slices.Index(words, "=")
+		if skip || matched || eq != len(fields) || len(words)-eq-1 != len(targets) {
+			continue
+		}
+
+		isOption := false
+		match := true
+		for i, field := range fields {
+			pattern := words[i]
+			switch field {
+			case "model":
+				match = xkbRuleMatch(pattern, names.Model, groups)
+			case "layout":
+				match = xkbRuleMatch(pattern, names.Layout, groups)
+			case "variant":
+				match = xkbRuleMatch(pattern, names.Variant, groups)
+			case "option":
+				isOption = true
+				match = slices.ContainsFunc(options, func(o string) bool { return o != "" && xkbRuleMatch(pattern, o, groups) })
+			default:
+				match = false
+			}
+			if !match {
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+
+		for i, target := range targets {
+			value := xkbRuleExpand(words[eq+1+i], names)
+			to := components[target]
+			switch {
+			case value != "" && (value[0] == '+' || value[0] == '|') || to == "":
+				components[target] = to + value
+			case to[0] == '+' || to[0] == '|':
+				components[target] = value + to
+			}
+		}
+		matched = !isOption
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, kind := range []string{"keycodes", "types", "symbols"} {
+		components[kind] = strings.TrimLeft(components[kind], "+|")
+		if components[kind] == "" {
+			return nil, fmt.Errorf("%w: %s: no %s for %+v", ErrInvalidKeymap, path, kind, names)
+		}
+	}
+
+	return components, nil
+}
+
+// xkbRuleMatch reports whether value matches the pattern of a rule: a
+// wildcard, a $group, or a value.
+func xkbRuleMatch(pattern, value string, groups map[string][]string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasPrefix(pattern, "$"):
+		return slices.Contains(groups[pattern], value)
+	}
+
+	return pattern == value
+}
+
+// xkbRuleExpand expands the %m, %l, and %v sequences of the value of a rule,
+// along with their %(v) and %+v forms that wrap or prefix non-empty values.
+func xkbRuleExpand(s string, names RMLVO) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		var prefix, suffix string
+		switch s[i] {
+		case '(':
+			prefix, suffix = "(", ")"
+			i++
+		case '+', '|', '_', '-':
+			prefix = string(s[i])
+			i++
+		}
+		if i == len(s) {
+			break
+		}
+
+		var value string
+		switch s[i] {
+		case 'm':
+			value = names.Model
+		case 'l':
+			value = names.Layout
+		case 'v':
+			value = names.Variant
+		case '%':
+			b.WriteByte('%')
+			continue
+		}
+		if strings.HasPrefix(s[i+1:], "[1]") {
+			i += 3
+		}
+		if suffix != "" && i+1 < len(s) && s[i+1] == ')' {
+			i++
+		}
+
+		if value != "" {
+			b.WriteString(prefix + value + suffix)
+		}
+	}
+
+	return b.String()
+}
+
+// xkbConfigRoot returns the directory of the XKB data files.
+func xkbConfigRoot() string {
+	if dir := os.Getenv("XKB_CONFIG_ROOT"); dir != "" {
+		return dir
+	}
+
+	return defaultXKBConfigRoot
+}
+
+// systemRMLVO returns the XKB names configured for the machine.
+func systemRMLVO() RMLVO {
+	var names RMLVO
+
+	if f, err := os.Open("/etc/default/keyboard"); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+			if !ok {
+				continue
+			}
+			value = strings.Trim(value, `"'`)
+			switch key {
+			case "XKBMODEL":
+				names.Model = value
+			case "XKBLAYOUT":
+				names.Layout = value
+			case "XKBVARIANT":
+				names.Variant = value
+			case "XKBOPTIONS":
+				names.Options = value
+			}
+		}
+		_ = f.Close()
+	}
+
+	for env, field := range map[string]*string{
+		"XKB_DEFAULT_RULES":   &names.Rules,
+		"XKB_DEFAULT_MODEL":   &names.Model,
+		"XKB_DEFAULT_LAYOUT":  &names.Layout,
+		"XKB_DEFAULT_VARIANT": &names.Variant,
+		"XKB_DEFAULT_OPTIONS": &names.Options,
+	} {
+		if value := os.Getenv(env); value != "" {
+			*field = value
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,352 @@
+//go:build linux
+
+package keybd_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+// testXKBFiles are the XKB data files of a small configuration root with a
+// German layout.
+var testXKBFiles = map[string]string{
+	"rules/evdev": `// rules
+! $azerty = be fr
+! $qwertz = de \
+	ch
+
+! model		=	keycodes
+  *		=	evdev
+
+! layout	=	keycodes
+  $azerty	=	+aliases(azerty)
+  $qwertz	=	+aliases(qwertz)
+  *		=	+aliases(qwerty)
+
+! model		=	types
+  *		=	complete
+
+! model		layout		variant		=	symbols
+  *		de		nodeadkeys	=	pc+de(nodeadkeys)
+
+! model		layout		=	symbols
+  *		*		=	pc+%l%(v)
+
+! layout[1]	=	symbols
+  *		=	pc+%l[1]%(v[1])
+
+! model		=	symbols
+  *		=	+inet(evdev)
+
+! option	=	symbols
+  compose:menu	=	+compose(menu)
+`,
+	"keycodes/evdev": `default xkb_keycodes "evdev" {
+	<TLDE> = 49; <AE01> = 10; <AD01> = 24; <AD06> = 29;
+	<AC11> = 48; <AB01> = 52; <SPCE> = 65; <MENU> = 135;
+};`,
+	"keycodes/aliases": `xkb_keycodes "qwerty" {
+	alias <LatY> = <AD06>;
+	alias <LatZ> = <AB01>;
+};
+xkb_keycodes "qwertz" {
+	alias <LatY> = <AB01>;
+	alias <LatZ> = <AD06>;
+};`,
+	"types/complete": `default xkb_types "complete" { include "basic" };`,
+	"types/basic": `default xkb_types "basic" {
+	type "TWO_LEVEL" { modifiers = Shift; map[Shift] = Level2; };
+};`,
+	"symbols/pc": `default partial xkb_symbols "pc105" { key <SPCE> { [ space ] }; };`,
+	"symbols/latin": `default partial alphanumeric_keys xkb_symbols "basic" {
+	key <TLDE> { [ grave, asciitilde ] };
+	key <AE01> { [ 1, exclam, onesuperior, exclamdown ] };
+	key <AD01> { [ q, Q, at, Greek_OMEGA ] };
+	key <LatY> { [ y, Y ] };
+	key <LatZ> { [ z, Z ] };
+};`,
+	"symbols/de": `default xkb_symbols "basic" {
+	include "latin"
+	name[Group1] = "German";
+	key <TLDE> { [ dead_circumflex, degree ] };
+	key <AE01> { [ 1, exclam ] };
+	key <AC11> { [ adiaeresis, Adiaeresis ] };
+};
+
+partial xkb_symbols "nodeadkeys" {
+	include "de(basic)"
+	name[Group1] = "German (no dead keys)";
+	key <TLDE> { [ asciicircum, degree ] };
+};`,
+	"symbols/se": `default partial alphanumeric_keys xkb_symbols "basic" {
+	include "latin"
+	include "se(se)"
+	name[Group1] = "Swedish";
+};
+
+hidden partial alphanumeric_keys xkb_symbols "se" {
+	key <AC11> { [ adiaeresis, Adiaeresis ] };
+};`,
+	"symbols/inet": `partial xkb_symbols "evdev" { augment key <SPCE> { [ nobreakspace ] }; };`,
+	"symbols/compose": `partial modifier_keys xkb_symbols "menu" {
+	key <MENU> { type[Group1] = "TWO_LEVEL", [ Multi_key, Multi_key ] };
+};`,
+}
+
+// useTestXKB points XKB_CONFIG_ROOT at a copy of testXKBFiles.
+func useTestXKB(t *testing.T) {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, src := range testXKBFiles {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatalf(test.ErrUnexpectedF, err)
+		}
+	}
+
+	t.Setenv("XKB_CONFIG_ROOT", root)
+}
+
+func TestLoadXKBKeymap(t *testing.T) {
+	tName := "XKB"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	useTestXKB(t)
+
+	var (
+		grave = keybd.Keystroke{Code: keybd.KEY_GRAVE}
+		space = keybd.Keystroke{Code: keybd.KEY_SPACE}
+	)
+
+	scenes := []test.Scene{
+		{Input: []any{keybd.RMLVO{Layout: "de"}, 'z'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_Y}}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "de"}, '¹'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_1, Mods: keybd.ModAltGr}}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "de"}, 'Ä'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_APOSTROPHE, Mods: keybd.ModShift}}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "de"}, '^'}, Output: keybd.LayoutKey{Keystroke: space, Dead: grave}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "de", Variant: "nodeadkeys"}, '^'}, Output: keybd.LayoutKey{Keystroke: grave}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "de,us", Variant: "nodeadkeys,"}, '^'}, Output: keybd.LayoutKey{Keystroke: grave}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "se"}, 'y'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_Y}}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "se"}, 'ä'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_APOSTROPHE}}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "latin"}, 'y'}, Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_Y}}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "latin"}, ' '}, Output: keybd.LayoutKey{Keystroke: space}, Passing: true},
+		{Input: []any{keybd.RMLVO{Layout: "latin"}, 'ä'}, Output: keybd.LayoutKey{}, Passing: false},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			in := s.Input.([]any)
+
+			l, err := keybd.LoadXKBKeymap(in[0].(keybd.RMLVO))
+			if err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+
+			got, err := l.Lookup(in[1].(rune))
+			if s.Passing && err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			} else if !s.Passing && !errors.Is(err, keybd.ErrNoKeystroke) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
+			}
+			if want := s.Output.(keybd.LayoutKey); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+
+	l, err := keybd.LoadXKBKeymap(keybd.RMLVO{Layout: "de", Variant: "nodeadkeys", Options: "compose:menu"})
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if got, want := l.Name, "de(nodeadkeys)"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := l.ComposeKey, (keybd.Keystroke{Code: keybd.KEY_COMPOSE}); got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	if _, err := keybd.LoadXKBKeymap(keybd.RMLVO{Layout: "xx"}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf(test.ErrWantFGotF, os.ErrNotExist, err)
+	}
+	if _, err := keybd.LoadXKBKeymap(keybd.RMLVO{Rules: "base"}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf(test.ErrWantFGotF, os.ErrNotExist, err)
+	}
+}
+
+func TestGetKeyboardLayoutInfo(t *testing.T) {
+	tName := "XKB"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	useTestXKB(t)
+	t.Setenv("XKB_DEFAULT_LAYOUT", "de")
+	t.Setenv("XKB_DEFAULT_VARIANT", "nodeadkeys")
+
+	info := keybd.GetKeyboardLayoutInfo()
+	if got, want := info.Names.Layout, "de"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := info.Layout.Name, "de(nodeadkeys)"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	// A layout that does not compile falls back to the US layout.
+	t.Setenv("XKB_CONFIG_ROOT", t.TempDir())
+
+	info = keybd.GetKeyboardLayoutInfo()
+	if got, want := info.Layout.Name, "us"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestXKBLayoutSource(t *testing.T) {
+	tName := "Watcher"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	useTestXKB(t)
+	t.Setenv("DISPLAY", "")
+	t.Setenv("XKB_DEFAULT_LAYOUT", "de")
+
+	source := keybd.SystemLayoutSource()
+
+	l, err := source.ActiveLayout()
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if got, want := l.Name, "de"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	// The layout is compiled again only when the names change.
+	if got, err := source.ActiveLayout(); err != nil || got != l {
+		t.Errorf(test.ErrWantFGotF, l, got)
+	}
+
+	t.Setenv("XKB_DEFAULT_VARIANT", "nodeadkeys")
+
+	if l, err = source.ActiveLayout(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if got, want := l.Name, "de(nodeadkeys)"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestXKBLayoutSourceX11(t *testing.T) {
+	tName := "Watcher"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	useTestXKB(t)
+
+	f, conn := newFakeX11(t, true)
+	x, err := keybd.NewX11(conn)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	source := keybd.XKBLayoutSource{X11: x}
+
+	if _, err := source.ActiveLayout(); err == nil {
+		t.Errorf(test.ErrWantFGotF, "error", "none")
+	}
+
+	f.setXKBNames("evdev", "pc105", "de,us", "nodeadkeys,", "compose:menu")
+
+	names, err := x.XKBNames()
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	if want := (keybd.RMLVO{Rules: "evdev", Model: "pc105", Layout: "de,us", Variant: "nodeadkeys,", Options: "compose:menu"}); names != want {
+		t.Errorf(test.ErrWantFGotF, want, names)
+	}
+
+	w, err := keybd.WatchLayout(context.Background(), source, time.Hour)
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+	defer w.Close()
+
+	if got, want := w.Layout().Name, "de(nodeadkeys)"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	f.setXKBNames("evdev", "pc105", "latin")
+
+	if err := w.Refresh(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	change := <-w.Changes()
+	if got, want := change.New.Name, "latin"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := change.Old.Name, "de(nodeadkeys)"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	// Switching groups switches to the layout of the group.
+	f.setXKBNames("evdev", "pc105", "latin,de", ",nodeadkeys")
+	f.setGroup(1)
+
+	if err := w.Refresh(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	change = <-w.Changes()
+	if got, want := change.New.Name, "de(nodeadkeys)"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	f.setGroup(0)
+
+	if err := w.Refresh(); err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	change = <-w.Changes()
+	if got, want := change.New.Name, "latin"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestRMLVOGroup(t *testing.T) {
+	tName := "XKB"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	names := keybd.RMLVO{Rules: "evdev", Layout: "us,de,fr", Variant: ",nodeadkeys", Options: "grp:alt_shift_toggle"}
+
+	scenes := []test.Scene{
+		{Input: 0, Output: keybd.RMLVO{Rules: "evdev", Layout: "us", Options: "grp:alt_shift_toggle"}},
+		{Input: 1, Output: keybd.RMLVO{Rules: "evdev", Layout: "de", Variant: "nodeadkeys", Options: "grp:alt_shift_toggle"}},
+		{Input: 2, Output: keybd.RMLVO{Rules: "evdev", Layout: "fr", Options: "grp:alt_shift_toggle"}},
+		{Input: 4, Output: keybd.RMLVO{Rules: "evdev", Layout: "de", Variant: "nodeadkeys", Options: "grp:alt_shift_toggle"}},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			if got, want := names.Group(s.Input.(int)), s.Output.(keybd.RMLVO); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
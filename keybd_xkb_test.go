@@ -0,0 +1,207 @@
+package keybd_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kamaranl/gotools/test"
+	"github.com/kamaranl/keybd"
+)
+
+const testKeymap = `xkb_keymap {
+xkb_keycodes "evdev+aliases(qwertz)" {
+	minimum = 8;
+	maximum = 255;
+	<TLDE> = 49;
+	<AE01> = 10;
+	<AD01> = 24;
+	<AD03> = 26;
+	<AD06> = 29;
+	<AC01> = 38;
+	<AC11> = 48;
+	<AB01> = 52;
+	<SPCE> = 65;
+	<RTRN> = 36;
+	<KP1>  = 87;
+	<MENU> = 135;
+	indicator 1 = "Caps Lock";
+	alias <LatY> = <AD06>;
+	alias <LatZ> = <AB01>;
+};
+xkb_types "complete" {
+	virtual_modifiers NumLock,Alt,LevelThree;
+	type "ONE_LEVEL" {
+		modifiers= none;
+		level_name[Level1]= "Any";
+	};
+	type "ALPHABETIC" {
+		modifiers= Shift+Lock;
+		map[Shift]= Level2;
+		map[Lock]= Level2;
+	};
+	type "FOUR_LEVEL" {
+		modifiers= Shift+LevelThree;
+		map[Shift]= Level2;
+		map[LevelThree]= Level3;
+		map[Shift+LevelThree]= Level4;
+	};
+	type "LOCAL_EIGHT_LEVEL" {
+		modifiers= Shift+Lock+LevelThree;
+		map[Lock]= Level2;
+		map[Shift+Lock]= Level1;
+		map[LevelThree]= Level3;
+		map[Lock+LevelThree]= Level4;
+	};
+};
+xkb_compatibility "complete" {
+	interpret Shift_Lock+AnyOf(Shift+Lock) {
+		action= LockMods(modifiers=Shift);
+	};
+};
+xkb_symbols "pc+de+inet(evdev)" {
+	name[Group1]="German";
+
+	key <TLDE> { [ dead_circumflex, degree, U2032 ] };
+	key <AE01> { [ 1, exclam, onesuperior, exclamdown ] };
+	key <AD01> { type= "FOUR_LEVEL", [ q, Q, at, Greek_OMEGA ] };
+	key <AD03> { symbols[Group1]= [ e, E, EuroSign, NoSymbol ], symbols[Group2]= [ Cyrillic_u ] };
+	key <LatY> { [ z, Z ] };
+	key <LatZ> { [ y, Y ] };
+	key <AC01> { type[Group1]= "LOCAL_EIGHT_LEVEL", [ a, A, ae, AE ] };
+	key <AC11> { [ adiaeresis, Adiaeresis, dead_circumflex, dead_caron ] };
+	key <SPCE> { [ space ] };
+	key <RTRN> { [ Return ] };
+	key <KP1>  { [ KP_End, KP_1 ] };
+	key <MENU> { [ Multi_key ] };
+	modifier_map Mod5 { <LVL3> };
+};
+xkb_geometry "pc(pc105)" {
+	shape "NORM" { corner= 1, { [ 18, 18 ] }, { [ 2, 1 ], [ 16, 16 ] } };
+};
+};
+`
+
+func TestParseXKBKeymap(t *testing.T) {
+	tName := "XKB"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	l, err := keybd.ParseXKBKeymap(strings.NewReader(testKeymap))
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	if got, want := l.Name, "German"; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+	if got, want := l.ComposeKey, (keybd.Keystroke{Code: keybd.KEY_COMPOSE}); got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+
+	scenes := []test.Scene{
+		{Input: '1', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_1}}, Passing: true},
+		{Input: '¡', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_1, Mods: keybd.ModAltGr | keybd.ModShift}}, Passing: true},
+		{Input: '@', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_Q, Mods: keybd.ModAltGr}}, Passing: true},
+		{Input: '€', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_E, Mods: keybd.ModAltGr}}, Passing: true},
+		{Input: 'z', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_Y}}, Passing: true},
+		{Input: 'Y', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_Z, Mods: keybd.ModShift}}, Passing: true},
+		{Input: 'A', Output: keybd.LayoutKey{}, Passing: false},
+		{Input: 'æ', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_A, Mods: keybd.ModAltGr}}, Passing: true},
+		{Input: 'Ä', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_APOSTROPHE, Mods: keybd.ModShift}}, Passing: true},
+		{Input: '′', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_GRAVE, Mods: keybd.ModAltGr}}, Passing: true},
+		{Input: 'ê', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_E}, Dead: keybd.Keystroke{Code: keybd.KEY_GRAVE}}, Passing: true},
+		{Input: 'ě', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_E}, Dead: keybd.Keystroke{Code: keybd.KEY_APOSTROPHE, Mods: keybd.ModAltGr | keybd.ModShift}}, Passing: true},
+		{Input: '\n', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_ENTER}}, Passing: true},
+		{Input: 'у', Output: keybd.LayoutKey{}, Passing: false},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			got, err := l.Lookup(s.Input.(rune))
+			if s.Passing && err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			} else if !s.Passing && !errors.Is(err, keybd.ErrNoKeystroke) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrNoKeystroke, err)
+			}
+			if want := s.Output.(keybd.LayoutKey); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+
+	// The keypad keys depend on NumLock and are left out.
+	if got, want := len(l.Keys), 22; got != want {
+		t.Errorf(test.ErrWantFGotF, want, got)
+	}
+}
+
+func TestParseXKBKeymapIncludes(t *testing.T) {
+	tName := "XKB"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	// Include statements end without a semicolon, so the statements after
+	// them must still be read.
+	l, err := keybd.ParseXKBKeymap(strings.NewReader(`xkb_keymap {
+xkb_keycodes "evdev" { <AE01> = 10; <AC11> = 48; };
+xkb_symbols "pc+se" {
+	include "pc"
+	include "se(basic)"
+	key <AC11> { [ adiaeresis, Adiaeresis ] };
+	augment "inet(evdev)"
+	key <AE01> { [ 1, exclam ] };
+};
+};`))
+	if err != nil {
+		t.Fatalf(test.ErrUnexpectedF, err)
+	}
+
+	scenes := []test.Scene{
+		{Input: 'ä', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_APOSTROPHE}}},
+		{Input: '!', Output: keybd.LayoutKey{Keystroke: keybd.Keystroke{Code: keybd.KEY_1, Mods: keybd.ModShift}}},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			got, err := l.Lookup(s.Input.(rune))
+			if err != nil {
+				t.Fatalf(test.ErrUnexpectedF, err)
+			}
+			if want := s.Output.(keybd.LayoutKey); got != want {
+				t.Errorf(test.ErrWantFGotF, want, got)
+			}
+		})
+	}
+}
+
+func TestParseXKBKeymapInvalid(t *testing.T) {
+	tName := "XKB"
+	if !enabled[tName] {
+		t.Skip(tName + test.TestsDisabled)
+	}
+
+	scenes := []test.Scene{
+		{Input: "xkb_keymap {\n xkb_keycodes { <AE01> = ten; };\n};", Output: "line 2:"},
+		{Input: "xkb_symbols {\n name = \"German; };", Output: "line 2:"},
+		{Input: "xkb_symbols { key <AE01 { [ 1 ] }; };", Output: "line 1:"},
+		{Input: "xkb_symbols { key <AE01> { [ 1 ] };", Output: "missing '}'"},
+		{Input: "xkb_symbols { };\n\n};", Output: "line 3:"},
+		{Input: "xkb_symbols { key <AE01> { [ 1 ] } * };", Output: "line 1:"},
+	}
+
+	for i, s := range scenes {
+		t.Run(fmt.Sprintf(tName+" #%d", i), func(t *testing.T) {
+			_, err := keybd.ParseXKBKeymap(strings.NewReader(s.Input.(string)))
+			if !errors.Is(err, keybd.ErrInvalidKeymap) {
+				t.Fatalf(test.ErrWantFGotF, keybd.ErrInvalidKeymap, err)
+			}
+			if want := s.Output.(string); !strings.Contains(err.Error(), want) {
+				t.Errorf(test.ErrWantFGotF, want, err)
+			}
+		})
+	}
+}